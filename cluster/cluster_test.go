@@ -0,0 +1,189 @@
+package cluster
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/amanjpro/zahak/engine"
+	. "github.com/amanjpro/zahak/evaluation"
+	. "github.com/amanjpro/zahak/search"
+)
+
+type recordingRemote struct {
+	*Coordinator
+	results []SearchResult
+}
+
+// Waits for the workers to finish their searches before stopping them, so that
+// the results do not depend on how fast the local search is
+func (r *recordingRemote) Stop() []SearchResult {
+	deadline := time.Now().Add(time.Minute)
+	for _, worker := range r.workers {
+		for len(worker.results) == 0 && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	r.results = r.Coordinator.Stop()
+	return r.results
+}
+
+func TestClusterSearchCanFindASimpleTactic(t *testing.T) {
+	address := fmt.Sprintf("unix:%s", filepath.Join(t.TempDir(), "worker.sock"))
+	worker, err := Listen(address, 1, 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer worker.Close()
+	go worker.Serve()
+
+	coordinator, err := Connect([]string{address})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer coordinator.Close()
+	remote := &recordingRemote{Coordinator: coordinator}
+
+	game := FromFen("3N1k2/N7/1p2ppR1/1P6/P2pP3/3Pb3/2r4n/3K4 b - - 0 1")
+	r := NewRunner(NewCache(16), NewPawnCache(DEFAULT_PAWNHASH_SIZE), 1)
+	r.Remote = remote
+	r.AddTimeManager(NewTimeManager(time.Now(), 400_000, true, 0, 0, false))
+	for _, e := range r.Engines {
+		e.Position = game.Position().Copy()
+		e.Ply = 1
+	}
+	r.Search(7)
+	expected := NewMove(C2, D2, BlackRook, NoPiece, NoType, 0)
+	mv := r.Move()
+	if mv != expected {
+		t.Errorf("Unexpected move was played:%s\n", fmt.Sprintf("Expected: %s\nGot: %s\n", expected.ToString(), mv.ToString()))
+	}
+	if len(remote.results) != 1 || remote.results[0].Depth != 7 || len(remote.results[0].Line) == 0 {
+		t.Fatalf("Expected the result of the worker, Got %v\n", remote.results)
+	}
+	if remote.results[0].Nodes == 0 || r.Nodes() <= remote.results[0].Nodes {
+		t.Errorf("Expected the nodes of the worker to be counted, Got %d\n", r.Nodes())
+	}
+}
+
+func TestCoordinatorDropsLateResults(t *testing.T) {
+	address := fmt.Sprintf("unix:%s", filepath.Join(t.TempDir(), "worker.sock"))
+	listener, err := listen(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	// A worker that answers every search with two results of the previous
+	// search, before its own one
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		worker := newConnection(conn)
+		decoder := json.NewDecoder(conn)
+		for {
+			var m message
+			if err := decoder.Decode(&m); err != nil {
+				return
+			}
+			if m.Type == searchMessage {
+				worker.send(message{Type: resultMessage, Id: m.Id - 1, Line: []string{"d2d4"}, Depth: 1})
+				worker.send(message{Type: resultMessage, Id: m.Id - 1, Line: []string{"c2c4"}, Depth: 1})
+				worker.send(message{Type: resultMessage, Id: m.Id, Line: []string{"e2e4"}, Depth: 1})
+			}
+		}
+	}()
+
+	coordinator, err := Connect([]string{address})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer coordinator.Close()
+
+	game := FromFen("rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1")
+	r := NewRunner(NewCache(1), NewPawnCache(DEFAULT_PAWNHASH_SIZE), 1)
+	for _, e := range r.Engines {
+		e.Position = game.Position().Copy()
+	}
+	for i := 0; i < 3; i++ {
+		coordinator.Start(r, 1)
+		results := coordinator.Stop()
+		if len(results) != 1 || len(results[0].Line) != 1 || results[0].Line[0].ToString() != "e2e4" {
+			t.Fatalf("Expected the result of search %d, Got %v\n", i, results)
+		}
+	}
+}
+
+func TestWorkerSurvivesAnInvalidFen(t *testing.T) {
+	address := fmt.Sprintf("unix:%s", filepath.Join(t.TempDir(), "worker.sock"))
+	worker, err := Listen(address, 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer worker.Close()
+	server, client := net.Pipe()
+	defer client.Close()
+	go worker.serve(server)
+
+	coordinator := newConnection(client)
+	decoder := json.NewDecoder(client)
+	result := func(id uint32) message {
+		for {
+			var m message
+			if err := decoder.Decode(&m); err != nil {
+				t.Fatalf("The worker stopped serving after search %d: %s\n", id, err)
+			}
+			if m.Type == resultMessage {
+				return m
+			}
+		}
+	}
+
+	fens := []string{
+		"",
+		"not a fen",
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 x",
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQ1BNR w kq - 0 1",
+		"4k3/8/8/8/8/8/4R3/4K3 w - - 0 1",
+	}
+	for i, fen := range fens {
+		id := uint32(i + 1)
+		coordinator.send(message{Type: searchMessage, Id: id, Fen: fen, Depth: 1})
+		if m := result(id); m.Id != id || m.Depth != 0 || len(m.Line) != 0 {
+			t.Errorf("Expected an empty result for %q, Got %v\n", fen, m)
+		}
+	}
+
+	id := uint32(len(fens) + 1)
+	coordinator.send(message{Type: searchMessage, Id: id, Fen: "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", Depth: 1})
+	if m := result(id); m.Id != id || m.Depth == 0 || len(m.Line) == 0 {
+		t.Errorf("Expected the worker to search a valid FEN, Got %v\n", m)
+	}
+}
+
+func TestParseLineStopsAtAnIllegalMove(t *testing.T) {
+	game := FromFen("rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1")
+	line := parseLine(game.Position(), []string{"e2e4", "e7e5", "e4e5", "d7d5"})
+	if len(line) != 2 || line[0].ToString() != "e2e4" || line[1].ToString() != "e7e5" {
+		t.Errorf("Expected the line to stop before the illegal move, Got %v\n", lineToStrings(line))
+	}
+}
+
+func TestSplitAddress(t *testing.T) {
+	for address, expected := range map[string][2]string{
+		"unix:/tmp/zahak.sock": {"unix", "/tmp/zahak.sock"},
+		"tcp:localhost:9000":   {"tcp", "localhost:9000"},
+		"localhost:9000":       {"tcp", "localhost:9000"},
+	} {
+		network, addr := splitAddress(address)
+		if network != expected[0] || addr != expected[1] {
+			t.Errorf("Unexpected address for %s, Got %s %s\n", address, network, addr)
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package cluster
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	. "github.com/amanjpro/zahak/engine"
+	. "github.com/amanjpro/zahak/search"
+)
+
+// The coordinator runs the searches of a runner on the workers too, the deep
+// entries of the transposition tables are exchanged while searching, and the
+// results of the workers take part in the vote for the best move
+type Coordinator struct {
+	workers []*remoteWorker
+	mu      sync.RWMutex
+	tt      *Cache
+	root    *Position
+	search  uint32 // The id of the current search
+	entries chan SharedEntry
+	quit    chan struct{}
+}
+
+type remoteWorker struct {
+	address string
+	*connection
+	results chan message
+	alive   bool
+}
+
+// How long the coordinator waits for the results of the workers, in milliseconds
+const RESULT_TIMEOUT = 2000
+
+func Connect(addresses []string) (*Coordinator, error) {
+	c := &Coordinator{entries: make(chan SharedEntry, MAX_SHARED_ENTRIES)}
+	for _, address := range addresses {
+		conn, err := dial(address)
+		if err != nil {
+			c.Close()
+			return nil, fmt.Errorf("could not connect to %s: %v", address, err)
+		}
+		worker := &remoteWorker{address, newConnection(conn), make(chan message, 1), true}
+		c.workers = append(c.workers, worker)
+	}
+	for _, worker := range c.workers {
+		go c.receive(worker)
+	}
+	return c, nil
+}
+
+func (c *Coordinator) Close() {
+	for _, worker := range c.workers {
+		worker.conn.Close()
+	}
+}
+
+func (c *Coordinator) receive(worker *remoteWorker) {
+	decoder := json.NewDecoder(worker.conn)
+	for {
+		var m message
+		if err := decoder.Decode(&m); err != nil {
+			c.mu.Lock()
+			worker.alive = false
+			c.mu.Unlock()
+			close(worker.results)
+			return
+		}
+		switch m.Type {
+		case resultMessage:
+			c.mu.RLock()
+			current := m.Id == c.search
+			c.mu.RUnlock()
+			if !current {
+				continue
+			}
+			// Start drains the results, there is never more than one for a search
+			select {
+			case worker.results <- m:
+			default:
+			}
+		case entriesMessage:
+			// The lock is held while importing, see SetTable
+			c.mu.RLock()
+			if c.tt != nil {
+				importEntries(c.tt, m.Entries)
+			}
+			c.mu.RUnlock()
+			c.broadcast(m, worker)
+		}
+	}
+}
+
+// Sends the message to all the workers that are alive, except one
+func (c *Coordinator) broadcast(m message, except *remoteWorker) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for _, worker := range c.workers {
+		if worker != except && worker.alive {
+			worker.send(m)
+		}
+	}
+}
+
+// Imports the entries of the workers into the table from now on, nil drops
+// them. The entries that were being imported into the old table are done once
+// it returns, so the old table can be closed then
+func (c *Coordinator) SetTable(tt *Cache) {
+	c.mu.Lock()
+	c.tt = tt
+	c.mu.Unlock()
+}
+
+func (c *Coordinator) Start(runner *Runner, depth int8) {
+	root := runner.Engines[0]
+	c.mu.Lock()
+	c.tt = root.TranspositionTable
+	c.root = root.Position.Copy()
+	c.search += 1
+	id := c.search
+	c.mu.Unlock()
+	// Results of an earlier search that arrived after it timed out
+	for _, worker := range c.workers {
+		drainResults(worker.results)
+	}
+	runner.SharedEntries = c.entries
+	runner.ShareDepth = DEFAULT_SHARE_DEPTH
+
+	c.quit = make(chan struct{})
+	go shareEntries(c.entries, c.quit, func(entries []entry) {
+		c.broadcast(message{Type: entriesMessage, Entries: entries}, nil)
+	})
+
+	c.broadcast(message{Type: searchMessage, Id: id, Fen: fenOf(root.Position), Ply: root.Ply, Depth: depth}, nil)
+}
+
+func drainResults(results chan message) {
+	for {
+		select {
+		case _, ok := <-results:
+			if !ok {
+				return
+			}
+		default:
+			return
+		}
+	}
+}
+
+func (c *Coordinator) Stop() []SearchResult {
+	close(c.quit)
+	c.broadcast(message{Type: stopMessage}, nil)
+
+	c.mu.RLock()
+	id := c.search
+	c.mu.RUnlock()
+
+	results := []SearchResult{}
+	deadline := time.Now().Add(RESULT_TIMEOUT * time.Millisecond)
+	for _, worker := range c.workers {
+		if m, ok := c.waitForResult(worker, id, deadline); ok {
+			line := parseLine(c.root, m.Line)
+			depth := m.Depth
+			if len(line) == 0 {
+				depth = 0
+			}
+			results = append(results, SearchResult{Line: line, Score: m.Score, Depth: depth, Nodes: m.Nodes})
+		}
+	}
+	return results
+}
+
+// Waits for the result of the search with the given id, the results of earlier
+// searches are dropped
+func (c *Coordinator) waitForResult(worker *remoteWorker, id uint32, deadline time.Time) (message, bool) {
+	timeout := time.After(time.Until(deadline))
+	for {
+		select {
+		case m, ok := <-worker.results:
+			if !ok {
+				return m, false
+			}
+			if m.Id == id {
+				return m, true
+			}
+		case <-timeout:
+			fmt.Printf("info string worker %s did not send its result in time\n", worker.address)
+			return message{}, false
+		}
+	}
+}
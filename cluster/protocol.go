@@ -0,0 +1,145 @@
+package cluster
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	. "github.com/amanjpro/zahak/engine"
+	. "github.com/amanjpro/zahak/search"
+)
+
+// A coordinator and its workers exchange JSON messages, one per line:
+//
+//   search   coordinator -> worker, search the position (id, fen, ply, depth)
+//   stop     coordinator -> worker, stop searching
+//   result   worker -> coordinator, the id, line, score, depth and nodes of the
+//            search, sent once when the search ends or is stopped
+//   entries  both ways, deep entries of the transposition table
+//
+// The coordinator forwards the entries it receives to the other workers, and
+// drops the results whose id is not the one of its current search
+
+const (
+	searchMessage  = "search"
+	stopMessage    = "stop"
+	resultMessage  = "result"
+	entriesMessage = "entries"
+)
+
+type message struct {
+	Type    string   `json:"type"`
+	Id      uint32   `json:"id,omitempty"`
+	Fen     string   `json:"fen,omitempty"`
+	Ply     uint16   `json:"ply,omitempty"`
+	Depth   int8     `json:"depth,omitempty"`
+	Line    []string `json:"line,omitempty"`
+	Score   int16    `json:"score,omitempty"`
+	Nodes   int64    `json:"nodes,omitempty"`
+	Entries []entry  `json:"entries,omitempty"`
+}
+
+// An entry of the transposition table, its data is packed like in the table
+type entry struct {
+	Hash uint64 `json:"h"`
+	Data uint64 `json:"d"`
+}
+
+// How often the entries of the transposition table are sent, in milliseconds
+const SHARE_INTERVAL = 100
+
+// The most entries that are sent at once
+const MAX_SHARED_ENTRIES = 4096
+
+func packEntries(shared []SharedEntry) []entry {
+	entries := make([]entry, len(shared))
+	for i, e := range shared {
+		entries[i] = entry{e.Hash, Pack(e.Entry.Move, e.Entry.Eval, e.Entry.StaticEval, e.Entry.Depth, e.Entry.Type, e.Entry.Age)}
+	}
+	return entries
+}
+
+func importEntries(tt *Cache, entries []entry) {
+	for _, e := range entries {
+		move, eval, staticEval, depth, nodeType, age := Unpack(e.Data)
+		tt.Import(e.Hash, CacheEntry{
+			Move:       move,
+			Eval:       eval,
+			StaticEval: staticEval,
+			Depth:      depth,
+			Type:       nodeType,
+			Age:        age,
+		})
+	}
+}
+
+// Reads the entries that are waiting in the channel, without blocking
+func drainEntries(entries chan SharedEntry) []SharedEntry {
+	shared := []SharedEntry{}
+	for len(shared) < MAX_SHARED_ENTRIES {
+		select {
+		case e := <-entries:
+			shared = append(shared, e)
+		default:
+			return shared
+		}
+	}
+	return shared
+}
+
+// Addresses are either unix:<path> or [tcp:]<host>:<port>
+func splitAddress(address string) (string, string) {
+	if strings.HasPrefix(address, "unix:") {
+		return "unix", strings.TrimPrefix(address, "unix:")
+	}
+	return "tcp", strings.TrimPrefix(address, "tcp:")
+}
+
+func dial(address string) (net.Conn, error) {
+	network, addr := splitAddress(address)
+	return net.Dial(network, addr)
+}
+
+func listen(address string) (net.Listener, error) {
+	network, addr := splitAddress(address)
+	return net.Listen(network, addr)
+}
+
+func fenOf(position *Position) string {
+	fen := position.Fen()
+	if len(strings.Fields(fen)) == 5 {
+		fen = fmt.Sprintf("%s 1", fen)
+	}
+	return fen
+}
+
+func lineToStrings(line []Move) []string {
+	moves := make([]string, len(line))
+	for i, move := range line {
+		moves[i] = move.ToString()
+	}
+	return moves
+}
+
+// Parses the line that a worker sent, up to its first move that is not legal
+func parseLine(position *Position, line []string) []Move {
+	position = position.Copy()
+	moves := []Move{}
+	for _, str := range line {
+		parsed := EmptyMove
+		for _, move := range position.PseudoLegalMoves() {
+			if move.ToString() == str {
+				parsed = move
+				break
+			}
+		}
+		if parsed == EmptyMove {
+			break
+		}
+		if _, _, _, ok := position.MakeMove(parsed); !ok {
+			break
+		}
+		moves = append(moves, parsed)
+	}
+	return moves
+}
@@ -0,0 +1,172 @@
+package cluster
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/bits"
+	"net"
+	"sync"
+	"time"
+
+	. "github.com/amanjpro/zahak/engine"
+	. "github.com/amanjpro/zahak/evaluation"
+	. "github.com/amanjpro/zahak/search"
+)
+
+// A worker searches the positions that a coordinator sends, it serves one
+// coordinator at a time
+type Worker struct {
+	listener net.Listener
+	runner   *Runner
+}
+
+func Listen(address string, threads int, hashSize uint32) (*Worker, error) {
+	listener, err := listen(address)
+	if err != nil {
+		return nil, err
+	}
+	runner := NewRunner(NewCache(hashSize), NewPawnCache(DEFAULT_PAWNHASH_SIZE), threads)
+	runner.SharedEntries = make(chan SharedEntry, MAX_SHARED_ENTRIES)
+	runner.ShareDepth = DEFAULT_SHARE_DEPTH
+	return &Worker{listener, runner}, nil
+}
+
+// Serves the coordinators, until the worker is closed
+func (w *Worker) Serve() error {
+	for {
+		conn, err := w.listener.Accept()
+		if err != nil {
+			return err
+		}
+		w.serve(conn)
+	}
+}
+
+func (w *Worker) Close() error {
+	return w.listener.Close()
+}
+
+type connection struct {
+	conn    net.Conn
+	encoder *json.Encoder
+	mu      sync.Mutex
+}
+
+func newConnection(conn net.Conn) *connection {
+	return &connection{conn: conn, encoder: json.NewEncoder(conn)}
+}
+
+func (c *connection) send(m message) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.encoder.Encode(m)
+}
+
+func (w *Worker) serve(conn net.Conn) {
+	defer conn.Close()
+	coordinator := newConnection(conn)
+	decoder := json.NewDecoder(conn)
+	runner := w.runner
+
+	quit := make(chan struct{})
+	defer close(quit)
+	go shareEntries(runner.SharedEntries, quit, func(entries []entry) {
+		coordinator.send(message{Type: entriesMessage, Entries: entries})
+	})
+
+	var done chan struct{}
+	stop := func() {
+		if done == nil {
+			return
+		}
+		runner.TimeManager.StopSearchNow = true
+		<-done
+		done = nil
+	}
+	defer stop()
+
+	for {
+		var m message
+		if err := decoder.Decode(&m); err != nil {
+			return
+		}
+		switch m.Type {
+		case searchMessage:
+			stop()
+			game, err := parseFen(m.Fen)
+			if err != nil {
+				// An empty result has no depth, the coordinator ignores it
+				fmt.Printf("info string %s\n", err)
+				coordinator.send(message{Type: resultMessage, Id: m.Id})
+				continue
+			}
+			for _, e := range runner.Engines {
+				e.Position = game.Position().Copy()
+				e.Ply = m.Ply
+			}
+			runner.AddTimeManager(NewTimeManager(time.Now(), MAX_TIME, false, 0, 0, false))
+			done = make(chan struct{})
+			go func(done chan struct{}, id uint32, depth int8) {
+				runner.Search(depth)
+				coordinator.send(message{
+					Type:  resultMessage,
+					Id:    id,
+					Line:  lineToStrings(runner.Line()),
+					Score: runner.Score(),
+					Depth: runner.Depth(),
+					Nodes: runner.Nodes(),
+				})
+				close(done)
+			}(done, m.Id, m.Depth)
+		case stopMessage:
+			stop()
+		case entriesMessage:
+			importEntries(runner.Engines[0].TranspositionTable, m.Entries)
+		default:
+			fmt.Printf("info string unknown cluster message %s\n", m.Type)
+		}
+	}
+}
+
+// Parses the FEN of a search message. FromFen panics on a malformed FEN, and
+// the search assumes one king per side and that the side that just moved is
+// not in check, a bad message must not take the worker down
+func parseFen(fen string) (game Game, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("invalid FEN %s: %v", fen, r)
+		}
+	}()
+	game = FromFen(fen)
+	position := game.Position()
+	board := position.Board
+	whiteKing := board.GetBitboardOf(WhiteKing)
+	blackKing := board.GetBitboardOf(BlackKing)
+	if bits.OnesCount64(whiteKing) != 1 || bits.OnesCount64(blackKing) != 1 {
+		return game, fmt.Errorf("invalid FEN %s: each side needs exactly one king", fen)
+	}
+	king := blackKing
+	if position.Turn() == Black {
+		king = whiteKing
+	}
+	if board.IsSquareAttacked(Square(bits.TrailingZeros64(king)), position.Turn()) {
+		return game, fmt.Errorf("invalid FEN %s: the side not to move is in check", fen)
+	}
+	return game, nil
+}
+
+// Sends the entries that the search shares in batches, until quit is closed
+func shareEntries(entries chan SharedEntry, quit chan struct{}, send func([]entry)) {
+	ticker := time.NewTicker(SHARE_INTERVAL * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-quit:
+			return
+		case <-ticker.C:
+			if shared := drainEntries(entries); len(shared) != 0 {
+				send(packEntries(shared))
+			}
+		}
+	}
+}
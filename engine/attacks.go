@@ -0,0 +1,138 @@
+package engine
+
+/**
+The attack queries about a single square or king, shared by move generation,
+static exchange evaluation and analysis tools. The results are bitboards, with
+one bit per square. The evaluation terms, like king safety and threats, do not
+use them, they work on the AttackMaps of all the pieces that are built once per
+evaluation
+*/
+
+// The pieces of the given color that attack the square, with the current
+// occupancy of the board
+func (b *Bitboard) AttackersTo(sq Square, color Color) uint64 {
+	return b.attacksTo(b.whitePieces|b.blackPieces, sq) & b.piecesOf(color)
+}
+
+// Whether any piece of the given color attacks the square
+func (b *Bitboard) IsSquareAttacked(sq Square, color Color) bool {
+	var pawns, knights, rq, bq, king uint64
+	mask := SquareMask[sq]
+	if color == White {
+		pawns = bPawnAnyAttacks(mask) & b.whitePawn
+		knights = b.whiteKnight
+		rq = b.whiteRook | b.whiteQueen
+		bq = b.whiteBishop | b.whiteQueen
+		king = b.whiteKing
+	} else {
+		pawns = wPawnAnyAttacks(mask) & b.blackPawn
+		knights = b.blackKnight
+		rq = b.blackRook | b.blackQueen
+		bq = b.blackBishop | b.blackQueen
+		king = b.blackKing
+	}
+	occupiedBB := b.whitePieces | b.blackPieces
+	return pawns != 0 ||
+		computedKnightAttacks[sq]&knights != 0 ||
+		computedKingAttacks[sq]&king != 0 ||
+		bishopAttacks(sq, occupiedBB, empty)&bq != 0 ||
+		rookAttacks(sq, occupiedBB, empty)&rq != 0
+}
+
+// The sliders of the given color that would attack the square, if the first
+// piece in their way was removed. Sliders that attack the square directly are
+// not included
+func (b *Bitboard) XrayAttackers(sq Square, color Color) uint64 {
+	var rq, bq uint64
+	if color == White {
+		rq = b.whiteRook | b.whiteQueen
+		bq = b.whiteBishop | b.whiteQueen
+	} else {
+		rq = b.blackRook | b.blackQueen
+		bq = b.blackBishop | b.blackQueen
+	}
+	occupiedBB := b.whitePieces | b.blackPieces
+	return xrayBishopAttacks(sq, occupiedBB)&bq | xrayRookAttacks(sq, occupiedBB)&rq
+}
+
+// The pieces of the given color that are pinned to their own king, they cannot
+// leave the line between the king and the slider that pins them
+func (b *Bitboard) Pinned(color Color) uint64 {
+	return b.pinned(color, nil)
+}
+
+// The pieces that check the king of the side to move
+func (p *Position) Checkers() uint64 {
+	checkers, _ := checkersOf(p.Board, p.Turn())
+	return checkers
+}
+
+// Finds the pinned pieces of the given color, and when rays is not nil, the
+// squares each of them can still move to, which includes the pinner
+func (b *Bitboard) pinned(color Color, rays *[64]uint64) uint64 {
+	var ownKing, opRQ, opBQ uint64
+	if color == White {
+		ownKing = b.whiteKing
+		opRQ = b.blackRook | b.blackQueen
+		opBQ = b.blackBishop | b.blackQueen
+	} else {
+		ownKing = b.blackKing
+		opRQ = b.whiteRook | b.whiteQueen
+		opBQ = b.whiteBishop | b.whiteQueen
+	}
+	if ownKing == 0 {
+		return 0
+	}
+	ownPieces := b.piecesOf(color)
+	occupiedBB := b.whitePieces | b.blackPieces
+	kingSq := Square(bitScanForward(ownKing))
+
+	var pinned uint64
+	diagonal := bishopAttacks(kingSq, occupiedBB, empty)
+	pinners := xrayBishopAttacks(kingSq, occupiedBB) & opBQ
+	for pinners != 0 {
+		sq := bitScanForward(pinners)
+		if piece := diagonal & bishopAttacks(Square(sq), occupiedBB, empty) & ownPieces; piece != 0 {
+			pinned |= piece
+			if rays != nil {
+				occ := occupiedBB ^ piece
+				rays[bitScanForward(piece)] = bishopAttacks(kingSq, occ, empty)&bishopAttacks(Square(sq), occ, empty) | SquareMask[sq]
+			}
+		}
+		pinners ^= SquareMask[sq]
+	}
+
+	straight := rookAttacks(kingSq, occupiedBB, empty)
+	pinners = xrayRookAttacks(kingSq, occupiedBB) & opRQ
+	for pinners != 0 {
+		sq := bitScanForward(pinners)
+		if piece := straight & rookAttacks(Square(sq), occupiedBB, empty) & ownPieces; piece != 0 {
+			pinned |= piece
+			if rays != nil {
+				occ := occupiedBB ^ piece
+				rays[bitScanForward(piece)] = rookAttacks(kingSq, occ, empty)&rookAttacks(Square(sq), occ, empty) | SquareMask[sq]
+			}
+		}
+		pinners ^= SquareMask[sq]
+	}
+	return pinned
+}
+
+func (b *Bitboard) piecesOf(color Color) uint64 {
+	if color == White {
+		return b.whitePieces
+	}
+	return b.blackPieces
+}
+
+// The squares a bishop sees behind the first piece on each of its diagonals
+func xrayBishopAttacks(sq Square, occupied uint64) uint64 {
+	attacks := bishopAttacks(sq, occupied, empty)
+	return attacks ^ bishopAttacks(sq, occupied^(attacks&occupied), empty)
+}
+
+// The squares a rook sees behind the first piece on each of its lines
+func xrayRookAttacks(sq Square, occupied uint64) uint64 {
+	attacks := rookAttacks(sq, occupied, empty)
+	return attacks ^ rookAttacks(sq, occupied^(attacks&occupied), empty)
+}
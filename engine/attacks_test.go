@@ -0,0 +1,70 @@
+package engine
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestAttackQueries(t *testing.T) {
+	fen := "4k3/4p3/2N5/8/3Q4/8/4R3/4K3 b - - 0 1"
+	b := FromFen(fen).position.Board
+
+	if got, expected := b.AttackersTo(D8, White), SquareMask[C6]|SquareMask[D4]; got != expected {
+		t.Errorf("Expected white attackers of d8 to be %d, got %d", expected, got)
+	}
+	if got, expected := b.AttackersTo(D8, Black), SquareMask[E8]; got != expected {
+		t.Errorf("Expected black attackers of d8 to be %d, got %d", expected, got)
+	}
+	if !b.IsSquareAttacked(D8, White) {
+		t.Errorf("Expected d8 to be attacked by white")
+	}
+	if b.IsSquareAttacked(F8, White) {
+		t.Errorf("Expected f8 not to be attacked by white")
+	}
+	if got, expected := b.XrayAttackers(E8, White), SquareMask[E2]; got != expected {
+		t.Errorf("Expected white x-ray attackers of e8 to be %d, got %d", expected, got)
+	}
+	if got, expected := b.Pinned(Black), SquareMask[E7]; got != expected {
+		t.Errorf("Expected black pinned pieces to be %d, got %d", expected, got)
+	}
+	if got := b.Pinned(White); got != 0 {
+		t.Errorf("Expected no white pinned pieces, got %d", got)
+	}
+}
+
+func TestCheckers(t *testing.T) {
+	p := FromFen("5Q2/8/1q5P/8/6k1/5R2/6P1/2r3K1 w - - 0 1").position
+	if got, expected := p.Checkers(), SquareMask[C1]|SquareMask[B6]; got != expected {
+		t.Errorf("Expected checkers to be %d, got %d", expected, got)
+	}
+	p = FromFen("rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1").position
+	if got := p.Checkers(); got != 0 {
+		t.Errorf("Expected no checkers, got %d", got)
+	}
+}
+
+func TestAttackQueriesAgree(t *testing.T) {
+	random := rand.New(rand.NewSource(50))
+	for game := 0; game < 50; game++ {
+		p := FromFen("r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1").position
+		for ply := 0; ply < 60; ply++ {
+			b := p.Board
+			for sq := A1; sq <= H8; sq++ {
+				for _, color := range []Color{White, Black} {
+					if b.IsSquareAttacked(sq, color) != (b.AttackersTo(sq, color) != 0) {
+						t.Fatalf("%s: attack queries disagree on %s for %d", p.Fen(), sq.Name(), color)
+					}
+				}
+			}
+			kingSq := Square(bitScanForward(b.GetBitboardOf(GetPiece(King, p.Turn()))))
+			if p.Checkers() != b.AttackersTo(kingSq, p.Turn().Other()) {
+				t.Fatalf("%s: checkers do not match the attackers of the king", p.Fen())
+			}
+			moves := p.LegalMoves()
+			if len(moves) == 0 {
+				break
+			}
+			p.MakeMove(moves[random.Intn(len(moves))])
+		}
+	}
+}
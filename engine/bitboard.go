@@ -2,6 +2,7 @@ package engine
 
 import (
 	"fmt"
+	"math/bits"
 )
 
 type Bitboard struct {
@@ -374,3 +375,46 @@ func (b *Bitboard) copy() *Bitboard {
 		b.blackPieces,
 	}
 }
+
+// Returns a copy of the board, with ranks flipped and colors swapped
+func (b *Bitboard) mirror() *Bitboard {
+	return &Bitboard{
+		bits.ReverseBytes64(b.whitePawn),
+		bits.ReverseBytes64(b.whiteKnight),
+		bits.ReverseBytes64(b.whiteBishop),
+		bits.ReverseBytes64(b.whiteRook),
+		bits.ReverseBytes64(b.whiteQueen),
+		bits.ReverseBytes64(b.whiteKing),
+		bits.ReverseBytes64(b.blackPawn),
+		bits.ReverseBytes64(b.blackKnight),
+		bits.ReverseBytes64(b.blackBishop),
+		bits.ReverseBytes64(b.blackRook),
+		bits.ReverseBytes64(b.blackQueen),
+		bits.ReverseBytes64(b.blackKing),
+		bits.ReverseBytes64(b.blackPieces),
+		bits.ReverseBytes64(b.whitePieces),
+	}
+}
+
+// Returns a copy of the board, with files flipped (a-file becomes h-file)
+func (b *Bitboard) flipHorizontal() *Bitboard {
+	flip := func(bb uint64) uint64 {
+		return bits.ReverseBytes64(bits.Reverse64(bb))
+	}
+	return &Bitboard{
+		flip(b.blackPawn),
+		flip(b.blackKnight),
+		flip(b.blackBishop),
+		flip(b.blackRook),
+		flip(b.blackQueen),
+		flip(b.blackKing),
+		flip(b.whitePawn),
+		flip(b.whiteKnight),
+		flip(b.whiteBishop),
+		flip(b.whiteRook),
+		flip(b.whiteQueen),
+		flip(b.whiteKing),
+		flip(b.whitePieces),
+		flip(b.blackPieces),
+	}
+}
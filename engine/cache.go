@@ -1,8 +1,9 @@
 package engine
 
-// import (
-// 	"fmt"
-// )
+import (
+	// "fmt"
+	"math/bits"
+)
 
 type CachedEval struct {
 	Key  uint64 // 8
@@ -17,38 +18,60 @@ const (
 	LowerBound                      // Cut-Node
 )
 
+// The entries are grouped in buckets that fill a cache line, a position can be
+// stored in any of the entries of its bucket
+const BUCKET_ENTRIES = 4
+
+type CacheBucket [BUCKET_ENTRIES]CachedEval
+
 type Cache struct {
-	items    []CachedEval
-	size     uint32
-	consumed int
-	length   uint64
+	buckets    []CacheBucket
+	size       uint32
+	powerOfTwo bool
+	shift      uint64
+	mapping    []byte     // The memory mapped file of a shared table
+	busy       *busyTable // The positions that are being searched, see IsBusy
 }
 
-const OldAge = uint16(5)
 const CACHE_ENTRY_SIZE = uint32(8 + 8)
+const CACHE_BUCKET_SIZE = CACHE_ENTRY_SIZE * BUCKET_ENTRIES
 const DEFAULT_CACHE_SIZE = uint32(128)
 const MAX_CACHE_SIZE = uint32(24000)
 
-const MOVE_MASK uint64 = 0b1111111111111111111111111111 // move << 0, 28 bits
-const EVAL_MASK uint64 = 0b1111111111111111             // eval << 28, 16 bits
-const DEPTH_MASK uint64 = 0b1111111                     // depth << 44, 7 bits
-const TYPE_MASK uint64 = 0b111                          // type << 51, 3 bits
-const AGE_MASK uint64 = 0b1111111111                    // age << 54, 10 bits
+// Every generation (i.e. full move) an entry is left behind costs it as much as
+// this many plies of depth, when picking an entry to replace
+const AGE_WEIGHT = 2
+
+// An entry only replaces a deeper entry of the same position, when it is at
+// most this many plies shallower once the age of the old entry is counted
+const SAME_POSITION_DEPTH_MARGIN = 3
 
-func Pack(hashmove Move, eval int16, depth int8, nodeType NodeType, age uint16) uint64 {
+// Number of buckets looked at to estimate how full the table is
+const HASHFULL_SAMPLE = 1000 / BUCKET_ENTRIES
+
+const MOVE_MASK uint64 = 0b1111111111111111        // move << 0, 16 bits
+const EVAL_MASK uint64 = 0b1111111111111111        // eval << 16, 16 bits
+const STATIC_EVAL_MASK uint64 = 0b1111111111111111 // static eval << 32, 16 bits
+const DEPTH_MASK uint64 = 0b1111111                // depth << 48, 7 bits
+const TYPE_MASK uint64 = 0b111                     // type << 55, 3 bits
+const AGE_MASK uint64 = 0b111111                   // age << 58, 6 bits
+
+func Pack(hashmove CompactMove, eval int16, staticEval int16, depth int8, nodeType NodeType, age uint16) uint64 {
 	return (uint64(hashmove) & MOVE_MASK) |
-		((uint64(eval) & EVAL_MASK) << 28) |
-		((uint64(depth) & DEPTH_MASK) << 44) |
-		((uint64(nodeType) & TYPE_MASK) << 51) |
-		((uint64(age) & AGE_MASK) << 54)
-}
-
-func Unpack(data uint64) (hashmove Move, eval int16, depth int8, nodeType NodeType, age uint16) {
-	hashmove = Move(data & MOVE_MASK)
-	eval = int16((data >> 28) & EVAL_MASK)
-	depth = int8((data >> 44) & DEPTH_MASK)
-	nodeType = NodeType((data >> 51) & TYPE_MASK)
-	age = uint16((data >> 54) & AGE_MASK)
+		((uint64(eval) & EVAL_MASK) << 16) |
+		((uint64(staticEval) & STATIC_EVAL_MASK) << 32) |
+		((uint64(depth) & DEPTH_MASK) << 48) |
+		((uint64(nodeType) & TYPE_MASK) << 55) |
+		((uint64(age) & AGE_MASK) << 58)
+}
+
+func Unpack(data uint64) (hashmove CompactMove, eval int16, staticEval int16, depth int8, nodeType NodeType, age uint16) {
+	hashmove = CompactMove(data & MOVE_MASK)
+	eval = int16((data >> 16) & EVAL_MASK)
+	staticEval = int16((data >> 32) & STATIC_EVAL_MASK)
+	depth = int8((data >> 48) & DEPTH_MASK)
+	nodeType = NodeType((data >> 55) & TYPE_MASK)
+	age = uint16((data >> 58) & AGE_MASK)
 	return
 }
 
@@ -57,85 +80,150 @@ func (c *CachedEval) Update(key uint64, data uint64) {
 	c.Data = data
 }
 
-func (c *Cache) Consumed() int {
-	return int((float64(c.consumed) / float64(len(c.items))) * 1000)
+// Spreads the hash with a multiplication, and takes the top bits as the index
+func (c *Cache) index(hash uint64) uint64 {
+	if c.powerOfTwo {
+		return (hash * 0x9E3779B97F4A7C15) >> c.shift
+	}
+	// Maps the upper half of the hash to [0, len) without a division
+	return ((hash >> 32) * uint64(len(c.buckets))) >> 32
 }
 
-func (c *Cache) index(hash uint64) uint32 {
-	return uint32(hash>>32) % uint32(len(c.items))
+// How many generations the age is behind the current one, only the lowest bits
+// of the age are stored, so it wraps around
+func ageDistance(age uint16, current uint16) uint16 {
+	return (current - age) & uint16(AGE_MASK)
 }
 
-func (c *Cache) Set(hash uint64, hashmove Move, eval int16, depth int8, nodeType NodeType, age uint16) {
-	// if hashmove == EmptyMove {
-	// 	return
-	// }
-	index := c.index(hash)
-
-	oldValue := c.items[index]
-	oldKey := oldValue.Key
-	oldData := oldValue.Data
+func replacementPriority(depth int8, age uint16, current uint16) int {
+	return int(depth) - AGE_WEIGHT*int(ageDistance(age, current))
+}
 
-	newData := Pack(hashmove, eval, depth, nodeType, age)
+// Stores the entry, and returns whether it evicted another position
+func (c *Cache) Set(hash uint64, hashmove Move, eval int16, staticEval int16, depth int8, nodeType NodeType, age uint16) bool {
+	newData := Pack(hashmove.Compact(), eval, staticEval, depth, nodeType, age)
 	// very good for debugging hash issues
-	// newHashmove, newEval, newDepth, newNodeType, newAge := Unpack(newData)
-	// if hashmove != newHashmove || eval != newEval || depth != newDepth || nodeType != newNodeType || age != newAge {
+	// newHashmove, newEval, newStaticEval, newDepth, newNodeType, newAge := Unpack(newData)
+	// if hashmove.Compact() != newHashmove || eval != newEval || staticEval != newStaticEval || depth != newDepth || nodeType != newNodeType || age&uint16(AGE_MASK) != newAge {
 	// 	panic(fmt.Sprintf(
 	// 		"Culprits are: %d %d %d %d %d\nSomehow became: %d %d %d %d %d\n", hashmove, eval, depth, nodeType, age, newHashmove, newEval, newDepth, newNodeType, newAge))
 	// }
+	return c.store(hash, newData, age)
+}
 
-	newKey := newData ^ hash
+// Stores an entry that another process searched, the entry of the same position
+// is only replaced when it is shallower
+func (c *Cache) Import(hash uint64, entry CacheEntry) bool {
+	if current, ok := c.Lookup(hash); ok && current.Depth > entry.Depth {
+		return false
+	}
+	c.store(hash, Pack(entry.Move, entry.Eval, entry.StaticEval, entry.Depth, entry.Type, entry.Age), entry.Age)
+	return true
+}
 
-	if oldData != 0 {
-		_, _, oldDepth, oldType, oldAge := Unpack(oldData)
-		if (hash ^ oldData) == oldKey {
-			c.items[index].Update(newKey, newData)
-			return
-		}
-		if age-oldAge >= OldAge {
-			c.items[index].Update(newKey, newData)
-			return
+func (c *Cache) store(hash uint64, newData uint64, age uint16) bool {
+	bucket := &c.buckets[c.index(hash)]
+
+	// The entry of the same position first, otherwise an empty entry, otherwise
+	// the entry with the lowest depth once aged
+	replace := -1
+	lowest := 0
+	for i := 0; i < BUCKET_ENTRIES; i++ {
+		data := bucket[i].Data
+		if data != 0 && bucket[i].Key^data == hash {
+			oldMove, _, _, oldDepth, _, oldAge := Unpack(data)
+			newMove, _, _, newDepth, newType, _ := Unpack(newData)
+			// Exact entries always replace, other ones only replace a much
+			// deeper entry of the current search
+			if newType != Exact &&
+				int(newDepth)+SAME_POSITION_DEPTH_MARGIN < replacementPriority(oldDepth, oldAge, age) {
+				return false
+			}
+			if newMove == EmptyCompactMove {
+				newData |= uint64(oldMove) & MOVE_MASK
+			}
+			bucket[i].Update(newData^hash, newData)
+			return false
 		}
-		if oldDepth > depth {
-			return
+		priority := -1 << 16
+		if data != 0 {
+			_, _, _, oldDepth, _, oldAge := Unpack(data)
+			priority = replacementPriority(oldDepth, oldAge, age)
 		}
-		if oldType == Exact || nodeType != Exact {
-			return
-		} else if nodeType == Exact {
-			c.items[index].Update(newKey, newData)
-			return
+		if replace == -1 || priority < lowest {
+			replace = i
+			lowest = priority
 		}
-		c.items[index].Update(newKey, newData)
-	} else {
-		c.consumed += 1
-		c.items[index].Update(newKey, newData)
 	}
+	evicted := bucket[replace].Data != 0
+	bucket[replace].Update(newData^hash, newData)
+	return evicted
 }
 
 func (c *Cache) Size() uint32 {
 	return c.size
 }
 
-func (c *Cache) Get(hash uint64) (Move, int16, int8, NodeType, bool) {
-	index := c.index(hash)
-	value := c.items[index]
-	data := value.Data
-	key := value.Key
-	ok := hash == (key ^ data)
-	if ok {
-		move, eval, depth, nType, _ := Unpack(data)
-		return move, eval, depth, nType, true
+func (c *Cache) PowerOfTwo() bool {
+	return c.powerOfTwo
+}
+
+// Returns the compact hash move, the score, the static evaluation, the depth
+// and the type of the node
+func (c *Cache) Get(hash uint64) (CompactMove, int16, int16, int8, NodeType, bool) {
+	if entry, ok := c.Lookup(hash); ok {
+		return entry.Move, entry.Eval, entry.StaticEval, entry.Depth, entry.Type, true
 	}
-	return 0, 0, 0, 0, false
+	return EmptyCompactMove, 0, 0, 0, 0, false
 }
 
+// Estimates the permill of the table that is used by the current generation,
+// by looking at the first entries
+func (c *Cache) Hashfull(age uint16) int {
+	sample := HASHFULL_SAMPLE
+	if len(c.buckets) < sample {
+		sample = len(c.buckets)
+	}
+	used := 0
+	for _, bucket := range c.buckets[:sample] {
+		for _, entry := range bucket {
+			if entry.Data == 0 {
+				continue
+			}
+			_, _, _, _, _, entryAge := Unpack(entry.Data)
+			if ageDistance(entryAge, age) == 0 {
+				used += 1
+			}
+		}
+	}
+	return used * 1000 / (sample * BUCKET_ENTRIES)
+}
+
+// Creates a table that uses all of the given memory
 func NewCache(megabytes uint32) *Cache {
+	return NewCacheWithSizing(megabytes, false)
+}
+
+// Creates a table, when powerOfTwo is set the number of buckets is rounded down
+// to a power of two
+func NewCacheWithSizing(megabytes uint32, powerOfTwo bool) *Cache {
 	if megabytes > MAX_CACHE_SIZE || megabytes < 1 {
 		return nil
 	}
-	size := int((megabytes * 1024 * 1024) / CACHE_ENTRY_SIZE)
-	length := RoundPowerOfTwo(size)
+	length, shift := cacheLayout(megabytes, powerOfTwo)
+	return &Cache{make([]CacheBucket, length), megabytes, powerOfTwo, shift, nil, newBusyTable()}
+}
 
-	return &Cache{make([]CachedEval, length), megabytes, 0, uint64(length)}
+// Returns the number of buckets that fit in the memory, and the shift of the
+// index when the number is rounded down to a power of two
+func cacheLayout(megabytes uint32, powerOfTwo bool) (int, uint64) {
+	length := int(uint64(megabytes) * 1024 * 1024 / uint64(CACHE_BUCKET_SIZE))
+	var shift uint64
+	if powerOfTwo {
+		length = RoundPowerOfTwo(length)
+		shift = 64 - uint64(bits.TrailingZeros64(uint64(length)))
+	}
+	return length, shift
 }
 
 func RoundPowerOfTwo(size int) int {
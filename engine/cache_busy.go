@@ -0,0 +1,53 @@
+package engine
+
+import (
+	"sync/atomic"
+)
+
+// For ABDADA, the table keeps track of the positions that are being searched,
+// so that the other threads can search other moves first. A position is marked
+// by its hash, in a small set-associative table that lives next to the buckets
+const BUSY_SLOTS = 1 << 14
+const BUSY_WAYS = 4
+
+type busyTable [BUSY_SLOTS][BUSY_WAYS]uint64
+
+func newBusyTable() *busyTable {
+	return new(busyTable)
+}
+
+// Is any thread searching the position
+func (c *Cache) IsBusy(hash uint64) bool {
+	slot := &c.busy[hash&(BUSY_SLOTS-1)]
+	for i := 0; i < BUSY_WAYS; i++ {
+		if atomic.LoadUint64(&slot[i]) == hash {
+			return true
+		}
+	}
+	return false
+}
+
+// Marks the position as being searched, when the slot is full the first way
+// is replaced
+func (c *Cache) MarkBusy(hash uint64) {
+	slot := &c.busy[hash&(BUSY_SLOTS-1)]
+	for i := 0; i < BUSY_WAYS; i++ {
+		current := atomic.LoadUint64(&slot[i])
+		if current == hash || (current == 0 && atomic.CompareAndSwapUint64(&slot[i], 0, hash)) {
+			return
+		}
+	}
+	atomic.StoreUint64(&slot[0], hash)
+}
+
+// Unmarks the position. When more threads search the same position, the first
+// one to finish unmarks it for all of them. This is deliberate: a mark is only a
+// hint to search another move first, and a missing one only costs a move that
+// is searched twice, while counting the threads per way would cost a counter
+// that must be kept exact across threads that stop at any time
+func (c *Cache) ClearBusy(hash uint64) {
+	slot := &c.busy[hash&(BUSY_SLOTS-1)]
+	for i := 0; i < BUSY_WAYS; i++ {
+		atomic.CompareAndSwapUint64(&slot[i], hash, 0)
+	}
+}
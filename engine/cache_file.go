@@ -0,0 +1,167 @@
+package engine
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+)
+
+// The transposition table can be saved to a file, and loaded back later. The
+// file starts with a header:
+//
+//   magic       [4]byte  "ZHTT"
+//   version     uint16   version of the file format and the entry layout
+//   scheme      uint8    how positions are mapped to buckets, see hashScheme
+//   keys        uint64   hash of the starting position, to detect other Zobrist keys
+//   size        uint32   size of the table in megabytes
+//   buckets     uint64   number of buckets in the table
+//   checksum    uint32   CRC-32 of the entries
+//
+// Followed by the entries of every bucket, each is its key then its data, both
+// as little endian uint64
+
+const hashFileVersion uint16 = 1
+
+var hashFileMagic = [4]byte{'Z', 'H', 'T', 'T'}
+
+const (
+	multiplyShiftScheme uint8 = iota
+	powerOfTwoScheme
+)
+
+type hashFileHeader struct {
+	Magic    [4]byte
+	Version  uint16
+	Scheme   uint8
+	Keys     uint64
+	Size     uint32
+	Buckets  uint64
+	Checksum uint32
+}
+
+func hashScheme(powerOfTwo bool) uint8 {
+	if powerOfTwo {
+		return powerOfTwoScheme
+	}
+	return multiplyShiftScheme
+}
+
+func zobristFingerprint() uint64 {
+	game := FromFen("rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1")
+	return game.Position().Hash()
+}
+
+// Checks that the table was written by this version of the engine
+func (header *hashFileHeader) validate(path string, magic [4]byte) error {
+	if header.Magic != magic {
+		return fmt.Errorf("%s is not a hash file", path)
+	}
+	if header.Version != hashFileVersion {
+		return fmt.Errorf("%s has version %d, expected %d", path, header.Version, hashFileVersion)
+	}
+	if header.Scheme != multiplyShiftScheme && header.Scheme != powerOfTwoScheme {
+		return fmt.Errorf("%s uses an unknown hash scheme %d", path, header.Scheme)
+	}
+	if header.Keys != zobristFingerprint() {
+		return fmt.Errorf("%s was written with different Zobrist keys", path)
+	}
+	if header.Size > MAX_CACHE_SIZE || header.Size < 1 {
+		return fmt.Errorf("%s has an invalid size of %dMB", path, header.Size)
+	}
+	if length, _ := cacheLayout(header.Size, header.Scheme == powerOfTwoScheme); uint64(length) != header.Buckets {
+		return fmt.Errorf("%s has %d buckets, expected %d", path, header.Buckets, length)
+	}
+	return nil
+}
+
+func encodeBucket(bucket *CacheBucket, buffer []byte) {
+	for i, entry := range bucket {
+		binary.LittleEndian.PutUint64(buffer[i*16:], entry.Key)
+		binary.LittleEndian.PutUint64(buffer[i*16+8:], entry.Data)
+	}
+}
+
+func decodeBucket(bucket *CacheBucket, buffer []byte) {
+	for i := range bucket {
+		bucket[i].Key = binary.LittleEndian.Uint64(buffer[i*16:])
+		bucket[i].Data = binary.LittleEndian.Uint64(buffer[i*16+8:])
+	}
+}
+
+func (c *Cache) checksum() uint32 {
+	buffer := make([]byte, CACHE_BUCKET_SIZE)
+	checksum := uint32(0)
+	for i := range c.buckets {
+		encodeBucket(&c.buckets[i], buffer)
+		checksum = crc32.Update(checksum, crc32.IEEETable, buffer)
+	}
+	return checksum
+}
+
+// Writes the table to the file
+func (c *Cache) SaveToFile(path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := bufio.NewWriter(file)
+	header := hashFileHeader{
+		Magic:    hashFileMagic,
+		Version:  hashFileVersion,
+		Scheme:   hashScheme(c.powerOfTwo),
+		Keys:     zobristFingerprint(),
+		Size:     c.size,
+		Buckets:  uint64(len(c.buckets)),
+		Checksum: c.checksum(),
+	}
+	if err := binary.Write(writer, binary.LittleEndian, &header); err != nil {
+		return err
+	}
+	buffer := make([]byte, CACHE_BUCKET_SIZE)
+	for i := range c.buckets {
+		encodeBucket(&c.buckets[i], buffer)
+		if _, err := writer.Write(buffer); err != nil {
+			return err
+		}
+	}
+	return writer.Flush()
+}
+
+// Reads a table that was written by SaveToFile, the file is rejected if it was
+// written with a different format, hashing scheme or Zobrist keys
+func LoadCacheFromFile(path string) (*Cache, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	var header hashFileHeader
+	if err := binary.Read(reader, binary.LittleEndian, &header); err != nil {
+		return nil, fmt.Errorf("%s is not a hash file: %v", path, err)
+	}
+	if err := header.validate(path, hashFileMagic); err != nil {
+		return nil, err
+	}
+	c := NewCacheWithSizing(header.Size, header.Scheme == powerOfTwoScheme)
+
+	buffer := make([]byte, CACHE_BUCKET_SIZE)
+	checksum := uint32(0)
+	for i := range c.buckets {
+		if _, err := io.ReadFull(reader, buffer); err != nil {
+			return nil, fmt.Errorf("%s is corrupted: %v", path, err)
+		}
+		checksum = crc32.Update(checksum, crc32.IEEETable, buffer)
+		decodeBucket(&c.buckets[i], buffer)
+	}
+	if checksum != header.Checksum {
+		return nil, fmt.Errorf("%s is corrupted: checksum mismatch", path)
+	}
+	return c, nil
+}
@@ -0,0 +1,68 @@
+package engine
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSaveAndLoadCache(t *testing.T) {
+	for _, powerOfTwo := range []bool{false, true} {
+		path := filepath.Join(t.TempDir(), "zahak.hash")
+		cache := NewCacheWithSizing(3, powerOfTwo)
+		move := NewMove(E2, E4, WhitePawn, NoPiece, NoType, 0)
+		for i := uint64(1); i < 1000; i++ {
+			cache.Set(i*0x9E3779B97F4A7C15, move, int16(i), int16(-i), int8(i%64), Exact, uint16(i))
+		}
+		if err := cache.SaveToFile(path); err != nil {
+			t.Fatalf("Could not save the cache: %v\n", err)
+		}
+
+		loaded, err := LoadCacheFromFile(path)
+		if err != nil {
+			t.Fatalf("Could not load the cache: %v\n", err)
+		}
+		if loaded.Size() != cache.Size() || loaded.PowerOfTwo() != powerOfTwo || len(loaded.buckets) != len(cache.buckets) {
+			t.Errorf("Unexpected table: %dMB, %t, %d buckets\n", loaded.Size(), loaded.PowerOfTwo(), len(loaded.buckets))
+		}
+		for i := range cache.buckets {
+			if loaded.buckets[i] != cache.buckets[i] {
+				t.Fatalf("Bucket %d differs after loading\n", i)
+			}
+		}
+	}
+}
+
+func TestLoadCacheValidation(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "zahak.hash")
+	cache := NewCache(1)
+	cache.Set(0x123456789ABCDEF, EmptyMove, 10, 20, 5, Exact, 1)
+	if err := cache.SaveToFile(path); err != nil {
+		t.Fatalf("Could not save the cache: %v\n", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Could not read the cache: %v\n", err)
+	}
+
+	corruptions := map[string]func([]byte) []byte{
+		"magic":     func(d []byte) []byte { d[0] = 'X'; return d },
+		"version":   func(d []byte) []byte { d[4] += 1; return d },
+		"scheme":    func(d []byte) []byte { d[6] = 7; return d },
+		"keys":      func(d []byte) []byte { d[7] ^= 1; return d },
+		"buckets":   func(d []byte) []byte { d[19] ^= 1; return d },
+		"entries":   func(d []byte) []byte { d[len(d)-1] ^= 1; return d },
+		"truncated": func(d []byte) []byte { return d[:len(d)-10] },
+	}
+	for name, corrupt := range corruptions {
+		corrupted := corrupt(append([]byte{}, data...))
+		corruptedPath := filepath.Join(dir, name+".hash")
+		if err := os.WriteFile(corruptedPath, corrupted, 0644); err != nil {
+			t.Fatalf("Could not write the cache: %v\n", err)
+		}
+		if _, err := LoadCacheFromFile(corruptedPath); err == nil {
+			t.Errorf("Expected an error when the %s is corrupted\n", name)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+//go:build linux || darwin || freebsd
+// +build linux darwin freebsd
+
+package engine
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// A shared table lives in a memory mapped file, that several zahak processes
+// on the same machine can attach to. The first process creates the file, and
+// decides the size of the table. The file starts with the same header as
+// the files written by SaveToFile (with a different magic, and no checksum),
+// and the buckets start at the next page. Entries are written without locks,
+// a torn write leaves a key that does not match its data, and Get ignores it.
+
+const sharedHeaderSize = 4096
+
+// The largest number of buckets a table can have, only used to view the
+// mapped memory as buckets
+const maxBuckets = uint64(MAX_CACHE_SIZE) * 1024 * 1024 / uint64(CACHE_BUCKET_SIZE)
+
+var sharedCacheMagic = [4]byte{'Z', 'H', 'S', 'M'}
+
+// Attaches to the shared table in the file. The file is created with the given
+// size and sizing if it does not exist, otherwise the table keeps the size and
+// sizing it was created with
+func NewSharedCache(path string, megabytes uint32, powerOfTwo bool) (*Cache, error) {
+	if megabytes > MAX_CACHE_SIZE || megabytes < 1 {
+		return nil, fmt.Errorf("invalid size of %dMB", megabytes)
+	}
+
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	// Only one process initializes the file
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX); err != nil {
+		return nil, err
+	}
+	defer syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	var header hashFileHeader
+	if info.Size() == 0 {
+		length, _ := cacheLayout(megabytes, powerOfTwo)
+		header = hashFileHeader{
+			Magic:   sharedCacheMagic,
+			Version: hashFileVersion,
+			Scheme:  hashScheme(powerOfTwo),
+			Keys:    zobristFingerprint(),
+			Size:    megabytes,
+			Buckets: uint64(length),
+		}
+		var buffer bytes.Buffer
+		if err := binary.Write(&buffer, binary.LittleEndian, &header); err != nil {
+			return nil, err
+		}
+		if err := file.Truncate(sharedFileSize(header.Buckets)); err != nil {
+			return nil, err
+		}
+		if _, err := file.WriteAt(buffer.Bytes(), 0); err != nil {
+			return nil, err
+		}
+	} else {
+		if err := binary.Read(file, binary.LittleEndian, &header); err != nil {
+			return nil, fmt.Errorf("%s is not a shared hash file: %v", path, err)
+		}
+		if err := header.validate(path, sharedCacheMagic); err != nil {
+			return nil, err
+		}
+		if info.Size() != sharedFileSize(header.Buckets) {
+			return nil, fmt.Errorf("%s has %d bytes, expected %d", path, info.Size(), sharedFileSize(header.Buckets))
+		}
+		megabytes = header.Size
+		powerOfTwo = header.Scheme == powerOfTwoScheme
+	}
+
+	length, shift := cacheLayout(megabytes, powerOfTwo)
+	mapping, err := syscall.Mmap(int(file.Fd()), 0, int(sharedFileSize(uint64(length))), syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, err
+	}
+	buckets := (*[maxBuckets]CacheBucket)(unsafe.Pointer(&mapping[sharedHeaderSize]))[:length:length]
+	return &Cache{buckets, megabytes, powerOfTwo, shift, mapping, newBusyTable()}, nil
+}
+
+func sharedFileSize(buckets uint64) int64 {
+	return int64(sharedHeaderSize) + int64(buckets)*int64(CACHE_BUCKET_SIZE)
+}
+
+// Releases the memory of a shared table, the table cannot be used afterwards
+func (c *Cache) Close() error {
+	if c.mapping == nil {
+		return nil
+	}
+	mapping := c.mapping
+	c.mapping = nil
+	c.buckets = nil
+	return syscall.Munmap(mapping)
+}
@@ -0,0 +1,17 @@
+//go:build !linux && !darwin && !freebsd
+// +build !linux,!darwin,!freebsd
+
+package engine
+
+import (
+	"errors"
+)
+
+// Shared tables need memory mapped files, which are only supported on unix
+func NewSharedCache(path string, megabytes uint32, powerOfTwo bool) (*Cache, error) {
+	return nil, errors.New("shared hash tables are not supported on this platform")
+}
+
+func (c *Cache) Close() error {
+	return nil
+}
@@ -0,0 +1,42 @@
+//go:build linux || darwin || freebsd
+// +build linux darwin freebsd
+
+package engine
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestSharedCache(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "zahak.shared")
+	first, err := NewSharedCache(path, 2, false)
+	if err != nil {
+		t.Fatalf("Could not create the shared cache: %v\n", err)
+	}
+	defer first.Close()
+	// The size of the existing table wins
+	second, err := NewSharedCache(path, 4, true)
+	if err != nil {
+		t.Fatalf("Could not attach to the shared cache: %v\n", err)
+	}
+	defer second.Close()
+	if second.Size() != 2 || second.PowerOfTwo() || len(second.buckets) != len(first.buckets) {
+		t.Errorf("Unexpected table: %dMB, %t, %d buckets\n", second.Size(), second.PowerOfTwo(), len(second.buckets))
+	}
+
+	move := NewMove(E2, E4, WhitePawn, NoPiece, NoType, 0)
+	hash := uint64(0x123456789ABCDEF0)
+	first.Set(hash, move, 33, 12, 9, LowerBound, 4)
+	hashmove, eval, staticEval, depth, nodeType, ok := second.Get(hash)
+	if !ok || hashmove != move.Compact() || eval != 33 || staticEval != 12 || depth != 9 || nodeType != LowerBound {
+		t.Errorf("Unexpected entry: %d %d %d %d %d %t\n", hashmove, eval, staticEval, depth, nodeType, ok)
+	}
+
+	// A torn write leaves a key that does not match its data
+	bucket := &first.buckets[first.index(hash)]
+	bucket[0].Data ^= 1
+	if _, _, _, _, _, ok := second.Get(hash); ok {
+		t.Errorf("Expected a torn entry to be ignored\n")
+	}
+}
@@ -0,0 +1,73 @@
+package engine
+
+// Counters of how a search used the transposition table
+type CacheCounters struct {
+	Probes     int64
+	Hits       int64
+	Writes     int64
+	Overwrites int64 // Writes that evicted another position
+}
+
+// The contents of an entry of the table
+type CacheEntry struct {
+	Move       CompactMove
+	Eval       int16
+	StaticEval int16
+	Depth      int8
+	Type       NodeType
+	Age        uint16
+}
+
+func unpackEntry(data uint64) CacheEntry {
+	move, eval, staticEval, depth, nodeType, age := Unpack(data)
+	return CacheEntry{move, eval, staticEval, depth, nodeType, age}
+}
+
+// Returns the entry of the position with the given hash
+func (c *Cache) Lookup(hash uint64) (CacheEntry, bool) {
+	bucket := &c.buckets[c.index(hash)]
+	for i := 0; i < BUCKET_ENTRIES; i++ {
+		data := bucket[i].Data
+		if data != 0 && hash == (bucket[i].Key^data) {
+			return unpackEntry(data), true
+		}
+	}
+	return CacheEntry{}, false
+}
+
+// A summary of the contents of the table
+type CacheStats struct {
+	Entries int
+	Used    int
+	Depths  [DEPTH_MASK + 1]int
+	Exact   int
+	Upper   int
+	Lower   int
+	Ages    [AGE_MASK + 1]int
+}
+
+// Goes through all the entries of the table
+func (c *Cache) Stats() CacheStats {
+	var stats CacheStats
+	stats.Entries = len(c.buckets) * BUCKET_ENTRIES
+	for i := range c.buckets {
+		for _, item := range c.buckets[i] {
+			if item.Data == 0 {
+				continue
+			}
+			entry := unpackEntry(item.Data)
+			stats.Used += 1
+			stats.Depths[entry.Depth] += 1
+			stats.Ages[entry.Age] += 1
+			switch entry.Type {
+			case Exact:
+				stats.Exact += 1
+			case UpperBound:
+				stats.Upper += 1
+			case LowerBound:
+				stats.Lower += 1
+			}
+		}
+	}
+	return stats
+}
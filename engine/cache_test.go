@@ -6,13 +6,14 @@ import (
 )
 
 func TestUnpackPackFunctions(t *testing.T) {
-	expectedMove := Move(MOVE_MASK)
+	expectedMove := CompactMove(MOVE_MASK)
 	expectedEval := MAX_INT
+	expectedStaticEval := -MAX_INT
 	expectedDepth := int8(127)
 	expectedType := LowerBound
-	expectedAge := uint16(1023)
-	data := Pack(expectedMove, expectedEval, expectedDepth, expectedType, expectedAge)
-	actualMove, actualEval, actualDepth, actualType, actualAge := Unpack(data)
+	expectedAge := uint16(63)
+	data := Pack(expectedMove, expectedEval, expectedStaticEval, expectedDepth, expectedType, expectedAge)
+	actualMove, actualEval, actualStaticEval, actualDepth, actualType, actualAge := Unpack(data)
 
 	if actualMove != expectedMove {
 		t.Errorf("Unexpected move: %s", fmt.Sprintf("Expected: %d, Got %d\n", expectedMove, actualMove))
@@ -22,6 +23,10 @@ func TestUnpackPackFunctions(t *testing.T) {
 		t.Errorf("Unexpected eval: %s", fmt.Sprintf("Expected: %d, Got %d\n", expectedEval, actualEval))
 	}
 
+	if actualStaticEval != expectedStaticEval {
+		t.Errorf("Unexpected static eval: %s", fmt.Sprintf("Expected: %d, Got %d\n", expectedStaticEval, actualStaticEval))
+	}
+
 	if actualDepth != expectedDepth {
 		t.Errorf("Unexpected depth: %s", fmt.Sprintf("Expected: %d, Got %d\n", expectedDepth, actualDepth))
 	}
@@ -34,13 +39,14 @@ func TestUnpackPackFunctions(t *testing.T) {
 		t.Errorf("Unexpected age: %s", fmt.Sprintf("Expected: %d, Got %d\n", expectedAge, actualAge))
 	}
 
-	expectedMove = NewMove(E1, E2, WhiteKing, BlackKing, Queen, KingSideCastle|QueenSideCastle|Capture|EnPassant)
+	expectedMove = NewMove(E7, E8, WhitePawn, BlackKing, Queen, Capture).Compact()
 	expectedEval = int16(0)
+	expectedStaticEval = int16(-31)
 	expectedDepth = int8(50)
 	expectedType = Exact
-	expectedAge = uint16(512)
-	data = Pack(expectedMove, expectedEval, expectedDepth, expectedType, expectedAge)
-	actualMove, actualEval, actualDepth, actualType, actualAge = Unpack(data)
+	expectedAge = uint16(32)
+	data = Pack(expectedMove, expectedEval, expectedStaticEval, expectedDepth, expectedType, expectedAge)
+	actualMove, actualEval, actualStaticEval, actualDepth, actualType, actualAge = Unpack(data)
 
 	if actualMove != expectedMove {
 		t.Errorf("Unexpected move: %s", fmt.Sprintf("Expected: %d, Got %d\n", expectedMove, actualMove))
@@ -50,6 +56,10 @@ func TestUnpackPackFunctions(t *testing.T) {
 		t.Errorf("Unexpected eval: %s", fmt.Sprintf("Expected: %d, Got %d\n", expectedEval, actualEval))
 	}
 
+	if actualStaticEval != expectedStaticEval {
+		t.Errorf("Unexpected static eval: %s", fmt.Sprintf("Expected: %d, Got %d\n", expectedStaticEval, actualStaticEval))
+	}
+
 	if actualDepth != expectedDepth {
 		t.Errorf("Unexpected depth: %s", fmt.Sprintf("Expected: %d, Got %d\n", expectedDepth, actualDepth))
 	}
@@ -62,14 +72,15 @@ func TestUnpackPackFunctions(t *testing.T) {
 		t.Errorf("Unexpected age: %s", fmt.Sprintf("Expected: %d, Got %d\n", expectedAge, actualAge))
 	}
 
-	expectedMove = Move(0b1111111111111111111111111111)
+	expectedMove = CompactMove(0b1111111111111111)
 	expectedEval = int16(0b0111111111111111)
+	expectedStaticEval = int16(0b0111111111111111)
 	expectedDepth = int8(0b1111111)
 	expectedType = NodeType(0b111)
-	expectedAge = uint16(0b1111111111)
+	expectedAge = uint16(0b111111)
 
-	data = Pack(expectedMove, expectedEval, expectedDepth, expectedType, expectedAge)
-	actualMove, actualEval, actualDepth, actualType, actualAge = Unpack(data)
+	data = Pack(expectedMove, expectedEval, expectedStaticEval, expectedDepth, expectedType, expectedAge)
+	actualMove, actualEval, actualStaticEval, actualDepth, actualType, actualAge = Unpack(data)
 
 	if actualMove != expectedMove {
 		t.Errorf("Unexpected move: %s", fmt.Sprintf("Expected: %d, Got %d\n", expectedMove, actualMove))
@@ -79,6 +90,10 @@ func TestUnpackPackFunctions(t *testing.T) {
 		t.Errorf("Unexpected eval: %s", fmt.Sprintf("Expected: %d, Got %d\n", expectedEval, actualEval))
 	}
 
+	if actualStaticEval != expectedStaticEval {
+		t.Errorf("Unexpected static eval: %s", fmt.Sprintf("Expected: %d, Got %d\n", expectedStaticEval, actualStaticEval))
+	}
+
 	if actualDepth != expectedDepth {
 		t.Errorf("Unexpected depth: %s", fmt.Sprintf("Expected: %d, Got %d\n", expectedDepth, actualDepth))
 	}
@@ -91,14 +106,15 @@ func TestUnpackPackFunctions(t *testing.T) {
 		t.Errorf("Unexpected age: %s", fmt.Sprintf("Expected: %d, Got %d\n", expectedAge, actualAge))
 	}
 
-	expectedMove = Move(31028)
+	expectedMove = CompactMove(31028)
 	expectedEval = int16(-5)
+	expectedStaticEval = int16(12)
 	expectedDepth = int8(1)
 	expectedType = NodeType(1)
 	expectedAge = uint16(1)
 
-	data = Pack(expectedMove, expectedEval, expectedDepth, expectedType, expectedAge)
-	actualMove, actualEval, actualDepth, actualType, actualAge = Unpack(data)
+	data = Pack(expectedMove, expectedEval, expectedStaticEval, expectedDepth, expectedType, expectedAge)
+	actualMove, actualEval, actualStaticEval, actualDepth, actualType, actualAge = Unpack(data)
 
 	if actualMove != expectedMove {
 		t.Errorf("Unexpected move: %s", fmt.Sprintf("Expected: %d, Got %d\n", expectedMove, actualMove))
@@ -108,6 +124,10 @@ func TestUnpackPackFunctions(t *testing.T) {
 		t.Errorf("Unexpected eval: %s", fmt.Sprintf("Expected: %d, Got %d\n", expectedEval, actualEval))
 	}
 
+	if actualStaticEval != expectedStaticEval {
+		t.Errorf("Unexpected static eval: %s", fmt.Sprintf("Expected: %d, Got %d\n", expectedStaticEval, actualStaticEval))
+	}
+
 	if actualDepth != expectedDepth {
 		t.Errorf("Unexpected depth: %s", fmt.Sprintf("Expected: %d, Got %d\n", expectedDepth, actualDepth))
 	}
@@ -120,3 +140,236 @@ func TestUnpackPackFunctions(t *testing.T) {
 		t.Errorf("Unexpected age: %s", fmt.Sprintf("Expected: %d, Got %d\n", expectedAge, actualAge))
 	}
 }
+
+func TestCompactMove(t *testing.T) {
+	game := FromFen("r3k2r/1P6/8/3pP3/8/8/8/R3K2R w KQkq d6 0 1")
+	pos := game.Position()
+	moves := pos.PseudoLegalMoves()
+	for _, move := range moves {
+		actual := pos.MoveFromCompact(move.Compact())
+		if actual != move {
+			t.Errorf("Expected: %s, Got %s\n", move.ToString(), actual.ToString())
+		}
+	}
+
+	// Black pieces cannot be moved, and white pieces cannot be captured
+	for _, move := range []Move{NewMove(E8, E7, BlackKing, NoPiece, NoType, 0), NewMove(A1, E1, WhiteRook, NoPiece, NoType, 0)} {
+		if actual := pos.MoveFromCompact(move.Compact()); actual != EmptyMove {
+			t.Errorf("Expected an empty move, Got %s\n", actual.ToString())
+		}
+	}
+}
+
+// Hashes that land in the same bucket, as only the upper half of the hash is
+// used to pick the bucket
+func sameBucketHashes(n int) []uint64 {
+	hashes := make([]uint64, n)
+	for i := 0; i < n; i++ {
+		hashes[i] = uint64(0x12345678)<<32 | uint64(i+1)
+	}
+	return hashes
+}
+
+func TestCacheBucketReplacement(t *testing.T) {
+	cache := NewCache(1)
+	hashes := sameBucketHashes(BUCKET_ENTRIES + 1)
+	move := NewMove(E2, E4, WhitePawn, NoPiece, NoType, 0)
+
+	// Fill the bucket, the third entry is the shallowest one
+	for i, hash := range hashes[:BUCKET_ENTRIES] {
+		depth := int8(10 + i)
+		if i == 2 {
+			depth = 1
+		}
+		cache.Set(hash, move, int16(i), 0, depth, Exact, 3)
+	}
+	cache.Set(hashes[BUCKET_ENTRIES], move, 100, 0, 5, Exact, 3)
+	for i, hash := range hashes {
+		_, eval, _, _, _, ok := cache.Get(hash)
+		if i == 2 && ok {
+			t.Errorf("Expected the shallowest entry to be replaced\n")
+		} else if i != 2 && !ok {
+			t.Errorf("Expected entry %d to be in the table\n", i)
+		} else if i == BUCKET_ENTRIES && eval != 100 {
+			t.Errorf("Unexpected eval: Expected: 100, Got %d\n", eval)
+		}
+	}
+
+	// Old entries are replaced before deeper ones of the current generation
+	cache = NewCache(1)
+	for i, hash := range hashes[:BUCKET_ENTRIES] {
+		age := uint16(20)
+		if i == 1 {
+			age = 10
+		}
+		cache.Set(hash, move, int16(i), 0, 15, LowerBound, age)
+	}
+	cache.Set(hashes[BUCKET_ENTRIES], move, 100, 0, 5, Exact, 20)
+	if _, _, _, _, _, ok := cache.Get(hashes[1]); ok {
+		t.Errorf("Expected the oldest entry to be replaced\n")
+	}
+
+	// The same position replaces its own entry, when it is not much shallower
+	cache.Set(hashes[0], move, 42, 7, 12, UpperBound, 20)
+	_, eval, staticEval, depth, nodeType, ok := cache.Get(hashes[0])
+	if !ok || eval != 42 || staticEval != 7 || depth != 12 || nodeType != UpperBound {
+		t.Errorf("Unexpected entry: %d %d %d %d %t\n", eval, staticEval, depth, nodeType, ok)
+	}
+}
+
+func TestSamePositionReplacement(t *testing.T) {
+	cache := NewCache(1)
+	hash := uint64(0x123456789ABCDEF)
+	move := NewMove(E2, E4, WhitePawn, NoPiece, NoType, 0)
+	other := NewMove(D2, D4, WhitePawn, NoPiece, NoType, 0)
+
+	// A much shallower bound keeps the deeper entry
+	cache.Set(hash, move, 10, 0, 12, LowerBound, 5)
+	cache.Set(hash, other, 20, 0, 2, UpperBound, 5)
+	hashmove, eval, _, depth, _, _ := cache.Get(hash)
+	if hashmove != move.Compact() || eval != 10 || depth != 12 {
+		t.Errorf("Expected the deeper entry to stay, got %d %d %d\n", hashmove, eval, depth)
+	}
+
+	// An exact score always replaces, and keeps the move when it has none
+	cache.Set(hash, EmptyMove, 30, 0, 2, Exact, 5)
+	hashmove, eval, _, depth, _, _ = cache.Get(hash)
+	if hashmove != move.Compact() || eval != 30 || depth != 2 {
+		t.Errorf("Expected the exact entry with the old move, got %d %d %d\n", hashmove, eval, depth)
+	}
+
+	// An old entry is replaced by a shallower one of the current search
+	cache.Set(hash, move, 10, 0, 12, LowerBound, 5)
+	cache.Set(hash, other, 40, 0, 5, UpperBound, 7)
+	hashmove, eval, _, depth, _, _ = cache.Get(hash)
+	if hashmove != other.Compact() || eval != 40 || depth != 5 {
+		t.Errorf("Expected the entry of the current search, got %d %d %d\n", hashmove, eval, depth)
+	}
+
+	// A bound that is deep enough replaces the entry, and keeps the move when
+	// it has none
+	cache.Set(hash, EmptyMove, 50, 0, 3, LowerBound, 7)
+	hashmove, eval, _, depth, _, _ = cache.Get(hash)
+	if hashmove != other.Compact() || eval != 50 || depth != 3 {
+		t.Errorf("Expected the new entry with the old move, got %d %d %d\n", hashmove, eval, depth)
+	}
+}
+
+func TestHashfull(t *testing.T) {
+	for _, powerOfTwo := range []bool{false, true} {
+		cache := NewCacheWithSizing(1, powerOfTwo)
+		if hashfull := cache.Hashfull(1); hashfull != 0 {
+			t.Errorf("Expected an empty table, Got %d\n", hashfull)
+		}
+		for i := range cache.buckets[:HASHFULL_SAMPLE] {
+			for j := 0; j < BUCKET_ENTRIES; j++ {
+				age := uint16(1)
+				if j%2 == 0 {
+					age = 0
+				}
+				cache.buckets[i][j].Data = Pack(EmptyCompactMove, 0, 0, 1, Exact, age)
+			}
+		}
+		if hashfull := cache.Hashfull(1); hashfull != 500 {
+			t.Errorf("Expected half of the table to be of the current generation, Got %d\n", hashfull)
+		}
+	}
+}
+
+func TestPowerOfTwoCache(t *testing.T) {
+	cache := NewCacheWithSizing(3, true)
+	if len(cache.buckets) != 32768 {
+		t.Errorf("Unexpected number of buckets: Expected 32768, Got %d\n", len(cache.buckets))
+	}
+	cache = NewCacheWithSizing(3, false)
+	if len(cache.buckets) != 49152 {
+		t.Errorf("Unexpected number of buckets: Expected 49152, Got %d\n", len(cache.buckets))
+	}
+	for _, powerOfTwo := range []bool{false, true} {
+		cache = NewCacheWithSizing(3, powerOfTwo)
+		for _, hash := range []uint64{0, 1, 0xFFFFFFFFFFFFFFFF, 0x8000000000000000, 0x123456789ABCDEF} {
+			if index := cache.index(hash); index >= uint64(len(cache.buckets)) {
+				t.Errorf("Index %d is out of bounds for %d\n", index, hash)
+			}
+		}
+	}
+}
+
+func TestCacheStats(t *testing.T) {
+	cache := NewCache(1)
+	hashes := sameBucketHashes(BUCKET_ENTRIES + 1)
+	move := NewMove(E2, E4, WhitePawn, NoPiece, NoType, 0)
+
+	if stats := cache.Stats(); stats.Used != 0 || stats.Entries != len(cache.buckets)*BUCKET_ENTRIES {
+		t.Errorf("Unexpected stats of an empty table: %d/%d\n", stats.Used, stats.Entries)
+	}
+	if _, ok := cache.Lookup(hashes[0]); ok {
+		t.Errorf("Expected an empty table\n")
+	}
+
+	types := []NodeType{Exact, UpperBound, LowerBound, LowerBound}
+	for i, hash := range hashes[:BUCKET_ENTRIES] {
+		if evicted := cache.Set(hash, move, int16(i), 0, int8(i+1), types[i], uint16(i%2)); evicted {
+			t.Errorf("Expected entry %d to go to an empty slot\n", i)
+		}
+	}
+	if evicted := cache.Set(hashes[0], move, 10, 0, 5, Exact, 1); evicted {
+		t.Errorf("Expected the same position to replace its own entry\n")
+	}
+	if evicted := cache.Set(hashes[BUCKET_ENTRIES], move, 10, 0, 8, Exact, 1); !evicted {
+		t.Errorf("Expected another position to be evicted\n")
+	}
+
+	stats := cache.Stats()
+	if stats.Used != BUCKET_ENTRIES {
+		t.Errorf("Unexpected used entries: Expected %d, Got %d\n", BUCKET_ENTRIES, stats.Used)
+	}
+	if stats.Exact+stats.Upper+stats.Lower != stats.Used {
+		t.Errorf("Unexpected node types: %d %d %d\n", stats.Exact, stats.Upper, stats.Lower)
+	}
+	depths, ages := 0, 0
+	for _, count := range stats.Depths {
+		depths += count
+	}
+	for _, count := range stats.Ages {
+		ages += count
+	}
+	if depths != stats.Used || ages != stats.Used {
+		t.Errorf("Unexpected histograms: %d %d\n", depths, ages)
+	}
+
+	entry, ok := cache.Lookup(hashes[BUCKET_ENTRIES])
+	if !ok || entry.Move != move.Compact() || entry.Eval != 10 || entry.Depth != 8 || entry.Type != Exact || entry.Age != 1 {
+		t.Errorf("Unexpected entry: %v %t\n", entry, ok)
+	}
+}
+
+func TestBusyPositions(t *testing.T) {
+	cache := NewCache(1)
+	hashes := []uint64{}
+	for i := uint64(1); i <= BUSY_WAYS+1; i++ {
+		hashes = append(hashes, i*BUSY_SLOTS+7) // All in the same slot
+	}
+	for _, hash := range hashes[:BUSY_WAYS] {
+		cache.MarkBusy(hash)
+	}
+	for _, hash := range hashes[:BUSY_WAYS] {
+		if !cache.IsBusy(hash) {
+			t.Errorf("Expected %d to be busy\n", hash)
+		}
+	}
+	if cache.IsBusy(hashes[BUSY_WAYS]) {
+		t.Errorf("Expected %d not to be busy\n", hashes[BUSY_WAYS])
+	}
+
+	// A full slot replaces its first way
+	cache.MarkBusy(hashes[BUSY_WAYS])
+	if !cache.IsBusy(hashes[BUSY_WAYS]) || cache.IsBusy(hashes[0]) {
+		t.Errorf("Expected the first way to be replaced\n")
+	}
+
+	cache.ClearBusy(hashes[1])
+	if cache.IsBusy(hashes[1]) || !cache.IsBusy(hashes[2]) {
+		t.Errorf("Expected only %d to be cleared\n", hashes[1])
+	}
+}
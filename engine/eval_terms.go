@@ -191,6 +191,43 @@ var MiddlegameKnightOutpostAward int16 = 17
 var EndgameKnightOutpostAward int16 = 23
 var MiddlegameBishopPairAward int16 = 28
 var EndgameBishopPairAward int16 = 44
+var KnightKingAttackWeight int16 = 4
+var BishopKingAttackWeight int16 = 3
+var RookKingAttackWeight int16 = 4
+var QueenKingAttackWeight int16 = 6
+var InnerRingAttackWeight int16 = 3
+var OuterRingAttackWeight int16 = 1
+var KnightSafeCheckWeight int16 = 8
+var BishopSafeCheckWeight int16 = 6
+var RookSafeCheckWeight int16 = 9
+var QueenSafeCheckWeight int16 = 7
+var KingOpenFileWeight int16 = 3
+var KingSemiOpenFileWeight int16 = 2
+var MiddlegameKingAttackScale int16 = 32
+var EndgameKingAttackScale int16 = 4
+var MiddlegamePawnThreatAward int16 = 40
+var EndgamePawnThreatAward int16 = 30
+var MiddlegameMinorThreatAward int16 = 25
+var EndgameMinorThreatAward int16 = 20
+var MiddlegameHangingPieceAward int16 = 15
+var EndgameHangingPieceAward int16 = 10
+var MiddlegamePawnPushThreatAward int16 = 12
+var EndgamePawnPushThreatAward int16 = 8
+var EndgameOwnKingPassedPawnDistancePenalty int16 = 4
+var EndgameEnemyKingPassedPawnDistanceAward int16 = 8
+var MiddlegameFreePassedPawnAward int16 = 4
+var EndgameFreePassedPawnAward int16 = 10
+var MiddlegameSafePassedPawnAward int16 = 3
+var EndgameSafePassedPawnAward int16 = 8
+var MiddlegameBlockadedPassedPawnPenalty int16 = 5
+var EndgameBlockadedPassedPawnPenalty int16 = 15
+var EndgameUnstoppablePassedPawnAward int16 = 250
+var MiddlegameRookRedundancyPenalty int16 = 10
+var EndgameRookRedundancyPenalty int16 = 16
+var MiddlegameQueenRookRedundancyPenalty int16 = 6
+var EndgameQueenRookRedundancyPenalty int16 = 10
+var MiddlegameUncontestedBishopPairAward int16 = 8
+var EndgameUncontestedBishopPairAward int16 = 12
 
 var Flip = [64]int16{
 	56, 57, 58, 59, 60, 61, 62, 63,
@@ -110,47 +110,101 @@ func (b *Bitboard) IsVerticalDoubleRook(sq Square, otherRooks uint64, occupied u
 }
 
 func (b *Bitboard) AllAttacks(color Color) (uint64, uint64, uint64) {
-	var ownPawns, ownKnights, ownR, ownB, ownQ, ownKing, ownPieces uint64
-	occupiedBB := b.whitePieces | b.blackPieces
-	if color == Black {
-		ownPieces = b.blackPieces
-		ownPawns = bPawnAnyAttacks(b.blackPawn)
-		ownKnights = b.blackKnight
-		ownR = b.blackRook
-		ownB = b.blackBishop
-		ownQ = b.blackQueen
-		ownKing = b.blackKing
+	attacks := b.AttackMapsOf(color)
+	return attacks.Groups()
+}
+
+// Attack maps of every piece type of a side, including the squares of its own
+// pieces, i.e. the squares it defends. They are computed in a single pass over
+// the pieces, and shared by all the evaluation terms that need attacks
+type AttackMaps struct {
+	Pawn   uint64
+	Knight uint64
+	Bishop uint64
+	Rook   uint64
+	Queen  uint64
+	King   uint64
+
+	KnightAttackers int16 // Number of knights that attack the zone of the enemy king
+	BishopAttackers int16
+	RookAttackers   int16
+	QueenAttackers  int16
+
+	own uint64
+}
+
+func (b *Bitboard) AttackMapsOf(color Color) AttackMaps {
+	var attacks AttackMaps
+	var knights, bishops, rooks, queens, enemyKing uint64
+	occupied := b.whitePieces | b.blackPieces
+	if color == White {
+		attacks.Pawn = wPawnAnyAttacks(b.whitePawn)
+		attacks.King = kingAttacks(b.whiteKing)
+		attacks.own = b.whitePieces
+		knights, bishops, rooks, queens, enemyKing = b.whiteKnight, b.whiteBishop, b.whiteRook, b.whiteQueen, b.blackKing
 	} else {
-		ownPieces = b.whitePieces
-		ownPawns = wPawnAnyAttacks(b.whitePawn)
-		ownKnights = b.whiteKnight
-		ownR = b.whiteRook
-		ownB = b.whiteBishop
-		ownQ = b.whiteQueen
-		ownKing = b.whiteKing
+		attacks.Pawn = bPawnAnyAttacks(b.blackPawn)
+		attacks.King = kingAttacks(b.blackKing)
+		attacks.own = b.blackPieces
+		knights, bishops, rooks, queens, enemyKing = b.blackKnight, b.blackBishop, b.blackRook, b.blackQueen, b.whiteKing
 	}
-	pawnAttacks := ownPawns
-	minorAttacks := (knightAttacks(ownKnights))
-	otherAttacks := kingAttacks(ownKing)
-	for ownB != 0 {
-		sq := bitScanForward(ownB)
-		minorAttacks |= bishopAttacks(Square(sq), occupiedBB, ownPieces)
-		ownB ^= (1 << sq)
+	var targets uint64
+	if enemyKing != 0 {
+		kingSq := bitScanForward(enemyKing)
+		targets = (SquareInnerRingMask[kingSq] | SquareOuterRingMask[kingSq]) &^ attacks.own
 	}
 
-	for ownR != 0 {
-		sq := bitScanForward(ownR)
-		otherAttacks |= rookAttacks(Square(sq), occupiedBB, ownPieces)
-		ownR ^= (1 << sq)
+	for knights != 0 {
+		sq := bitScanForward(knights)
+		a := computedKnightAttacks[sq]
+		if a&targets != 0 {
+			attacks.KnightAttackers += 1
+		}
+		attacks.Knight |= a
+		knights ^= (1 << sq)
 	}
 
-	for ownQ != 0 {
-		sq := bitScanForward(ownQ)
-		otherAttacks |= queenAttacks(Square(sq), occupiedBB, ownPieces)
-		ownQ ^= (1 << sq)
+	for bishops != 0 {
+		sq := bitScanForward(bishops)
+		a := bishopAttacks(Square(sq), occupied, empty)
+		if a&targets != 0 {
+			attacks.BishopAttackers += 1
+		}
+		attacks.Bishop |= a
+		bishops ^= (1 << sq)
+	}
+
+	for rooks != 0 {
+		sq := bitScanForward(rooks)
+		a := rookAttacks(Square(sq), occupied, empty)
+		if a&targets != 0 {
+			attacks.RookAttackers += 1
+		}
+		attacks.Rook |= a
+		rooks ^= (1 << sq)
 	}
 
-	return pawnAttacks, minorAttacks, otherAttacks
+	for queens != 0 {
+		sq := bitScanForward(queens)
+		a := queenAttacks(Square(sq), occupied, empty)
+		if a&targets != 0 {
+			attacks.QueenAttackers += 1
+		}
+		attacks.Queen |= a
+		queens ^= (1 << sq)
+	}
+	return attacks
+}
+
+// All the squares the side attacks or defends
+func (a *AttackMaps) All() uint64 {
+	return a.Pawn | a.Knight | a.Bishop | a.Rook | a.Queen | a.King
+}
+
+// The pawn, minor and other attacks of the side, as used by mobility. The
+// squares of own pieces are only counted for pawns, knights and the king
+func (a *AttackMaps) Groups() (uint64, uint64, uint64) {
+	return a.Pawn, a.Knight | a.Bishop&^a.own, a.King | (a.Rook|a.Queen)&^a.own
 }
 
 func QueenAttacks(sq Square, occ uint64, own uint64) uint64 {
@@ -526,3 +580,260 @@ func bPassedKnights(bpawns uint64, wpawns uint64) uint64 {
 func FileFill(fset uint64) uint64 {
 	return nortFill(fset) | soutFill(fset)
 }
+
+// King attacks
+
+// Information about the attack of a side on the king of the other side, used by the
+// attack-unit model of king safety
+type KingAttackInfo struct {
+	KnightAttackers  int16 // Number of knights that attack the king zone
+	BishopAttackers  int16
+	RookAttackers    int16
+	QueenAttackers   int16
+	InnerRingAttacks int16 // Number of attacked squares in the inner ring of the king zone
+	OuterRingAttacks int16 // Number of attacked squares in the outer ring of the king zone
+	KnightSafeChecks int16 // Number of squares a knight can safely check the king from
+	BishopSafeChecks int16
+	RookSafeChecks   int16
+	QueenSafeChecks  int16
+	OpenFiles        int16 // Files on and next to the king that have no pawns
+	SemiOpenFiles    int16 // Files on and next to the king that have only pawns of the attacker
+}
+
+func (k *KingAttackInfo) Attackers() int16 {
+	return k.KnightAttackers + k.BishopAttackers + k.RookAttackers + k.QueenAttackers
+}
+
+// Returns the attacks of white on the black king, and the attacks of black on the white king
+func (b *Bitboard) KingAttacks(white *AttackMaps, black *AttackMaps) (KingAttackInfo, KingAttackInfo) {
+	occupied := b.whitePieces | b.blackPieces
+	blackKingSq := Square(bitScanForward(b.blackKing))
+	whiteKingSq := Square(bitScanForward(b.whiteKing))
+
+	whiteInfo := kingAttackers(white, blackKingSq)
+	blackInfo := kingAttackers(black, whiteKingSq)
+
+	// A check that captures a defended piece is not safe either, so the checking
+	// squares are masked with everything the defender attacks or defends
+	b.safeChecks(&whiteInfo, white, black.All(), blackKingSq, occupied, b.whitePieces)
+	b.safeChecks(&blackInfo, black, white.All(), whiteKingSq, occupied, b.blackPieces)
+
+	whiteInfo.OpenFiles, whiteInfo.SemiOpenFiles = openFilesNearKing(blackKingSq, b.blackPawn, b.whitePawn)
+	blackInfo.OpenFiles, blackInfo.SemiOpenFiles = openFilesNearKing(whiteKingSq, b.whitePawn, b.blackPawn)
+
+	return whiteInfo, blackInfo
+}
+
+// Returns the king attack information of a side, the ring attacks do not count
+// the squares of its own pieces
+func kingAttackers(attacks *AttackMaps, kingSq Square) KingAttackInfo {
+	var info KingAttackInfo
+	info.KnightAttackers = attacks.KnightAttackers
+	info.BishopAttackers = attacks.BishopAttackers
+	info.RookAttackers = attacks.RookAttackers
+	info.QueenAttackers = attacks.QueenAttackers
+
+	all := attacks.Pawn | (attacks.Knight|attacks.Bishop|attacks.Rook|attacks.Queen)&^attacks.own
+	info.InnerRingAttacks = int16(bits.OnesCount64(all & SquareInnerRingMask[kingSq]))
+	info.OuterRingAttacks = int16(bits.OnesCount64(all & SquareOuterRingMask[kingSq]))
+	return info
+}
+
+// A safe check is a checking square that our piece can move to, which is not
+// defended by the other side
+func (b *Bitboard) safeChecks(info *KingAttackInfo, attacks *AttackMaps, defended uint64,
+	kingSq Square, occupied uint64, own uint64) {
+	safe := ^(defended | own)
+	bishopChecks := bishopAttacks(kingSq, occupied, empty) & safe
+	rookChecks := rookAttacks(kingSq, occupied, empty) & safe
+	info.KnightSafeChecks = int16(bits.OnesCount64(computedKnightAttacks[kingSq] & safe & attacks.Knight))
+	info.BishopSafeChecks = int16(bits.OnesCount64(bishopChecks & attacks.Bishop))
+	info.RookSafeChecks = int16(bits.OnesCount64(rookChecks & attacks.Rook))
+	info.QueenSafeChecks = int16(bits.OnesCount64((bishopChecks | rookChecks) & attacks.Queen))
+}
+
+func openFilesNearKing(kingSq Square, defenderPawns uint64, attackerPawns uint64) (int16, int16) {
+	var open, semiOpen int16
+	kingFile := int(kingSq.File())
+	for f := kingFile - 1; f <= kingFile+1; f++ {
+		if f < 0 || f > 7 {
+			continue
+		}
+		file := FileFill(SquareMask[f])
+		if file&(defenderPawns|attackerPawns) == 0 {
+			open += 1
+		} else if file&defenderPawns == 0 {
+			semiOpen += 1
+		}
+	}
+	return open, semiOpen
+}
+
+// Threats
+
+// Threats that a side poses on the pieces of the other side
+type ThreatInfo struct {
+	PawnThreats     int16 // Number of pieces attacked by our pawns
+	MinorThreats    int16 // Number of rooks and queens attacked by our minor pieces
+	HangingPieces   int16 // Number of attacked pieces and pawns that are not defended
+	PawnPushThreats int16 // Number of pieces that a safe pawn push would attack
+}
+
+// Returns the threats of white on black pieces, and the threats of black on white pieces
+func (b *Bitboard) Threats(white *AttackMaps, black *AttackMaps) (ThreatInfo, ThreatInfo) {
+	occupied := b.whitePieces | b.blackPieces
+	whiteThreats := b.threats(White, white, black, occupied)
+	blackThreats := b.threats(Black, black, white, occupied)
+	return whiteThreats, blackThreats
+}
+
+func (b *Bitboard) threats(color Color, attacks *AttackMaps, defends *AttackMaps, occupied uint64) ThreatInfo {
+	var info ThreatInfo
+	var pieces, majors, pawns, ownPawns uint64
+	var pushes, pushAttacks uint64
+	if color == White {
+		pieces = b.blackPieces &^ (b.blackPawn | b.blackKing)
+		majors = b.blackRook | b.blackQueen
+		pawns = b.blackPawn
+		ownPawns = b.whitePawn
+		pushes = wSinglePushTargets(ownPawns, ^occupied)
+		pushes |= wDoublePushTargets(ownPawns, ^occupied)
+	} else {
+		pieces = b.whitePieces &^ (b.whitePawn | b.whiteKing)
+		majors = b.whiteRook | b.whiteQueen
+		pawns = b.whitePawn
+		ownPawns = b.blackPawn
+		pushes = bSinglePushTargets(ownPawns, ^occupied)
+		pushes |= bDoublePushTargets(ownPawns, ^occupied)
+	}
+
+	attacked, defended := attacks.All(), defends.All()
+	info.PawnThreats = int16(bits.OnesCount64(attacks.Pawn & pieces))
+	info.MinorThreats = int16(bits.OnesCount64((attacks.Knight | attacks.Bishop) & majors))
+	info.HangingPieces = int16(bits.OnesCount64(attacked & (pieces | pawns) &^ defended))
+
+	// A push is safe if the pawn cannot be taken by a pawn, and it is either not
+	// attacked or defended by us
+	pushes &^= defends.Pawn
+	pushes &= ^defended | attacked
+	if color == White {
+		pushAttacks = wPawnAnyAttacks(pushes)
+	} else {
+		pushAttacks = bPawnAnyAttacks(pushes)
+	}
+	info.PawnPushThreats = int16(bits.OnesCount64(pushAttacks & pieces &^ attacks.Pawn))
+	return info
+}
+
+// Passed pawns
+
+// The parts of passed pawn evaluation that depend on the pieces, and hence cannot
+// be cached in the pawn hash. Most of the terms are weighted by how advanced
+// the pawn is, see passedPawnWeight
+type PassedPawnInfo struct {
+	OwnKingDistance   int16 // Distance of our king to the square in front of the pawns
+	EnemyKingDistance int16 // Distance of the enemy king to the square in front of the pawns
+	FreeAdvance       int16 // Pawns that can advance to a free square that is not attacked
+	SafePath          int16 // Pawns whose path to promotion is neither blocked nor attacked
+	Blockaded         int16 // Pawns that are blocked by an enemy piece
+	Unstoppable       int16 // Pawns that the enemy king cannot catch in a pawn ending
+}
+
+// Returns the passed pawn information of white and black
+func (p *Position) PassedPawns(white *AttackMaps, black *AttackMaps) (PassedPawnInfo, PassedPawnInfo) {
+	b := p.Board
+	var whiteInfo, blackInfo PassedPawnInfo
+	whitePassers := wPassedPawns(b.whitePawn, b.blackPawn)
+	blackPassers := bPassedPawns(b.blackPawn, b.whitePawn)
+	if whitePassers == 0 && blackPassers == 0 {
+		return whiteInfo, blackInfo
+	}
+
+	whitePawnAttacks, whiteMinorAttacks, whiteOtherAttacks := white.Groups()
+	blackPawnAttacks, blackMinorAttacks, blackOtherAttacks := black.Groups()
+	whiteAttacks := whitePawnAttacks | whiteMinorAttacks | whiteOtherAttacks
+	blackAttacks := blackPawnAttacks | blackMinorAttacks | blackOtherAttacks
+
+	whiteKingSq := Square(bitScanForward(b.whiteKing))
+	blackKingSq := Square(bitScanForward(b.blackKing))
+	whitePawnEnding := b.whitePieces == b.whitePawn|b.whiteKing
+	blackPawnEnding := b.blackPieces == b.blackPawn|b.blackKing
+	turn := p.Turn()
+
+	for whitePassers != 0 {
+		sq := Square(bitScanForward(whitePassers))
+		b.passedPawn(&whiteInfo, White, sq, whiteKingSq, blackKingSq, b.blackPieces, blackAttacks,
+			blackPawnEnding, turn == Black)
+		whitePassers ^= (1 << sq)
+	}
+
+	for blackPassers != 0 {
+		sq := Square(bitScanForward(blackPassers))
+		b.passedPawn(&blackInfo, Black, sq, blackKingSq, whiteKingSq, b.whitePieces, whiteAttacks,
+			whitePawnEnding, turn == White)
+		blackPassers ^= (1 << sq)
+	}
+
+	return whiteInfo, blackInfo
+}
+
+func (b *Bitboard) passedPawn(info *PassedPawnInfo, color Color, sq Square, ownKingSq Square, enemyKingSq Square,
+	enemyPieces uint64, enemyAttacks uint64, enemyPawnEnding bool, enemyToMove bool) {
+	occupied := b.whitePieces | b.blackPieces
+	pawn := uint64(1 << sq)
+	var rank int16
+	var path uint64
+	var stop, promotion Square
+	if color == White {
+		rank = int16(sq.Rank())
+		path = wFrontSpan(pawn)
+		stop = sq + 8
+		promotion = SquareOf(sq.File(), Rank8)
+	} else {
+		rank = 7 - int16(sq.Rank())
+		path = bFrontSpan(pawn)
+		stop = sq - 8
+		promotion = SquareOf(sq.File(), Rank1)
+	}
+	stopMask := uint64(1 << stop)
+
+	if stopMask&enemyPieces != 0 {
+		info.Blockaded += 1
+	}
+
+	weight := passedPawnWeight(rank)
+	if weight > 0 {
+		info.OwnKingDistance += weight * SquareDistance(ownKingSq, stop)
+		info.EnemyKingDistance += weight * SquareDistance(enemyKingSq, stop)
+		if stopMask&(occupied|enemyAttacks) == 0 {
+			info.FreeAdvance += weight
+			if path&(enemyPieces|enemyAttacks) == 0 {
+				info.SafePath += weight
+			}
+		}
+	}
+
+	// The rule of the square, a pawn on its initial rank can make a double push
+	if enemyPawnEnding && path&occupied == 0 {
+		pawnDistance := 7 - rank
+		if pawnDistance > 5 {
+			pawnDistance = 5
+		}
+		kingDistance := SquareDistance(enemyKingSq, promotion)
+		if enemyToMove {
+			kingDistance -= 1
+		}
+		if kingDistance > pawnDistance {
+			info.Unstoppable += 1
+		}
+	}
+}
+
+// Only pawns that are past the middle of the board get a weight, the
+// further they are the higher the weight
+func passedPawnWeight(rank int16) int16 {
+	if rank < 3 {
+		return 0
+	}
+	return rank - 2
+}
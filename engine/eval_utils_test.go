@@ -85,6 +85,54 @@ func TestAllAttacksBlack(t *testing.T) {
 	}
 }
 
+func TestThreats(t *testing.T) {
+	tests := []struct {
+		fen   string
+		white ThreatInfo
+		black ThreatInfo
+	}{
+		{"4k3/8/8/3n4/4P3/8/8/4K3 w - - 0 1", ThreatInfo{PawnThreats: 1, HangingPieces: 1}, ThreatInfo{}},
+		{"4k3/8/8/4r3/8/5N2/8/4K3 w - - 0 1", ThreatInfo{MinorThreats: 1, HangingPieces: 1}, ThreatInfo{}},
+		{"4k3/8/8/2n5/8/3P4/8/4K3 w - - 0 1", ThreatInfo{PawnPushThreats: 1}, ThreatInfo{HangingPieces: 1}},
+	}
+
+	for _, test := range tests {
+		game := FromFen(test.fen)
+		board := game.position.Board
+
+		whiteAttacks, blackAttacks := board.AttackMapsOf(White), board.AttackMapsOf(Black)
+		white, black := board.Threats(&whiteAttacks, &blackAttacks)
+		if white != test.white || black != test.black {
+			t.Error(fmt.Sprintf("%s\nExpected: %v %v\n, Got: %v %v\n", test.fen, test.white, test.black, white, black))
+		}
+	}
+}
+
+func TestPassedPawnsInfo(t *testing.T) {
+	tests := []struct {
+		fen   string
+		white PassedPawnInfo
+		black PassedPawnInfo
+	}{
+		{"7k/8/8/P7/8/8/8/K7 w - - 0 1", PassedPawnInfo{OwnKingDistance: 10, EnemyKingDistance: 14,
+			FreeAdvance: 2, SafePath: 2, Unstoppable: 1}, PassedPawnInfo{}},
+		{"8/3k4/8/P7/8/8/8/K7 b - - 0 1", PassedPawnInfo{OwnKingDistance: 10, EnemyKingDistance: 6,
+			FreeAdvance: 2, SafePath: 2}, PassedPawnInfo{}},
+		{"7k/8/8/8/8/n7/P7/K7 w - - 0 1", PassedPawnInfo{Blockaded: 1}, PassedPawnInfo{}},
+	}
+
+	for _, test := range tests {
+		game := FromFen(test.fen)
+
+		board := game.position.Board
+		whiteAttacks, blackAttacks := board.AttackMapsOf(White), board.AttackMapsOf(Black)
+		white, black := game.position.PassedPawns(&whiteAttacks, &blackAttacks)
+		if white != test.white || black != test.black {
+			t.Error(fmt.Sprintf("%s\nExpected: %v %v\n, Got: %v %v\n", test.fen, test.white, test.black, white, black))
+		}
+	}
+}
+
 func TestBackwardPawns(t *testing.T) {
 	fen := "rnbqkbnr/5ppp/p2p4/P2P1P2/1P2P3/8/6PP/RNBQKBNR w KQkq - 0 1"
 	game := FromFen(fen)
@@ -236,3 +284,47 @@ func TestCountKnightOutpostsBlackFourthRank(t *testing.T) {
 		t.Error(fmt.Sprintf("Black\nExpected: %d\n, Got: %d\n", expected, actual))
 	}
 }
+
+func TestAttackMapsIncludeDefendedSquares(t *testing.T) {
+	fen := "3k4/8/8/8/8/2Q5/8/2K5 w - - 0 1"
+	game := FromFen(fen)
+	board := game.position.Board
+
+	attacks := board.AttackMapsOf(White)
+	if attacks.All()&SquareMask[C1] == 0 {
+		t.Error("Expected the queen to defend the king")
+	}
+	pawn, minor, other := attacks.Groups()
+	if (pawn|minor|other)&SquareMask[C1] != 0 {
+		t.Error("Expected mobility attacks not to include the king")
+	}
+	if attacks.QueenAttackers != 1 {
+		t.Error(fmt.Sprintf("Expected: the queen to attack the king zone\n, Got: %d\n", attacks.QueenAttackers))
+	}
+}
+
+func TestSafeChecksExcludePieceDefendedSquares(t *testing.T) {
+	// The queen can check from e8 by taking the bishop, but the knight defends it
+	fen := "4b1k1/5ppp/3n4/8/8/8/4Q3/K7 w - - 0 1"
+	game := FromFen(fen)
+	board := game.position.Board
+	white := board.AttackMapsOf(White)
+	black := board.AttackMapsOf(Black)
+
+	whiteInfo, _ := board.KingAttacks(&white, &black)
+	if whiteInfo.QueenSafeChecks != 0 {
+		t.Error(fmt.Sprintf("Expected: 0\n, Got: %d\n", whiteInfo.QueenSafeChecks))
+	}
+
+	// Without the knight, the check is safe
+	fen = "4b1k1/5ppp/8/8/8/8/4Q3/K7 w - - 0 1"
+	game = FromFen(fen)
+	board = game.position.Board
+	white = board.AttackMapsOf(White)
+	black = board.AttackMapsOf(Black)
+
+	whiteInfo, _ = board.KingAttacks(&white, &black)
+	if whiteInfo.QueenSafeChecks != 1 {
+		t.Error(fmt.Sprintf("Expected: 1\n, Got: %d\n", whiteInfo.QueenSafeChecks))
+	}
+}
@@ -121,6 +121,7 @@ func positionFromFen(fen string) Position {
 		0,
 		0,
 		0,
+		0,
 		make(map[uint64]int, 100),
 		uint8(halfMoveClock),
 		mob,
@@ -11,8 +11,7 @@ type Game struct {
 }
 
 func (g *Game) IsLegalMove(m Move) bool {
-	// Very inefficient, but doesn't really matter
-	for _, move := range g.position.PseudoLegalMoves() {
+	for _, move := range g.position.LegalMoves() {
 		if move == m {
 			return true
 		}
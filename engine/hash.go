@@ -9,18 +9,23 @@ var castleRightsZC [4]uint64
 var enPassantZC [16]uint64
 var whiteTurnZC uint64
 
+// The keys are generated from a fixed seed, so that hashes stay the same between
+// runs, which is needed to persist the transposition table
+const zobristSeed = 0x5A484B
+
 func init() {
-	whiteTurnZC = rand.Uint64()
+	random := rand.New(rand.NewSource(zobristSeed))
+	whiteTurnZC = random.Uint64()
 	for i := 0; i < 12; i++ {
 		for j := 0; j < 64; j++ {
-			piecesZC[i][j] = rand.Uint64()
+			piecesZC[i][j] = random.Uint64()
 		}
 	}
 	for i := 0; i < 4; i++ {
-		castleRightsZC[i] = rand.Uint64()
+		castleRightsZC[i] = random.Uint64()
 	}
 	for i := 0; i < 16; i++ {
-		enPassantZC[i] = rand.Uint64()
+		enPassantZC[i] = random.Uint64()
 	}
 }
 
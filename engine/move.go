@@ -104,3 +104,31 @@ func (m Move) ToString() string {
 	}
 	return notation
 }
+
+// CompactMove is a 16 bit version of a move, that is small enough to be stored
+// in the transposition table:
+//
+//   - the lowest 6 bits represent the Source square
+//   - the next 6 bits represent the Destination square
+//   - the next 3 bits represent the promotion type
+//
+// The rest of the move is recovered from the position, see Position.MoveFromCompact
+type CompactMove uint16
+
+const EmptyCompactMove = CompactMove(0)
+
+func (m Move) Compact() CompactMove {
+	return CompactMove(uint32(m)&0xFFF | uint32(m.PromoType())<<12)
+}
+
+func (m CompactMove) Source() Square {
+	return Square(m & 0x3F)
+}
+
+func (m CompactMove) Destination() Square {
+	return Square(m & 0xFC0 >> 6)
+}
+
+func (m CompactMove) PromoType() PieceType {
+	return PieceType(m & 0x7000 >> 12)
+}
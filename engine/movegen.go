@@ -46,67 +46,160 @@ func (p *Position) GetCaptureMoves(ml *MoveList) {
 	p.kingCaptureMoves(color, ml)
 }
 
-// Checks and Pins
-func isInCheck(b *Bitboard, colorOfKing Color) bool {
-	return isKingAttacked(b, colorOfKing)
+// Legal moves, found without making and unmaking the illegal ones
+func (p *Position) LegalMoves() []Move {
+	ml := NewMoveList(250)
+	pins := p.pinsOf()
+
+	start := ml.Size
+	p.GetCaptureMoves(ml)
+	p.GetQuietMoves(ml)
+	p.keepLegal(ml, start, &pins)
+
+	return ml.Moves[:ml.Size]
 }
 
-func isKingAttacked(b *Bitboard, colorOfKing Color) bool {
-	var ownKing, opPawnAttacks, opKnights, opRQ, opBQ, opKing uint64
-	var squareOfKing Square
-	occupiedBB := b.whitePieces | b.blackPieces
-	if colorOfKing == White {
-		kingIndex := bitScanForward(b.whiteKing)
-		ownKing = SquareMask[kingIndex]
-		opPawnAttacks = wPawnsAble2CaptureAny(ownKing, b.blackPawn)
-		if opPawnAttacks != 0 {
-			return true
-		}
-		squareOfKing = Square(kingIndex)
-		opKnights = b.blackKnight
-		opRQ = b.blackRook | b.blackQueen
-		opBQ = b.blackBishop | b.blackQueen
-		opKing = b.blackKing
-	} else {
-		kingIndex := bitScanForward(b.blackKing)
-		ownKing = SquareMask[kingIndex]
-		opPawnAttacks = bPawnsAble2CaptureAny(ownKing, b.whitePawn)
-		if opPawnAttacks != 0 {
-			return true
-		}
-		squareOfKing = Square(kingIndex)
-		opKnights = b.whiteKnight
-		opRQ = b.whiteRook | b.whiteQueen
-		opBQ = b.whiteBishop | b.whiteQueen
-		opKing = b.whiteKing
-	}
+func (p *Position) GetLegalQuietMoves(ml *MoveList) {
+	pins := p.pinsOf()
+	start := ml.Size
+	p.GetQuietMoves(ml)
+	p.keepLegal(ml, start, &pins)
+}
 
-	knightChecks := (knightAttacks(ownKing) & opKnights)
-	if knightChecks != 0 {
-		return true
+func (p *Position) GetLegalCaptureMoves(ml *MoveList) {
+	pins := p.pinsOf()
+	start := ml.Size
+	p.GetCaptureMoves(ml)
+	p.keepLegal(ml, start, &pins)
+}
+
+// Whether the move is one of the pseudo-legal moves of the position. Moves
+// from the transposition table might have been stored for another position
+// that shares the same slot, and making them would corrupt the board
+func (p *Position) IsPseudoLegal(move Move) bool {
+	if move == EmptyMove {
+		return false
+	}
+	board := p.Board
+	color := p.Turn()
+	source := move.Source()
+	dest := move.Destination()
+	movingPiece := move.MovingPiece()
+	capturedPiece := move.CapturedPiece()
+	promoType := move.PromoType()
+	if movingPiece == NoPiece || movingPiece.Color() != color || board.PieceAt(source) != movingPiece {
+		return false
 	}
 
-	kingChecks := (kingAttacks(ownKing) & opKing)
-	if kingChecks != 0 {
-		return true
+	if move.IsCastle() {
+		return p.isCastlingPseudoLegal(move)
 	}
 
-	bishopChecks := (bishopAttacks(squareOfKing, occupiedBB, empty) & opBQ)
+	occupiedBB := board.whitePieces | board.blackPieces
+	destMask := SquareMask[dest]
+	if move.IsEnPassant() {
+		if movingPiece.Type() != Pawn || dest != p.EnPassant || move.Tag() != Capture|EnPassant ||
+			capturedPiece != GetPiece(Pawn, color.Other()) || promoType != NoType ||
+			board.PieceAt(findEnPassantCaptureSquare(move)) != capturedPiece {
+			return false
+		}
+		if color == White {
+			return dest.Rank() == Rank6 && wPawnAnyAttacks(SquareMask[source])&destMask != 0
+		}
+		return dest.Rank() == Rank3 && bPawnAnyAttacks(SquareMask[source])&destMask != 0
+	}
 
-	if bishopChecks != 0 {
-		return true
+	if board.PieceAt(dest) != capturedPiece {
+		return false
+	}
+	if capturedPiece != NoPiece {
+		if capturedPiece.Color() == color || capturedPiece.Type() == King || move.Tag() != Capture {
+			return false
+		}
+	} else if move.Tag() != 0 {
+		return false
 	}
 
-	rookChecks := (rookAttacks(squareOfKing, occupiedBB, empty) & opRQ)
-	if rookChecks != 0 {
-		return true
+	if movingPiece.Type() != Pawn && promoType != NoType {
+		return false
 	}
+	switch movingPiece.Type() {
+	case Pawn:
+		var promotionRank, startRank Rank
+		var attacks, single, double uint64
+		sourceMask := SquareMask[source]
+		if color == White {
+			promotionRank, startRank = Rank8, Rank2
+			attacks = wPawnAnyAttacks(sourceMask)
+			single = wSinglePushTargets(sourceMask, ^occupiedBB)
+			double = wDoublePushTargets(sourceMask, ^occupiedBB)
+		} else {
+			promotionRank, startRank = Rank1, Rank7
+			attacks = bPawnAnyAttacks(sourceMask)
+			single = bSinglePushTargets(sourceMask, ^occupiedBB)
+			double = bDoublePushTargets(sourceMask, ^occupiedBB)
+		}
+		if (dest.Rank() == promotionRank) != (promoType != NoType) || promoType == Pawn || promoType > Queen {
+			return false
+		}
+		if capturedPiece != NoPiece {
+			return attacks&destMask != 0
+		}
+		return single&destMask != 0 || (source.Rank() == startRank && double&destMask != 0)
+	case Knight:
+		return computedKnightAttacks[source]&destMask != 0
+	case Bishop:
+		return bishopAttacks(source, occupiedBB, empty)&destMask != 0
+	case Rook:
+		return rookAttacks(source, occupiedBB, empty)&destMask != 0
+	case Queen:
+		return queenAttacks(source, occupiedBB, empty)&destMask != 0
+	case King:
+		return computedKingAttacks[source]&destMask != 0
+	}
+	return false
+}
 
-	if colorOfKing == White {
-		return opPawnAttacks != 0
+// Castling has the same conditions as in kingQuietMoves
+func (p *Position) isCastlingPseudoLegal(move Move) bool {
+	board := p.Board
+	occupiedBB := board.whitePieces | board.blackPieces
+	var path, safe uint64
+	switch move {
+	case whiteKingCastleMove:
+		if !p.HasTag(WhiteCanCastleKingSide) {
+			return false
+		}
+		path, safe = whiteKingSideCastle, whiteKingSideCastle|SquareMask[E1]
+	case whiteQueenCastleMove:
+		if !p.HasTag(WhiteCanCastleQueenSide) {
+			return false
+		}
+		path, safe = whiteQueenSideCastle|SquareMask[B1], whiteQueenSideCastle|SquareMask[E1]
+	case blackKingCastleMove:
+		if !p.HasTag(BlackCanCastleKingSide) {
+			return false
+		}
+		path, safe = blackKingSideCastle, blackKingSideCastle|SquareMask[E8]
+	case blackQueenCastleMove:
+		if !p.HasTag(BlackCanCastleQueenSide) {
+			return false
+		}
+		path, safe = blackQueenSideCastle|SquareMask[B8], blackQueenSideCastle|SquareMask[E8]
+	default:
+		return false
 	}
+	return occupiedBB&path == 0 && tabooSquares(board, p.Turn())&safe == 0
+}
 
-	return false
+// Checks and Pins
+func isInCheck(b *Bitboard, colorOfKing Color) bool {
+	return isKingAttacked(b, colorOfKing)
+}
+
+func isKingAttacked(b *Bitboard, colorOfKing Color) bool {
+	kingSq := Square(bitScanForward(b.GetBitboardOf(GetPiece(King, colorOfKing))))
+	return b.IsSquareAttacked(kingSq, colorOfKing.Other())
 }
 
 func tabooSquares(b *Bitboard, colorOfKing Color) uint64 {
@@ -151,6 +244,189 @@ func tabooSquares(b *Bitboard, colorOfKing Color) uint64 {
 	return taboo
 }
 
+// Quiet moves that give check, either directly or by uncovering an attack of
+// a slider. Castling moves are never generated as checks
+func (p *Position) GetQuietChecks(ml *MoveList) {
+	board := p.Board
+	color := p.Turn()
+	var opKing, ownPieces, ownBQ, ownRQ, pawnChecks uint64
+	if color == White {
+		opKing = board.blackKing
+		ownPieces = board.whitePieces
+		ownBQ = board.whiteBishop | board.whiteQueen
+		ownRQ = board.whiteRook | board.whiteQueen
+		pawnChecks = bPawnAnyAttacks(opKing)
+	} else {
+		opKing = board.whiteKing
+		ownPieces = board.blackPieces
+		ownBQ = board.blackBishop | board.blackQueen
+		ownRQ = board.blackRook | board.blackQueen
+		pawnChecks = wPawnAnyAttacks(opKing)
+	}
+	occupiedBB := board.whitePieces | board.blackPieces
+	kingSq := Square(bitScanForward(opKing))
+	knightChecks := computedKnightAttacks[kingSq]
+	discoverers := discoveredCheckers(kingSq, occupiedBB, ownPieces, ownBQ, ownRQ)
+
+	start := ml.Size
+	p.GetQuietMoves(ml)
+	size := start
+	for i := start; i < ml.Size; i++ {
+		move := ml.Moves[i]
+		if move.IsCastle() {
+			continue
+		}
+		srcMask := SquareMask[move.Source()]
+		dest := move.Destination()
+		occ := occupiedBB ^ srcMask | SquareMask[dest]
+		check := false
+		switch move.MovingPiece().Type() {
+		case Pawn:
+			check = pawnChecks&SquareMask[dest] != 0
+		case Knight:
+			check = knightChecks&SquareMask[dest] != 0
+		case Bishop:
+			check = bishopAttacks(dest, occ, empty)&opKing != 0
+		case Rook:
+			check = rookAttacks(dest, occ, empty)&opKing != 0
+		case Queen:
+			check = queenAttacks(dest, occ, empty)&opKing != 0
+		}
+		if !check && discoverers&srcMask != 0 {
+			check = (bishopAttacks(kingSq, occ, empty)&ownBQ|rookAttacks(kingSq, occ, empty)&ownRQ)&^srcMask != 0
+		}
+		if check {
+			ml.Moves[size] = move
+			size += 1
+		}
+	}
+	ml.Size = size
+}
+
+// Pieces of the side to move that stand between one of its sliders and the
+// king of the opponent
+func discoveredCheckers(kingSq Square, occupiedBB uint64, ownPieces uint64, ownBQ uint64, ownRQ uint64) uint64 {
+	var discoverers uint64
+	candidates := queenAttacks(kingSq, occupiedBB, empty) & ownPieces
+	for candidates != 0 {
+		sq := bitScanForward(candidates)
+		mask := SquareMask[sq]
+		occ := occupiedBB ^ mask
+		if (bishopAttacks(kingSq, occ, empty)&ownBQ|rookAttacks(kingSq, occ, empty)&ownRQ)&^mask != 0 {
+			discoverers |= mask
+		}
+		candidates ^= mask
+	}
+	return discoverers
+}
+
+// The pieces that check the king of the given color, and when there is only
+// one slider among them, the squares between it and the king
+func checkersOf(b *Bitboard, colorOfKing Color) (uint64, uint64) {
+	var ownKing, opPawns, opKnights, opRQ, opBQ uint64
+	occupiedBB := b.whitePieces | b.blackPieces
+	if colorOfKing == White {
+		ownKing = b.whiteKing
+		opPawns = wPawnAnyAttacks(ownKing) & b.blackPawn
+		opKnights = b.blackKnight
+		opRQ = b.blackRook | b.blackQueen
+		opBQ = b.blackBishop | b.blackQueen
+	} else {
+		ownKing = b.blackKing
+		opPawns = bPawnAnyAttacks(ownKing) & b.whitePawn
+		opKnights = b.whiteKnight
+		opRQ = b.whiteRook | b.whiteQueen
+		opBQ = b.whiteBishop | b.whiteQueen
+	}
+	kingSq := Square(bitScanForward(ownKing))
+	diagonal := bishopAttacks(kingSq, occupiedBB, empty) & opBQ
+	straight := rookAttacks(kingSq, occupiedBB, empty) & opRQ
+	checkers := opPawns | computedKnightAttacks[kingSq]&opKnights | diagonal | straight
+
+	var blocks uint64
+	if bits.OnesCount64(checkers) == 1 {
+		if diagonal != 0 {
+			sq := Square(bitScanForward(diagonal))
+			blocks = bishopAttacks(kingSq, occupiedBB, empty) & bishopAttacks(sq, occupiedBB, empty)
+		} else if straight != 0 {
+			sq := Square(bitScanForward(straight))
+			blocks = rookAttacks(kingSq, occupiedBB, empty) & rookAttacks(sq, occupiedBB, empty)
+		}
+	}
+	return checkers, blocks
+}
+
+// The checks and pins on the king of the side to move
+type pinInfo struct {
+	kingSq   Square
+	checkers uint64
+	evasions uint64 // The checker and the squares between it and the king
+	pinned   uint64
+	rays     [64]uint64 // The squares a pinned piece can still move to
+}
+
+func (p *Position) pinsOf() pinInfo {
+	b := p.Board
+	color := p.Turn()
+	kingSq := Square(bitScanForward(b.GetBitboardOf(GetPiece(King, color))))
+	checkers, blocks := checkersOf(b, color)
+	pins := pinInfo{kingSq: kingSq, checkers: checkers}
+	if bits.OnesCount64(checkers) == 1 {
+		pins.evasions = checkers | blocks
+	}
+	pins.pinned = b.pinned(color, &pins.rays)
+	return pins
+}
+
+// Drops the illegal moves, from start to the end of the list
+func (p *Position) keepLegal(ml *MoveList, start int, pins *pinInfo) {
+	size := start
+	for i := start; i < ml.Size; i++ {
+		move := ml.Moves[i]
+		if p.isLegalMove(move, pins) {
+			ml.Moves[size] = move
+			size += 1
+		}
+	}
+	ml.Size = size
+}
+
+func (p *Position) isLegalMove(move Move, pins *pinInfo) bool {
+	src := move.Source()
+	destMask := SquareMask[move.Destination()]
+	if move.MovingPiece().Type() == King {
+		if move.IsCastle() {
+			// Castling is only generated when it is legal
+			return true
+		}
+		occ := (p.Board.whitePieces | p.Board.blackPieces) ^ SquareMask[src]
+		return p.Board.attacksTo(occ, move.Destination())&p.opponentPieces() == 0
+	}
+	if move.IsEnPassant() {
+		return p.isLegalEnPassant(move, pins.kingSq)
+	}
+	if pins.checkers != 0 && destMask&pins.evasions == 0 {
+		// Only the king can move out of a double check, there are no evasions then
+		return false
+	}
+	return pins.pinned&SquareMask[src] == 0 || pins.rays[src]&destMask != 0
+}
+
+// En passant removes two pieces from a line, it is easier to look at the
+// position after it
+func (p *Position) isLegalEnPassant(move Move, kingSq Square) bool {
+	capturedMask := SquareMask[findEnPassantCaptureSquare(move)]
+	occ := (p.Board.whitePieces | p.Board.blackPieces) ^ SquareMask[move.Source()] ^ capturedMask | SquareMask[move.Destination()]
+	return p.Board.attacksTo(occ, kingSq)&p.opponentPieces()&^capturedMask == 0
+}
+
+func (p *Position) opponentPieces() uint64 {
+	if p.Turn() == White {
+		return p.Board.blackPieces
+	}
+	return p.Board.whitePieces
+}
+
 // Quiet moves
 
 func (p *Position) pawnQuietMoves(color Color,
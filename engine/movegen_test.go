@@ -2,6 +2,7 @@ package engine
 
 import (
 	"fmt"
+	"math/rand"
 	"testing"
 )
 
@@ -563,3 +564,123 @@ func containsMove(moves1 []Move, move Move) bool {
 	}
 	return exists
 }
+
+var checkTestFens = []string{
+	"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1",
+	"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1",
+	"r3k2r/Pppp1ppp/1b3nbN/nP6/BBP1P3/q4N2/Pp1P2PP/R2Q1RK1 w kq - 0 1",
+	"8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 1",
+	"4k3/8/8/2B5/8/8/8/R3K3 w Q - 0 1",
+	"4k3/4p3/2N5/8/3Q4/8/4R3/4K3 w - - 0 1",
+	"5Q2/8/1q5P/8/6k1/5R2/6P1/2r3K1 w - - 0 1",
+	"8/8/8/2k5/3Pp3/8/8/4K2Q b - d3 0 1",
+	"4k3/8/8/8/1b6/8/4P3/4K3 w - - 0 1",
+	"4k3/4r3/8/8/8/8/3P4/R3K2R w KQ - 0 1",
+}
+
+func TestGetQuietChecks(t *testing.T) {
+	for _, fen := range checkTestFens {
+		p := FromFen(fen).position
+		ml := NewMoveList(100)
+		p.GetQuietChecks(ml)
+		checks := ml.Moves[:ml.Size]
+
+		all := NewMoveList(100)
+		p.GetQuietMoves(all)
+		for _, move := range all.Moves[:all.Size] {
+			if move.IsCastle() {
+				continue
+			}
+			ep, tag, hc, ok := p.MakeMove(move)
+			if !ok {
+				continue
+			}
+			check := p.IsInCheck()
+			p.UnMakeMove(move, tag, ep, hc)
+			if check != containsMove(checks, move) {
+				t.Errorf("%s: expected %s to be a check: %t", fen, move.ToString(), check)
+			}
+		}
+	}
+}
+
+func TestLegalMovesMatchPseudoLegalMoves(t *testing.T) {
+	fens := append(checkTestFens,
+		"rnbq1k1r/pp1Pbppp/2p5/8/2B5/8/PPP1NnPP/RNBQK2R w KQ - 1 8",
+		"r4rk1/1pp1qppp/p1np1n2/2b1p1B1/2B1P1b1/P1NP1N2/1PP1QPPP/R4RK1 w - - 0 10",
+		"n1n5/PPPk4/8/8/8/8/4Kppp/5N1N b - - 0 1",
+		"8/8/8/8/k2Pp2Q/8/8/3K4 b - d3 0 1",
+		"8/8/8/8/k2Pp2R/8/8/3K4 b - d3 0 1",
+		"r3k2r/p1ppqpb1/b3pnp1/3PN3/1p2P3/2N1nQ1p/PPPB1PPP/R2B1K1R w kq - 4 5",
+	)
+	for _, fen := range fens {
+		p := FromFen(fen).position
+		legal, pseudoLegal := compareLegalMoves(t, p, 3)
+		if legal != pseudoLegal {
+			t.Errorf("%s: perft mismatch, legal: %d, pseudo-legal: %d", fen, legal, pseudoLegal)
+		}
+	}
+}
+
+func compareLegalMoves(t *testing.T, p *Position, depth int) (int64, int64) {
+	legalMoves := p.LegalMoves()
+	expected := make([]Move, 0, len(legalMoves))
+	for _, move := range p.PseudoLegalMoves() {
+		if ep, tag, hc, ok := p.MakeMove(move); ok {
+			expected = append(expected, move)
+			p.UnMakeMove(move, tag, ep, hc)
+		}
+	}
+	if !equalMoves(expected, legalMoves) {
+		t.Errorf("%s: expected %d legal moves, got %d", p.Fen(), len(expected), len(legalMoves))
+	}
+	if depth == 1 {
+		return int64(len(legalMoves)), int64(len(expected))
+	}
+	var legal, pseudoLegal int64
+	for _, move := range expected {
+		ep, tag, hc, _ := p.MakeMove(move)
+		l, pl := compareLegalMoves(t, p, depth-1)
+		legal += l
+		pseudoLegal += pl
+		p.UnMakeMove(move, tag, ep, hc)
+	}
+	return legal, pseudoLegal
+}
+
+func TestIsPseudoLegal(t *testing.T) {
+	fens := append(checkTestFens,
+		"r3k2r/8/8/8/3pPp2/8/8/R3K1RR b KQkq e3 0 1",
+		"rnbqkbnr/ppppp1pp/7n/4Pp2/8/8/PPPP1PPP/RNBQKBNR w KQkq f6 0 3",
+		"r3k2r/8/3Q4/8/8/5q2/8/R3K2R b KQkq - 0 1",
+		"n1n5/PPPk4/8/8/8/8/4Kppp/5N1N w - - 0 1",
+	)
+	random := rand.New(rand.NewSource(49))
+	for _, fen := range fens {
+		p := FromFen(fen).position
+		pseudoLegal := p.PseudoLegalMoves()
+		// Every move that the transposition table can hold, and random moves
+		moves := make([]Move, 0, 1<<15+100_000)
+		for compact := 0; compact < 1<<15; compact++ {
+			moves = append(moves, p.MoveFromCompact(CompactMove(compact)))
+		}
+		for i := 0; i < 100_000; i++ {
+			moves = append(moves, Move(random.Uint32()&0xFFFFFFF))
+		}
+		for _, move := range moves {
+			if !p.IsPseudoLegal(move) || containsMove(pseudoLegal, move) {
+				continue
+			}
+			// The generator drops some king moves into check, that MakeMove rejects anyway
+			if ep, tag, hc, ok := p.MakeMove(move); ok {
+				p.UnMakeMove(move, tag, ep, hc)
+				t.Errorf("%s: %s is not pseudo-legal", fen, move.ToString())
+			}
+		}
+		for _, move := range pseudoLegal {
+			if !p.IsPseudoLegal(move) {
+				t.Errorf("%s: expected %s to be pseudo-legal", fen, move.ToString())
+			}
+		}
+	}
+}
@@ -31,6 +31,87 @@ func (p *Position) ParseMoves(moveStr []string) []Move {
 	}
 }
 
+// Parses a move in Standard Algebraic Notation (as found in PGN files) and
+// returns the matching legal move, or EmptyMove if there is none
+func (p *Position) PGNToMove(san string) Move {
+	san = strings.TrimRight(strings.TrimSpace(san), "+#!?")
+	if san == "" {
+		return EmptyMove
+	}
+
+	if san == "O-O" || san == "0-0" || san == "O-O-O" || san == "0-0-0" {
+		isKingSide := len(san) == 3
+		for _, move := range p.LegalMoves() {
+			if (isKingSide && move.IsKingSideCastle()) || (!isKingSide && move.IsQueenSideCastle()) {
+				return move
+			}
+		}
+		return EmptyMove
+	}
+
+	pieceType := Pawn
+	switch san[0] {
+	case 'N':
+		pieceType = Knight
+	case 'B':
+		pieceType = Bishop
+	case 'R':
+		pieceType = Rook
+	case 'Q':
+		pieceType = Queen
+	case 'K':
+		pieceType = King
+	}
+	if pieceType != Pawn {
+		san = san[1:]
+	}
+
+	promoType := NoType
+	if i := strings.IndexByte(san, '='); i >= 0 && i+1 < len(san) {
+		promoType = pieceFromName(rune(san[i+1])).Type()
+		san = san[:i]
+	} else if pieceType == Pawn && len(san) > 2 && strings.ContainsRune("NBRQ", rune(san[len(san)-1])) {
+		promoType = pieceFromName(rune(san[len(san)-1])).Type()
+		san = san[:len(san)-1]
+	}
+
+	san = strings.Replace(san, "x", "", -1)
+	if len(san) < 2 {
+		return EmptyMove
+	}
+	dest, ok := NameToSquareMap[san[len(san)-2:]]
+	if !ok {
+		return EmptyMove
+	}
+
+	fromFile := File(-1)
+	fromRank := Rank(-1)
+	for _, ch := range san[:len(san)-2] {
+		if ch >= 'a' && ch <= 'h' {
+			fromFile = File(ch - 'a')
+		} else if ch >= '1' && ch <= '8' {
+			fromRank = Rank(ch - '1')
+		}
+	}
+
+	movingPiece := GetPiece(pieceType, p.Turn())
+	found := EmptyMove
+	for _, move := range p.LegalMoves() {
+		if move.MovingPiece() != movingPiece || move.Destination() != dest || move.PromoType() != promoType {
+			continue
+		}
+		source := move.Source()
+		if (fromFile != -1 && source.File() != fromFile) || (fromRank != -1 && source.Rank() != fromRank) {
+			continue
+		}
+		if found != EmptyMove { // ambiguous move
+			return EmptyMove
+		}
+		found = move
+	}
+	return found
+}
+
 func (p *Position) MoveToPGN(move Move) string {
 	if move.IsKingSideCastle() {
 		return "O-O"
@@ -44,11 +125,10 @@ func (p *Position) MoveToPGN(move Move) string {
 	dest := move.Destination()
 	promoType := move.PromoType()
 
-	// highly inefficient, but so what
 	ambiguity := 0
 	var alternativeMove Move
 	if movingPiece.Type() != Pawn {
-		validMoves := p.PseudoLegalMoves()
+		validMoves := p.LegalMoves()
 		for _, m := range validMoves {
 			if m != move && m.MovingPiece() == movingPiece && m.Destination() == dest {
 				alternativeMove = m
@@ -82,15 +162,16 @@ func (p *Position) MoveToPGN(move Move) string {
 		moveStr = fmt.Sprint(moveStr, "=", promoType.Name())
 	}
 	// is Checkmate?
-	p.partialMakeMove(move)
-	if p.IsInCheck() {
-		if len(p.PseudoLegalMoves()) == 0 {
-			moveStr = fmt.Sprint(moveStr, "#")
-		} else {
-			moveStr = fmt.Sprint(moveStr, "+")
+	if ep, tg, hc, ok := p.MakeMove(move); ok {
+		if p.IsInCheck() {
+			if len(p.LegalMoves()) == 0 {
+				moveStr = fmt.Sprint(moveStr, "#")
+			} else {
+				moveStr = fmt.Sprint(moveStr, "+")
+			}
 		}
+		p.UnMakeMove(move, tg, ep, hc)
 	}
-	p.partialUnMakeMove(move)
 
 	return moveStr
 }
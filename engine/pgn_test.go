@@ -27,3 +27,57 @@ func TestPGNParsing(t *testing.T) {
 			fmt.Sprintf("\nExpected: %d\nGot: %d\n", len(expected), len(actual)))
 	}
 }
+
+func TestPGNToMove(t *testing.T) {
+	fen := "r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q2/PPPBBPpP/R3K2R b KQkq - 0 1"
+	game := FromFen(fen)
+	pos := game.position
+
+	tests := map[string]Move{
+		"gxh1=Q":  NewMove(G2, H1, BlackPawn, WhiteRook, Queen, Capture),
+		"gxh1Q+":  NewMove(G2, H1, BlackPawn, WhiteRook, Queen, Capture),
+		"O-O":     blackKingCastleMove,
+		"O-O-O":   blackQueenCastleMove,
+		"Rxh2":    NewMove(H8, H2, BlackRook, WhitePawn, NoType, Capture),
+		"Nbxd5":   NewMove(B6, D5, BlackKnight, WhitePawn, NoType, Capture),
+		"Nfxd5":   NewMove(F6, D5, BlackKnight, WhitePawn, NoType, Capture),
+		"Bxe2":    NewMove(A6, E2, BlackBishop, WhiteBishop, NoType, Capture),
+		"Qc5!?":   NewMove(E7, C5, BlackQueen, NoPiece, NoType, 0),
+		"bxc3":    NewMove(B4, C3, BlackPawn, WhiteKnight, NoType, Capture),
+		"Nxd5":    EmptyMove, // ambiguous, both knights can capture
+		"Ke7":     EmptyMove, // occupied by own queen
+		"garbage": EmptyMove,
+	}
+
+	for san, expected := range tests {
+		actual := pos.PGNToMove(san)
+		if actual != expected {
+			t.Errorf("Unexpected move for %s%s", san,
+				fmt.Sprintf("\nExpected: %s\nGot: %s\n", expected.ToString(), actual.ToString()))
+		}
+	}
+}
+
+func TestMoveToPGN(t *testing.T) {
+	tests := []struct {
+		fen      string
+		move     Move
+		expected string
+	}{
+		{"6k1/5ppp/8/8/8/8/5PPP/R5K1 w - - 0 1", NewMove(A1, A8, WhiteRook, NoPiece, NoType, 0), "Ra8#"},
+		{"6k1/5ppp/8/8/8/8/5PPP/R5K1 w - - 0 1", NewMove(A1, A7, WhiteRook, NoPiece, NoType, 0), "Ra7"},
+		{"4k3/8/8/8/8/2N3N1/8/4K3 w - - 0 1", NewMove(C3, E4, WhiteKnight, NoPiece, NoType, 0), "Nce4"},
+		{"4k3/8/8/8/7b/2N3N1/8/4K3 w - - 0 1", NewMove(C3, E4, WhiteKnight, NoPiece, NoType, 0), "Ne4"},
+		{"4k3/8/8/8/7b/2N3N1/8/4K3 w - - 0 1", NewMove(C3, D5, WhiteKnight, NoPiece, NoType, 0), "Nd5"},
+		{"4k3/8/8/8/8/2N3N1/8/4K3 w - - 0 1", NewMove(C3, D5, WhiteKnight, NoPiece, NoType, 0), "Nd5"},
+		{"4k3/8/8/8/8/2N5/8/4K2R w K - 0 1", NewMove(H1, H8, WhiteRook, NoPiece, NoType, 0), "Rh8+"},
+	}
+
+	for _, test := range tests {
+		pos := FromFen(test.fen).position
+		actual := pos.MoveToPGN(test.move)
+		if actual != test.expected {
+			t.Errorf("Unexpected PGN for %s in %s\nExpected: %s\nGot: %s\n", test.move.ToString(), test.fen, test.expected, actual)
+		}
+	}
+}
@@ -10,6 +10,7 @@ type Position struct {
 	Tag                 PositionTag
 	hash                uint64
 	pawnhash            uint64
+	materialKey         uint64
 	Positions           map[uint64]int
 	HalfMoveClock       uint8
 	MaterialsOnBoard    [12]int16
@@ -66,73 +67,6 @@ func (p *Position) ToggleTurn() {
 	p.ToggleTag(WhiteToMove)
 }
 
-// only for movegen
-func (p *Position) partialMakeMove(move Move) {
-	source := move.Source()
-	dest := move.Destination()
-	movingPiece := move.MovingPiece()
-	cp := move.CapturedPiece()
-
-	// EnPassant flag is a form of capture, captures do not result in enpassant allowance
-	if move.IsEnPassant() {
-		ep := findEnPassantCaptureSquare(move)
-		p.Board.Move(source, dest, movingPiece, NoPiece)
-		p.Board.Clear(ep, cp)
-	} else {
-		p.Board.Move(source, dest, movingPiece, cp)
-	}
-
-	// Do promotion
-	promoType := move.PromoType()
-	if promoType != NoType {
-		promoPiece := GetPiece(promoType, p.Turn())
-		p.Board.UpdateSquare(dest, promoPiece, movingPiece)
-	}
-
-	p.ToggleTurn()
-}
-
-// only for movegen
-func (p *Position) partialUnMakeMove(move Move) {
-	p.ToggleTurn()
-	movingPiece := move.MovingPiece()
-	capturedPiece := move.CapturedPiece()
-	source := move.Source()
-	dest := move.Destination()
-
-	// Undo promotion
-	promoType := move.PromoType()
-	if promoType != NoType {
-		promoPiece := GetPiece(promoType, p.Turn())
-		p.Board.UpdateSquare(dest, movingPiece, promoPiece)
-	}
-
-	p.Board.Move(dest, source, movingPiece, NoPiece)
-	// Undo enpassant
-	if move.IsEnPassant() {
-		cp := findEnPassantCaptureSquare(move)
-		p.Board.UpdateSquare(cp, capturedPiece, NoPiece)
-	} else if move.IsCapture() { // Undo capture
-		p.Board.UpdateSquare(dest, capturedPiece, NoPiece)
-	}
-
-	if move.IsQueenSideCastle() {
-		// white
-		if dest == C1 {
-			p.Board.Move(D1, A1, WhiteRook, NoPiece)
-		} else { // black
-			p.Board.Move(D8, A8, BlackRook, NoPiece)
-		}
-	} else if move.IsKingSideCastle() {
-		// white
-		if dest == G1 {
-			p.Board.Move(F1, H1, WhiteRook, NoPiece)
-		} else { // black
-			p.Board.Move(F8, H8, BlackRook, NoPiece)
-		}
-	}
-}
-
 func (p *Position) MakeMove(move Move) (Square, PositionTag, uint8, bool) {
 	hc := p.HalfMoveClock
 	ep := p.EnPassant
@@ -245,11 +179,14 @@ func (p *Position) MakeMove(move Move) (Square, PositionTag, uint8, bool) {
 				p.WhiteMiddlegamePSQT += EarlyPieceSquareTables[promoPiece-1][dest]
 				p.WhiteEndgamePSQT += LatePieceSquareTables[promoPiece-1][dest]
 				p.MaterialsOnBoard[movingPiece-1] -= 1
+				p.materialKey -= pieceMaterialKey(movingPiece)
 				p.MaterialsOnBoard[promoPiece-1] += 1
+				p.materialKey += pieceMaterialKey(promoPiece)
 			}
 
 			if capturedPiece != NoPiece {
 				p.MaterialsOnBoard[capturedPiece-1] -= 1
+				p.materialKey -= pieceMaterialKey(capturedPiece)
 				p.BlackMiddlegamePSQT -= EarlyPieceSquareTables[capturedPiece-1][captureSquare]
 				p.BlackEndgamePSQT -= LatePieceSquareTables[capturedPiece-1][captureSquare]
 			}
@@ -274,11 +211,14 @@ func (p *Position) MakeMove(move Move) (Square, PositionTag, uint8, bool) {
 				p.BlackMiddlegamePSQT += EarlyPieceSquareTables[promoPiece-1][dest]
 				p.BlackEndgamePSQT += LatePieceSquareTables[promoPiece-1][dest]
 				p.MaterialsOnBoard[movingPiece-1] -= 1
+				p.materialKey -= pieceMaterialKey(movingPiece)
 				p.MaterialsOnBoard[promoPiece-1] += 1
+				p.materialKey += pieceMaterialKey(promoPiece)
 			}
 
 			if capturedPiece != NoPiece {
 				p.MaterialsOnBoard[capturedPiece-1] -= 1
+				p.materialKey -= pieceMaterialKey(capturedPiece)
 				p.WhiteMiddlegamePSQT -= EarlyPieceSquareTables[capturedPiece-1][captureSquare]
 				p.WhiteEndgamePSQT -= LatePieceSquareTables[capturedPiece-1][captureSquare]
 			}
@@ -365,11 +305,14 @@ func (p *Position) unMakeMoveHelper(move Move, tag PositionTag, enPassant Square
 					p.WhiteMiddlegamePSQT -= EarlyPieceSquareTables[promoPiece-1][dest]
 					p.WhiteEndgamePSQT -= LatePieceSquareTables[promoPiece-1][dest]
 					p.MaterialsOnBoard[movingPiece-1] += 1
+					p.materialKey += pieceMaterialKey(movingPiece)
 					p.MaterialsOnBoard[promoPiece-1] -= 1
+					p.materialKey -= pieceMaterialKey(promoPiece)
 				}
 
 				if capturedPiece != NoPiece {
 					p.MaterialsOnBoard[capturedPiece-1] += 1
+					p.materialKey += pieceMaterialKey(capturedPiece)
 					p.BlackMiddlegamePSQT += EarlyPieceSquareTables[capturedPiece-1][captureSquare]
 					p.BlackEndgamePSQT += LatePieceSquareTables[capturedPiece-1][captureSquare]
 				}
@@ -394,11 +337,14 @@ func (p *Position) unMakeMoveHelper(move Move, tag PositionTag, enPassant Square
 					p.BlackMiddlegamePSQT -= EarlyPieceSquareTables[promoPiece-1][dest]
 					p.BlackEndgamePSQT -= LatePieceSquareTables[promoPiece-1][dest]
 					p.MaterialsOnBoard[movingPiece-1] += 1
+					p.materialKey += pieceMaterialKey(movingPiece)
 					p.MaterialsOnBoard[promoPiece-1] -= 1
+					p.materialKey -= pieceMaterialKey(promoPiece)
 				}
 
 				if capturedPiece != NoPiece {
 					p.MaterialsOnBoard[capturedPiece-1] += 1
+					p.materialKey += pieceMaterialKey(capturedPiece)
 					p.WhiteMiddlegamePSQT += EarlyPieceSquareTables[capturedPiece-1][captureSquare]
 					p.WhiteEndgamePSQT += LatePieceSquareTables[capturedPiece-1][captureSquare]
 				}
@@ -409,6 +355,45 @@ func (p *Position) unMakeMoveHelper(move Move, tag PositionTag, enPassant Square
 	}
 }
 
+// Recovers the full move out of a compact move, by looking at the pieces on the
+// board. Returns EmptyMove if the move cannot be played by the side to move
+func (p *Position) MoveFromCompact(m CompactMove) Move {
+	if m == EmptyCompactMove {
+		return EmptyMove
+	}
+	source := m.Source()
+	destination := m.Destination()
+	turn := p.Turn()
+
+	movingPiece := p.Board.PieceAt(source)
+	if movingPiece == NoPiece || movingPiece.Color() != turn {
+		return EmptyMove
+	}
+	capturedPiece := p.Board.PieceAt(destination)
+	if capturedPiece != NoPiece && capturedPiece.Color() == turn {
+		return EmptyMove
+	}
+
+	var tag MoveTag = 0
+	if capturedPiece != NoPiece {
+		tag |= Capture
+	}
+	switch movingPiece.Type() {
+	case King:
+		if source.File() == FileE && destination.File() == FileG {
+			tag |= KingSideCastle
+		} else if source.File() == FileE && destination.File() == FileC {
+			tag |= QueenSideCastle
+		}
+	case Pawn:
+		if destination == p.EnPassant && source.File() != destination.File() {
+			capturedPiece = GetPiece(Pawn, turn.Other())
+			tag |= Capture | EnPassant
+		}
+	}
+	return NewMove(source, destination, movingPiece, capturedPiece, m.PromoType(), tag)
+}
+
 type Status uint8
 
 const (
@@ -515,6 +500,52 @@ func (p *Position) Hash() uint64 {
 	return p.hash
 }
 
+// Clears the board, and places the given pieces on their squares. Castling and
+// en passant rights are dropped, and the hashes and PSQT values are not maintained.
+// This is meant for enumerating positions quickly, e.g. when generating tablebases.
+// Returns false if the position is illegal, i.e. the side that is not to move is in check
+func (p *Position) SetPieces(pieces []Piece, squares []Square, turn Color) bool {
+	*p.Board = Bitboard{}
+	p.MaterialsOnBoard = [12]int16{}
+	for i, piece := range pieces {
+		p.Board.UpdateSquare(squares[i], piece, NoPiece)
+		p.MaterialsOnBoard[piece-1] += 1
+	}
+	p.materialKey = MaterialKeyOf(p.MaterialsOnBoard)
+	p.EnPassant = NoSquare
+	p.HalfMoveClock = 0
+	p.hash = 0
+	p.pawnhash = 0
+	if turn == White {
+		p.Tag = WhiteToMove
+	} else {
+		p.Tag = BlackToMove
+	}
+	if isInCheck(p.Board, turn) {
+		p.SetTag(InCheck)
+	}
+	return !isInCheck(p.Board, turn.Other())
+}
+
+// A key that identifies the material on board, every piece has 4 bits that
+// hold its count. It is updated incrementally by MakeMove and UnMakeMove
+func (p *Position) MaterialKey() uint64 {
+	return p.materialKey
+}
+
+func MaterialKeyOf(materials [12]int16) uint64 {
+	var key uint64
+	for i, count := range materials {
+		key |= uint64(count) << (4 * i)
+	}
+	return key
+}
+
+// The change of the material key, when a piece is added to the board
+func pieceMaterialKey(piece Piece) uint64 {
+	return 1 << (4 * uint64(piece-1))
+}
+
 func (p *Position) MaterialAndPSQT() {
 
 	var blackCentipawnsMG, blackCentipawnsEG, whiteCentipawnsMG, whiteCentipawnsEG int16
@@ -671,6 +702,7 @@ func (p *Position) MaterialAndPSQT() {
 	p.MaterialsOnBoard[BlackQueen-1] = blackQueensCount
 	p.MaterialsOnBoard[BlackKing-1] = 1
 
+	p.materialKey = MaterialKeyOf(p.MaterialsOnBoard)
 }
 
 func findEnPassantCaptureSquare(move Move) Square {
@@ -694,6 +726,7 @@ func (p *Position) Copy() *Position {
 		p.Tag,
 		p.hash,
 		p.pawnhash,
+		p.materialKey,
 		copyMap,
 		p.HalfMoveClock,
 		mob,
@@ -703,3 +736,65 @@ func (p *Position) Copy() *Position {
 		p.BlackEndgamePSQT,
 	}
 }
+
+// Returns a new position, where the colors are swapped and the board is
+// flipped vertically. The evaluation of the mirrored position, from the point
+// of view of the side to move, should be identical to the original position
+func (p *Position) Mirror() *Position {
+	tag := p.Tag & InCheck
+	if p.HasTag(WhiteCanCastleKingSide) {
+		tag |= BlackCanCastleKingSide
+	}
+	if p.HasTag(WhiteCanCastleQueenSide) {
+		tag |= BlackCanCastleQueenSide
+	}
+	if p.HasTag(BlackCanCastleKingSide) {
+		tag |= WhiteCanCastleKingSide
+	}
+	if p.HasTag(BlackCanCastleQueenSide) {
+		tag |= WhiteCanCastleQueenSide
+	}
+	if p.HasTag(WhiteToMove) {
+		tag |= BlackToMove
+	} else {
+		tag |= WhiteToMove
+	}
+	ep := NoSquare
+	if p.EnPassant != NoSquare {
+		ep = p.EnPassant ^ 56
+	}
+	return p.transformed(p.Board.mirror(), ep, tag)
+}
+
+// Returns a new position, where the board is flipped horizontally. Castling
+// rights do not survive the flip, and are cleared
+func (p *Position) FlipHorizontal() *Position {
+	tag := p.Tag &^ (WhiteCanCastleKingSide | WhiteCanCastleQueenSide | BlackCanCastleKingSide | BlackCanCastleQueenSide)
+	ep := NoSquare
+	if p.EnPassant != NoSquare {
+		ep = p.EnPassant ^ 7
+	}
+	return p.transformed(p.Board.flipHorizontal(), ep, tag)
+}
+
+func (p *Position) transformed(board *Bitboard, ep Square, tag PositionTag) *Position {
+	var mob [12]int16
+	np := &Position{
+		board,
+		ep,
+		tag,
+		0,
+		0,
+		0,
+		make(map[uint64]int, 100),
+		p.HalfMoveClock,
+		mob,
+		0,
+		0,
+		0,
+		0,
+	}
+	np.Positions[np.Hash()] = 1
+	np.MaterialAndPSQT()
+	return np
+}
@@ -212,6 +212,25 @@ func TestIncrementalEval(t *testing.T) {
 	}
 }
 
+func TestIncrementalMaterialKey(t *testing.T) {
+	for _, pos := range positions {
+		originalKey := pos.MaterialKey()
+		for _, mov := range pos.PseudoLegalMoves() {
+			if ep, tg, hc, ok := pos.MakeMove(mov); ok {
+				incrementalKey := pos.MaterialKey()
+				freshKey := MaterialKeyOf(pos.MaterialsOnBoard)
+				pos.UnMakeMove(mov, tg, ep, hc)
+				if incrementalKey != freshKey {
+					t.Errorf("Updated material key != Fresh material key ->\nMov: %v, Fresh: %d, Incremental: %d, \nPos:%v\n", mov.ToString(), freshKey, incrementalKey, pos.Fen())
+				}
+				if pos.MaterialKey() != originalKey {
+					t.Errorf("Undone material key != original material key ->\nMov: %v, Original: %d, Decremental: %d, \nPos:%v\n", mov.ToString(), originalKey, pos.MaterialKey(), pos.Fen())
+				}
+			}
+		}
+	}
+}
+
 func getEval(p *Position) int16 {
 	var wcp, bcp int16
 	w := []int16{100, 300, 350, 400, 900, 2000}
@@ -226,3 +245,45 @@ func getEval(p *Position) int16 {
 
 	return wcp - bcp
 }
+
+func TestMirror(t *testing.T) {
+	game := FromFen("r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q2/PPPBBPpP/R3K1R1 b Qkq - 3 1")
+	mirrored := game.position.Mirror()
+	fen := mirrored.Fen()
+	expected := "r3k1r1/pppbbpPp/2n2q2/1P2p3/3pn3/BN2PNP1/P1PPQPB1/R3K2R w KQq - 3"
+	if fen != expected {
+		t.Errorf("Position was not mirrored properly\nGot: %s\n", fen)
+		t.Errorf("But expected: %s\n", expected)
+	}
+	if mirrored.Mirror().Hash() != game.position.Hash() {
+		t.Errorf("Mirroring twice does not give the original position\nGot: %s\n", mirrored.Mirror().Fen())
+	}
+	if mirrored.WhiteMiddlegamePSQT != game.position.BlackMiddlegamePSQT ||
+		mirrored.BlackEndgamePSQT != game.position.WhiteEndgamePSQT {
+		t.Errorf("PSQT values are not mirrored properly\n")
+	}
+}
+
+func TestMirrorEnPassant(t *testing.T) {
+	game := FromFen("rnbqkbnr/pPp1pppp/4P3/3pP3/4p3/5BN1/PP3PPP/RNBQK2R w KQkq d6 0 1")
+	fen := game.position.Mirror().Fen()
+	expected := "rnbqk2r/pp3ppp/5bn1/4P3/3Pp3/4p3/PpP1PPPP/RNBQKBNR b KQkq d3 0"
+	if fen != expected {
+		t.Errorf("Position was not mirrored properly\nGot: %s\n", fen)
+		t.Errorf("But expected: %s\n", expected)
+	}
+}
+
+func TestFlipHorizontal(t *testing.T) {
+	game := FromFen("rnbqkbnr/pPp1pppp/4P3/3pP3/4p3/5BN1/PP3PPP/RNBQK2R w KQkq d6 0 1")
+	flipped := game.position.FlipHorizontal()
+	fen := flipped.Fen()
+	expected := "rnbkqbnr/pppp1pPp/3P4/3Pp3/3p4/1NB5/PPP3PP/R2KQBNR w - e6 0"
+	if fen != expected {
+		t.Errorf("Position was not flipped properly\nGot: %s\n", fen)
+		t.Errorf("But expected: %s\n", expected)
+	}
+	if flipped.FlipHorizontal().Board.Fen() != game.position.Board.Fen() {
+		t.Errorf("Flipping twice does not give the original board\nGot: %s\n", flipped.FlipHorizontal().Fen())
+	}
+}
@@ -68,6 +68,22 @@ func (sq Square) Rank() Rank {
 	return Rank(sq / 8)
 }
 
+// Chebyshev distance, i.e. the number of king moves between the two squares
+func SquareDistance(a Square, b Square) int16 {
+	fileDistance := int16(a.File()) - int16(b.File())
+	rankDistance := int16(a.Rank()) - int16(b.Rank())
+	if fileDistance < 0 {
+		fileDistance = -fileDistance
+	}
+	if rankDistance < 0 {
+		rankDistance = -rankDistance
+	}
+	if fileDistance > rankDistance {
+		return fileDistance
+	}
+	return rankDistance
+}
+
 func SquareOf(file File, rank Rank) Square {
 	return Square((int(rank) * 8) + int(file))
 }
@@ -0,0 +1,147 @@
+package evaluation
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	. "github.com/amanjpro/zahak/engine"
+)
+
+// Goes through the positions of an EPD file, and verifies that:
+// - The evaluation is symmetric, i.e. a position and its mirror evaluate the same
+// - The incrementally updated material and PSQT values match a fresh computation
+// Offending positions are reported with a breakdown of the evaluation terms
+func CheckEvaluation(path string) {
+	file, err := os.Open(path)
+	if err != nil {
+		panic(err)
+	}
+	defer file.Close()
+
+	pawnhash := NewPawnCache(2)
+	materialhash := NewMaterialCache(DEFAULT_MATERIALHASH_SIZE)
+	positions := 0
+	asymmetric := 0
+	inconsistent := 0
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 {
+			continue
+		}
+		fen := fmt.Sprintf("%s 0 1", strings.Join(fields[:4], " "))
+		game := FromFen(fen)
+		pos := game.Position()
+		positions += 1
+
+		if !checkSymmetry(pos, pawnhash, materialhash) {
+			asymmetric += 1
+		}
+		if !checkIncrementalUpdates(pos) {
+			inconsistent += 1
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		panic(err)
+	}
+
+	fmt.Printf("%d positions checked\n", positions)
+	fmt.Printf("%d positions evaluate differently from their mirror\n", asymmetric)
+	fmt.Printf("%d positions have inconsistent incremental material/PSQT updates\n", inconsistent)
+}
+
+func checkSymmetry(pos *Position, pawnhash *PawnCache, materialhash *MaterialCache) bool {
+	mirror := pos.Mirror()
+	eval := Evaluate(pos, pawnhash, materialhash, NoColor, 0)
+	mirrorEval := Evaluate(mirror, pawnhash, materialhash, NoColor, 0)
+	if eval == mirrorEval {
+		return true
+	}
+
+	fmt.Printf("Asymmetric evaluation: %s\n", pos.Fen())
+	fmt.Printf("Mirrored position: %s\n", mirror.Fen())
+	fmt.Printf("Evaluation: %d, mirrored evaluation: %d\n", eval, mirrorEval)
+	fmt.Print(mirrorDifferences(TraceEvaluate(pos), TraceEvaluate(mirror)))
+	fmt.Println()
+	return false
+}
+
+// Lists the terms that differ between a position and its mirror, where white
+// of the original position is compared to black of the mirror and vice versa
+func mirrorDifferences(original EvalTrace, mirror EvalTrace) string {
+	var sb strings.Builder
+	sb.WriteString("      Term      |  White MG  Mirror  |  White EG  Mirror  |  Black MG  Mirror  |  Black EG  Mirror\n")
+	for i, term := range original.Terms {
+		o := term.Eval
+		m := mirror.Terms[i].Eval
+		if o.whiteMG == m.blackMG && o.whiteEG == m.blackEG &&
+			o.blackMG == m.whiteMG && o.blackEG == m.whiteEG {
+			continue
+		}
+		sb.WriteString(fmt.Sprintf("%15s | %9d %7d | %9d %7d | %9d %7d | %9d %7d\n", term.Name,
+			o.whiteMG, m.blackMG, o.whiteEG, m.blackEG,
+			o.blackMG, m.whiteMG, o.blackEG, m.whiteEG))
+	}
+	if original.Phase != mirror.Phase {
+		sb.WriteString(fmt.Sprintf("Phase: %d, mirrored phase: %d\n", original.Phase, mirror.Phase))
+	}
+	return sb.String()
+}
+
+func checkIncrementalUpdates(pos *Position) bool {
+	consistent := true
+	original := pos.Copy()
+	for _, move := range pos.PseudoLegalMoves() {
+		if ep, tg, hc, ok := pos.MakeMove(move); ok {
+			fresh := pos.Copy()
+			fresh.MaterialAndPSQT()
+			if diff := materialAndPSQTDifferences(pos, fresh); diff != "" {
+				fmt.Printf("Incremental update mismatch after %s in %s\n", move.ToString(), original.Fen())
+				fmt.Print(diff)
+				fmt.Println()
+				consistent = false
+			}
+			pos.UnMakeMove(move, tg, ep, hc)
+			if diff := materialAndPSQTDifferences(pos, original); diff != "" {
+				fmt.Printf("Decremental update mismatch after undoing %s in %s\n", move.ToString(), original.Fen())
+				fmt.Print(diff)
+				fmt.Println()
+				consistent = false
+			}
+		}
+	}
+	return consistent
+}
+
+func materialAndPSQTDifferences(actual *Position, expected *Position) string {
+	var sb strings.Builder
+	for i := 0; i < len(actual.MaterialsOnBoard); i++ {
+		if actual.MaterialsOnBoard[i] != expected.MaterialsOnBoard[i] {
+			sb.WriteString(fmt.Sprintf("Count of %s: %d, expected %d\n", Piece(i+1).Name(),
+				actual.MaterialsOnBoard[i], expected.MaterialsOnBoard[i]))
+		}
+	}
+	if actual.MaterialKey() != expected.MaterialKey() {
+		sb.WriteString(fmt.Sprintf("Material key: %d, expected %d\n", actual.MaterialKey(), expected.MaterialKey()))
+	}
+	psqts := []struct {
+		name     string
+		actual   int16
+		expected int16
+	}{
+		{"White middlegame PSQT", actual.WhiteMiddlegamePSQT, expected.WhiteMiddlegamePSQT},
+		{"White endgame PSQT", actual.WhiteEndgamePSQT, expected.WhiteEndgamePSQT},
+		{"Black middlegame PSQT", actual.BlackMiddlegamePSQT, expected.BlackMiddlegamePSQT},
+		{"Black endgame PSQT", actual.BlackEndgamePSQT, expected.BlackEndgamePSQT},
+	}
+	for _, psqt := range psqts {
+		if psqt.actual != psqt.expected {
+			sb.WriteString(fmt.Sprintf("%s: %d, expected %d\n", psqt.name, psqt.actual, psqt.expected))
+		}
+	}
+	return sb.String()
+}
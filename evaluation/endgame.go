@@ -0,0 +1,281 @@
+package evaluation
+
+import (
+	"math/bits"
+
+	. "github.com/amanjpro/zahak/engine"
+)
+
+// A score that is high enough to tell the search that the position is won,
+// but far from the checkmate scores
+const KnownWin int16 = 1000
+
+// Scale factors are applied to the endgame score, they are in 64ths
+const (
+	NormalScale    int16 = 64
+	DrawScale      int16 = 0
+	OppositeBishop int16 = 22
+)
+
+// Evaluates a specific endgame from the point of view of the strong side
+type endgameEvaluator func(p *Position, strong Color) int16
+
+type endgame struct {
+	name     string
+	strong   Color
+	evaluate endgameEvaluator
+}
+
+var endgames = make(map[uint64]endgame)
+
+func init() {
+	registerEndgame("KBNK", evaluateKBNK)
+	registerEndgame("KRKP", evaluateKRKP)
+	registerEndgame("KQKR", evaluateKQKR)
+	registerEndgame("KPK", evaluateKPK)
+}
+
+// Registers an endgame for both colors, the code lists the pieces of the strong
+// side followed by the pieces of the weak side, e.g. KRKP
+func registerEndgame(code string, evaluate endgameEvaluator) {
+	for _, strong := range []Color{White, Black} {
+		endgames[materialKeyOfCode(code, strong)] = endgame{code, strong, evaluate}
+	}
+}
+
+func materialKeyOfCode(code string, strong Color) uint64 {
+	var materials [12]int16
+	color := strong
+	for i, c := range code {
+		if c == 'K' && i > 0 {
+			color = color.Other()
+		}
+		var pieceType PieceType
+		switch c {
+		case 'P':
+			pieceType = Pawn
+		case 'N':
+			pieceType = Knight
+		case 'B':
+			pieceType = Bishop
+		case 'R':
+			pieceType = Rook
+		case 'Q':
+			pieceType = Queen
+		case 'K':
+			pieceType = King
+		}
+		materials[GetPiece(pieceType, color)-1] += 1
+	}
+	return MaterialKeyOf(materials)
+}
+
+// Returns the evaluation of the position relative to the side to move, if the
+// material on board has a dedicated evaluator
+func probeEndgame(p *Position) (int16, string, bool) {
+	eg, ok := endgames[p.MaterialKey()]
+	if !ok {
+		return 0, "", false
+	}
+	score := eg.evaluate(p, eg.strong)
+	if p.Turn() != eg.strong {
+		score = -score
+	}
+	return score, eg.name, true
+}
+
+func kingSquare(p *Position, color Color) Square {
+	return Square(bits.TrailingZeros64(p.Board.GetBitboardOf(GetPiece(King, color))))
+}
+
+func pieceSquare(p *Position, piece Piece) Square {
+	return Square(bits.TrailingZeros64(p.Board.GetBitboardOf(piece)))
+}
+
+// Distance of a square from the closest edge of the board
+func edgeDistance(sq Square) int16 {
+	file := int16(sq.File())
+	rank := int16(sq.Rank())
+	return min16(min16(file, 7-file), min16(rank, 7-rank))
+}
+
+// Mating with bishop and knight, the weak king has to be driven to a corner
+// of the color of the bishop
+func evaluateKBNK(p *Position, strong Color) int16 {
+	strongKing := kingSquare(p, strong)
+	weakKing := kingSquare(p, strong.Other())
+	bishop := pieceSquare(p, GetPiece(Bishop, strong))
+
+	var cornerDistance int16
+	if bishop.GetColor() == A1.GetColor() {
+		cornerDistance = min16(SquareDistance(weakKing, A1), SquareDistance(weakKing, H8))
+	} else {
+		cornerDistance = min16(SquareDistance(weakKing, A8), SquareDistance(weakKing, H1))
+	}
+
+	return KnownWin + WhiteKnight.Weight() + WhiteBishop.Weight() +
+		20*(7-cornerDistance) + 10*(7-SquareDistance(strongKing, weakKing))
+}
+
+// Rook against pawn is usually won, unless the pawn is far advanced and
+// supported by its king
+func evaluateKRKP(p *Position, strong Color) int16 {
+	weak := strong.Other()
+	strongKing := kingSquare(p, strong)
+	weakKing := kingSquare(p, weak)
+	rook := pieceSquare(p, GetPiece(Rook, strong))
+	pawn := pieceSquare(p, GetPiece(Pawn, weak))
+
+	// Ranks are relative to the weak side, the one with the pawn
+	relativeRank := func(sq Square) int16 {
+		if weak == White {
+			return int16(sq.Rank())
+		}
+		return 7 - int16(sq.Rank())
+	}
+	var push, promotion Square
+	if weak == White {
+		push = pawn + 8
+		promotion = SquareOf(pawn.File(), Rank8)
+	} else {
+		push = pawn - 8
+		promotion = SquareOf(pawn.File(), Rank1)
+	}
+	var strongTempo, weakTempo int16 = 0, 0
+	if p.Turn() == strong {
+		strongTempo = 1
+	} else {
+		weakTempo = 1
+	}
+
+	rookValue := WhiteRook.Weight()
+	if strongKing.File() == pawn.File() && relativeRank(strongKing) > relativeRank(pawn) {
+		// The strong king is in front of the pawn
+		return rookValue - SquareDistance(strongKing, pawn)
+	} else if SquareDistance(weakKing, pawn) >= 3+weakTempo && SquareDistance(weakKing, rook) >= 3 {
+		// The weak king cannot protect the pawn
+		return rookValue - SquareDistance(strongKing, pawn)
+	} else if relativeRank(weakKing) >= 5 && SquareDistance(weakKing, pawn) == 1 &&
+		relativeRank(strongKing) <= 4 && SquareDistance(strongKing, pawn) > 2+strongTempo {
+		// The pawn is far advanced and supported, while the strong king is away
+		return 80 - 8*SquareDistance(strongKing, pawn)
+	}
+	return 200 - 8*(SquareDistance(strongKing, push)-SquareDistance(weakKing, push)-SquareDistance(pawn, promotion))
+}
+
+// Queen against rook is a win, the weak king has to be driven to the edge
+func evaluateKQKR(p *Position, strong Color) int16 {
+	strongKing := kingSquare(p, strong)
+	weakKing := kingSquare(p, strong.Other())
+	return KnownWin + WhiteQueen.Weight() - WhiteRook.Weight() +
+		20*(3-edgeDistance(weakKing)) + 10*(7-SquareDistance(strongKing, weakKing))
+}
+
+// King and pawn against king is looked up in the KPK bitbase
+func evaluateKPK(p *Position, strong Color) int16 {
+	strongKing := kingSquare(p, strong)
+	weakKing := kingSquare(p, strong.Other())
+	pawn := pieceSquare(p, GetPiece(Pawn, strong))
+	if !probeKPK(strongKing, pawn, weakKing, p.Turn() == strong, strong) {
+		return 0
+	}
+	rank := int16(pawn.Rank())
+	if strong == Black {
+		rank = 7 - rank
+	}
+	return KnownWin + WhitePawn.Weight() + 10*rank
+}
+
+// Returns the scale factor of the endgame score, eg is the endgame score from
+// white's point of view
+func ScaleFactor(p *Position, eg int16) int16 {
+	strong := White
+	if eg < 0 {
+		strong = Black
+	}
+	if scale := materialScaleFactor(&p.MaterialsOnBoard, strong); scale != NormalScale {
+		return scale
+	}
+	return positionalScaleFactor(p, eg)
+}
+
+// The part of the scale factor that only depends on the material, it is
+// stored in the material hash
+func materialScaleFactor(materials *[12]int16, strong Color) int16 {
+	weak := strong.Other()
+	strongPawns := materials[GetPiece(Pawn, strong)-1]
+	strongMaterial := nonPawnMaterial(materials, strong)
+	weakMaterial := nonPawnMaterial(materials, weak)
+
+	// Without pawns, a small material advantage is not enough to win, and
+	// two knights cannot force a mate
+	if strongPawns == 0 && weakMaterial == 0 && strongMaterial == 2*WhiteKnight.Weight() &&
+		materials[GetPiece(Knight, strong)-1] == 2 {
+		return DrawScale
+	}
+	if strongPawns == 0 && strongMaterial-weakMaterial <= WhiteBishop.Weight() {
+		if strongMaterial < WhiteRook.Weight() {
+			return DrawScale
+		} else if weakMaterial <= WhiteBishop.Weight() {
+			return 4
+		}
+		return 14
+	}
+	return NormalScale
+}
+
+// The part of the scale factor that depends on where the pieces are
+func positionalScaleFactor(p *Position, eg int16) int16 {
+	strong := White
+	if eg < 0 {
+		strong = Black
+	}
+	weak := strong.Other()
+	board := p.Board
+	materials := p.MaterialsOnBoard
+
+	strongPawns := materials[GetPiece(Pawn, strong)-1]
+	strongMaterial := nonPawnMaterial(&materials, strong)
+	weakMaterial := nonPawnMaterial(&materials, weak)
+
+	// A rook pawn with a bishop that does not control the promotion square
+	if strongPawns > 0 && strongMaterial == WhiteBishop.Weight() && materials[GetPiece(Bishop, strong)-1] == 1 {
+		pawns := board.GetBitboardOf(GetPiece(Pawn, strong))
+		bishop := pieceSquare(p, GetPiece(Bishop, strong))
+		weakKing := kingSquare(p, weak)
+		for _, file := range []File{FileA, FileH} {
+			fileMask := FileFill(SquareMask[SquareOf(file, Rank1)])
+			if pawns&^fileMask != 0 {
+				continue
+			}
+			promotion := SquareOf(file, Rank8)
+			if strong == Black {
+				promotion = SquareOf(file, Rank1)
+			}
+			if promotion.GetColor() != bishop.GetColor() && SquareDistance(weakKing, promotion) <= 1 {
+				return DrawScale
+			}
+		}
+	}
+
+	// Opposite colored bishops
+	if materials[WhiteBishop-1] == 1 && materials[BlackBishop-1] == 1 {
+		whiteBishop := pieceSquare(p, WhiteBishop)
+		blackBishop := pieceSquare(p, BlackBishop)
+		if whiteBishop.GetColor() != blackBishop.GetColor() {
+			if strongMaterial == WhiteBishop.Weight() && weakMaterial == WhiteBishop.Weight() {
+				return OppositeBishop
+			}
+			return 48
+		}
+	}
+
+	return NormalScale
+}
+
+func nonPawnMaterial(materials *[12]int16, color Color) int16 {
+	return materials[GetPiece(Knight, color)-1]*WhiteKnight.Weight() +
+		materials[GetPiece(Bishop, color)-1]*WhiteBishop.Weight() +
+		materials[GetPiece(Rook, color)-1]*WhiteRook.Weight() +
+		materials[GetPiece(Queen, color)-1]*WhiteQueen.Weight()
+}
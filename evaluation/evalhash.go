@@ -0,0 +1,47 @@
+package evaluation
+
+import (
+	. "github.com/amanjpro/zahak/engine"
+)
+
+// Every entry keeps the upper 48 bits of the hash, and the 16 bit evaluation
+// in the lower bits
+const evalMask uint64 = 0xFFFF
+
+var EVAL_ENTRY_SIZE = 8
+
+type EvalCache struct {
+	items          []uint64
+	size           int
+	EvalhashMisses int64
+	EvalhashHits   int64
+}
+
+const DEFAULT_EVALHASH_SIZE = 1
+
+func (c *EvalCache) hash(key uint64) uint32 {
+	return uint32(key>>32) % uint32(len(c.items))
+}
+
+func (c *EvalCache) Set(hash uint64, eval int16) {
+	c.items[c.hash(hash)] = (hash &^ evalMask) | (uint64(uint16(eval)) & evalMask)
+}
+
+func (c *EvalCache) Size() int {
+	return c.size
+}
+
+func (c *EvalCache) Get(hash uint64) (int16, bool) {
+	item := c.items[c.hash(hash)]
+	if item != 0 && (item^hash)&^evalMask == 0 {
+		c.EvalhashHits += 1
+		return int16(item & evalMask), true
+	}
+	c.EvalhashMisses += 1
+	return 0, false
+}
+
+func NewEvalCache(megabytes int) *EvalCache {
+	size := int(megabytes * 1024 * 1024 / EVAL_ENTRY_SIZE)
+	return &EvalCache{make([]uint64, RoundPowerOfTwo(size)), megabytes, 0, 0}
+}
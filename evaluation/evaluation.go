@@ -107,28 +107,42 @@ func PSQT(piece Piece, sq Square, isEndgame bool) int16 {
 	return 0
 }
 
-func Evaluate(position *Position, pawnhash *PawnCache, weakColor Color, weakDelta int16) int16 {
-	var drawDivider int16 = 0
-	// position.MaterialAndPSQT()
+func Evaluate(position *Position, pawnhash *PawnCache, materialhash *MaterialCache, weakColor Color, weakDelta int16) int16 {
+	return evaluate(position, pawnhash, materialhash, weakColor, weakDelta, nil)
+}
+
+// Every term is recorded in the trace, when it is not nil
+func evaluate(position *Position, pawnhash *PawnCache, materialhash *MaterialCache, weakColor Color, weakDelta int16, trace *EvalTrace) int16 {
 	board := position.Board
 	turn := position.Turn()
 
-	// fetch material balance
-	whitePawnsCount := position.MaterialsOnBoard[WhitePawn-1]
-	whiteKnightsCount := position.MaterialsOnBoard[WhiteKnight-1]
-	whiteBishopsCount := position.MaterialsOnBoard[WhiteBishop-1]
-	whiteRooksCount := position.MaterialsOnBoard[WhiteRook-1]
-	whiteQueensCount := position.MaterialsOnBoard[WhiteQueen-1]
+	// Endgames with a dedicated evaluator
+	if score, name, ok := probeEndgame(position); ok {
+		if trace != nil {
+			trace.Endgame = name
+		}
+		return score
+	}
 
-	blackPawnsCount := position.MaterialsOnBoard[BlackPawn-1]
-	blackKnightsCount := position.MaterialsOnBoard[BlackKnight-1]
-	blackBishopsCount := position.MaterialsOnBoard[BlackBishop-1]
+	// Material, imbalance, phase and scale factors
+	material := CachedMaterialEval(position, materialhash)
+	if trace != nil {
+		terms := materialTerms(&position.MaterialsOnBoard)
+		trace.Terms = append(trace.Terms, terms[:]...)
+		trace.add("PSQT", Eval{
+			blackMG: position.BlackMiddlegamePSQT,
+			whiteMG: position.WhiteMiddlegamePSQT,
+			blackEG: position.BlackEndgamePSQT,
+			whiteEG: position.WhiteEndgamePSQT,
+		})
+	}
+
+	whiteRooksCount := position.MaterialsOnBoard[WhiteRook-1]
 	blackRooksCount := position.MaterialsOnBoard[BlackRook-1]
-	blackQueensCount := position.MaterialsOnBoard[BlackQueen-1]
 
 	// Fetch PSQT Rewards/Penalty
-	whiteCentipawnsMG := position.WhiteMiddlegamePSQT
-	whiteCentipawnsEG := position.WhiteEndgamePSQT
+	whiteCentipawnsMG := position.WhiteMiddlegamePSQT + material.Middlegame
+	whiteCentipawnsEG := position.WhiteEndgamePSQT + material.Endgame
 	blackCentipawnsMG := position.BlackMiddlegamePSQT
 	blackCentipawnsEG := position.BlackEndgamePSQT
 
@@ -148,17 +162,19 @@ func Evaluate(position *Position, pawnhash *PawnCache, weakColor Color, weakDelt
 	whiteKingIndex := bits.TrailingZeros64(bbWhiteKing)
 	blackKingIndex := bits.TrailingZeros64(bbBlackKing)
 
+	rookEval := RookFilesEval(bbBlackRook, bbWhiteRook, bbBlackPawn, bbWhitePawn)
+
 	// Double Rooks
 	if blackRooksCount > 1 {
 		sq := Square(bits.TrailingZeros64(bbBlackRook))
 		if board.IsVerticalDoubleRook(sq, bbBlackRook, all) {
 			// double-rook vertical
-			blackCentipawnsEG += EndgameVeritcalDoubleRookAward
-			blackCentipawnsMG += MiddlegameVeritcalDoubleRookAward
+			rookEval.blackEG += EndgameVeritcalDoubleRookAward
+			rookEval.blackMG += MiddlegameVeritcalDoubleRookAward
 		} else if board.IsHorizontalDoubleRook(sq, bbBlackRook, all) {
 			// double-rook horizontal
-			blackCentipawnsMG += MiddlegameHorizontalDoubleRookAward
-			blackCentipawnsEG += EndgameHorizontalDoubleRookAward
+			rookEval.blackMG += MiddlegameHorizontalDoubleRookAward
+			rookEval.blackEG += EndgameHorizontalDoubleRookAward
 		}
 	}
 
@@ -166,89 +182,37 @@ func Evaluate(position *Position, pawnhash *PawnCache, weakColor Color, weakDelt
 		sq := Square(bits.TrailingZeros64(bbWhiteRook))
 		if board.IsVerticalDoubleRook(sq, bbWhiteRook, all) {
 			// double-rook vertical
-			whiteCentipawnsEG += EndgameVeritcalDoubleRookAward
-			whiteCentipawnsMG += MiddlegameVeritcalDoubleRookAward
+			rookEval.whiteEG += EndgameVeritcalDoubleRookAward
+			rookEval.whiteMG += MiddlegameVeritcalDoubleRookAward
 		} else if board.IsHorizontalDoubleRook(sq, bbWhiteRook, all) {
 			// double-rook horizontal
-			whiteCentipawnsMG += MiddlegameHorizontalDoubleRookAward
-			whiteCentipawnsEG += EndgameHorizontalDoubleRookAward
+			rookEval.whiteMG += MiddlegameHorizontalDoubleRookAward
+			rookEval.whiteEG += EndgameHorizontalDoubleRookAward
 		}
 	}
 
-	// Draw scenarios
-	{
-		allPiecesCount :=
-			whitePawnsCount +
-				blackPawnsCount +
-				whiteKnightsCount +
-				blackKnightsCount +
-				whiteBishopsCount +
-				blackBishopsCount +
-				whiteRooksCount +
-				blackRooksCount +
-				whiteQueensCount +
-				blackQueensCount
-
-		if (allPiecesCount == 2 && whiteRooksCount == 1 && (blackKnightsCount == 1 || blackBishopsCount == 1)) ||
-			(allPiecesCount == 2 && blackRooksCount == 1 && (whiteKnightsCount == 1 || whiteBishopsCount == 1)) ||
-			(allPiecesCount == 2 && (blackKnightsCount == 1 || blackBishopsCount == 1) && whitePawnsCount == 1) ||
-			(allPiecesCount == 2 && (whiteKnightsCount == 1 || whiteBishopsCount == 1) && blackPawnsCount == 1) ||
-			(allPiecesCount == 3 && blackRooksCount == 1 && whiteRooksCount == 1 && (whiteKnightsCount == 1 || blackKnightsCount == 1 || blackBishopsCount == 1 || whiteBishopsCount == 1)) {
-			drawDivider = 3
-		}
-	}
+	whiteCentipawnsMG += rookEval.whiteMG
+	whiteCentipawnsEG += rookEval.whiteEG
+	blackCentipawnsMG += rookEval.blackMG
+	blackCentipawnsEG += rookEval.blackEG
+	trace.add("Rooks", rookEval)
 
-	pawnFactorMG := int16(16-blackPawnsCount-whitePawnsCount) * MiddlegamePawnFactorCoeff
-	pawnFactorEG := int16(16-blackPawnsCount-whitePawnsCount) * EndgamePawnFactorCoeff
-
-	blackCentipawnsMG += blackPawnsCount * BlackPawn.Weight()
-	blackCentipawnsMG += blackKnightsCount * (BlackKnight.Weight() - pawnFactorMG)
-	blackCentipawnsMG += blackBishopsCount * (BlackBishop.Weight())
-	blackCentipawnsMG += blackRooksCount * (BlackRook.Weight() + pawnFactorMG)
-	blackCentipawnsMG += blackQueensCount * BlackQueen.Weight()
-
-	blackCentipawnsEG += blackPawnsCount * BlackPawn.Weight()
-	blackCentipawnsEG += blackKnightsCount * (BlackKnight.Weight() - pawnFactorEG)
-	blackCentipawnsEG += blackBishopsCount * (BlackBishop.Weight())
-	blackCentipawnsEG += blackRooksCount * (BlackRook.Weight() + pawnFactorEG)
-	blackCentipawnsEG += blackQueensCount * BlackQueen.Weight()
-
-	whiteCentipawnsMG += whitePawnsCount * WhitePawn.Weight()
-	whiteCentipawnsMG += whiteKnightsCount * (WhiteKnight.Weight() - pawnFactorMG)
-	whiteCentipawnsMG += whiteBishopsCount * (WhiteBishop.Weight())
-	whiteCentipawnsMG += whiteRooksCount * (WhiteRook.Weight() + pawnFactorMG)
-	whiteCentipawnsMG += whiteQueensCount * WhiteQueen.Weight()
-
-	whiteCentipawnsEG += whitePawnsCount * WhitePawn.Weight()
-	whiteCentipawnsEG += whiteKnightsCount * (WhiteKnight.Weight() - pawnFactorEG)
-	whiteCentipawnsEG += whiteBishopsCount * (WhiteBishop.Weight())
-	whiteCentipawnsEG += whiteRooksCount * (WhiteRook.Weight() + pawnFactorEG)
-	whiteCentipawnsEG += whiteQueensCount * WhiteQueen.Weight()
-
-	// Bishop Pair
-	if whiteBishopsCount >= 2 {
-		whiteCentipawnsMG += MiddlegameBishopPairAward
-		whiteCentipawnsEG += EndgameBishopPairAward
-	}
-	if blackBishopsCount >= 2 {
-		blackCentipawnsMG += MiddlegameBishopPairAward
-		blackCentipawnsEG += EndgameBishopPairAward
-	}
+	whiteAttacks := board.AttackMapsOf(White)
+	blackAttacks := board.AttackMapsOf(Black)
 
-	mobilityEval := Mobility(position, blackKingIndex, whiteKingIndex)
+	mobilityEval := Mobility(position, blackKingIndex, whiteKingIndex, &whiteAttacks, &blackAttacks)
 
 	whiteCentipawnsMG += mobilityEval.whiteMG
 	whiteCentipawnsEG += mobilityEval.whiteEG
 	blackCentipawnsMG += mobilityEval.blackMG
 	blackCentipawnsEG += mobilityEval.blackEG
-
-	rookEval := RookFilesEval(bbBlackRook, bbWhiteRook, bbBlackPawn, bbWhitePawn)
-	whiteCentipawnsMG += rookEval.whiteMG
-	whiteCentipawnsEG += rookEval.whiteEG
-	blackCentipawnsMG += rookEval.blackMG
-	blackCentipawnsEG += rookEval.blackEG
+	trace.add("Mobility", mobilityEval)
 
 	pawnMG, pawnEG := CachedPawnStructureEval(position, pawnhash)
+	if trace != nil {
+		// The cache only keeps the difference of the two sides
+		trace.add("Pawn structure", PawnStructureEval(position))
+	}
 
 	kingSafetyEval := KingSafety(bbBlackKing, bbWhiteKing, bbBlackPawn, bbWhitePawn,
 		position.HasTag(BlackCanCastleQueenSide) || position.HasTag(BlackCanCastleKingSide),
@@ -258,26 +222,37 @@ func Evaluate(position *Position, pawnhash *PawnCache, weakColor Color, weakDelt
 	whiteCentipawnsEG += kingSafetyEval.whiteEG
 	blackCentipawnsMG += kingSafetyEval.blackMG
 	blackCentipawnsEG += kingSafetyEval.blackEG
+	trace.add("King safety", kingSafetyEval)
+
+	kingAttackEval := KingAttackEval(position, &whiteAttacks, &blackAttacks)
+	whiteCentipawnsMG += kingAttackEval.whiteMG
+	whiteCentipawnsEG += kingAttackEval.whiteEG
+	blackCentipawnsMG += kingAttackEval.blackMG
+	blackCentipawnsEG += kingAttackEval.blackEG
+	trace.add("King attacks", kingAttackEval)
+
+	threatsEval := ThreatsEval(position, &whiteAttacks, &blackAttacks)
+	whiteCentipawnsMG += threatsEval.whiteMG
+	whiteCentipawnsEG += threatsEval.whiteEG
+	blackCentipawnsMG += threatsEval.blackMG
+	blackCentipawnsEG += threatsEval.blackEG
+	trace.add("Threats", threatsEval)
+
+	passedPawnEval := PassedPawnEval(position, &whiteAttacks, &blackAttacks)
+	whiteCentipawnsMG += passedPawnEval.whiteMG
+	whiteCentipawnsEG += passedPawnEval.whiteEG
+	blackCentipawnsMG += passedPawnEval.blackMG
+	blackCentipawnsEG += passedPawnEval.blackEG
+	trace.add("Passed pawns", passedPawnEval)
 
 	knightOutpostEval := KnightOutpostEval(position)
 	whiteCentipawnsMG += knightOutpostEval.whiteMG
 	whiteCentipawnsEG += knightOutpostEval.whiteEG
 	blackCentipawnsMG += knightOutpostEval.blackMG
 	blackCentipawnsEG += knightOutpostEval.blackEG
+	trace.add("Knight outposts", knightOutpostEval)
 
-	phase := TotalPhase -
-		whitePawnsCount*PawnPhase -
-		blackPawnsCount*PawnPhase -
-		whiteKnightsCount*KnightPhase -
-		blackKnightsCount*KnightPhase -
-		whiteBishopsCount*BishopPhase -
-		blackBishopsCount*BishopPhase -
-		whiteRooksCount*RookPhase -
-		blackRooksCount*RookPhase -
-		whiteQueensCount*QueenPhase -
-		blackQueensCount*QueenPhase
-
-	phase = (phase*256 + HalfPhase) / TotalPhase
+	phase := material.Phase
 
 	var evalEG, evalMG int16
 
@@ -301,14 +276,155 @@ func Evaluate(position *Position, pawnhash *PawnCache, weakColor Color, weakDelt
 		}
 	}
 
+	// Drawish endgames
+	whiteEG := evalEG
+	if turn == Black {
+		whiteEG = -evalEG
+	}
+	scale := material.WhiteScale
+	if whiteEG < 0 {
+		scale = material.BlackScale
+	}
+	if scale == NormalScale {
+		scale = positionalScaleFactor(position, whiteEG)
+	}
+
 	// The following formula overflows if I do not convert to int32 first
 	// then I have to convert back to int16, as the function return requires
 	// and that is also safe, due to the division
 	mg := int32(evalMG)
-	eg := int32(evalEG)
+	eg := int32(evalEG) * int32(scale) / int32(NormalScale)
 	phs := int32(phase)
 	taperedEval := int16(((mg * (256 - phs)) + eg*phs) / 256)
-	return toEval(taperedEval+Tempo) >> drawDivider
+
+	if trace != nil {
+		tempo := Eval{}
+		if turn == White {
+			tempo.whiteMG = Tempo
+			tempo.whiteEG = Tempo
+		} else {
+			tempo.blackMG = Tempo
+			tempo.blackEG = Tempo
+		}
+		trace.add("Tempo", tempo)
+		trace.Phase = phase
+		trace.DrawDivider = material.DrawDivider
+		trace.ScaleFactor = scale
+	}
+	return toEval(taperedEval+Tempo) >> material.DrawDivider
+}
+
+// The value of the pieces, knights lose value and rooks gain value as pawns
+// disappear from the board
+func MaterialBalance(materials *[12]int16) Eval {
+	pawns := materials[WhitePawn-1] + materials[BlackPawn-1]
+	pawnFactorMG := (16 - pawns) * MiddlegamePawnFactorCoeff
+	pawnFactorEG := (16 - pawns) * EndgamePawnFactorCoeff
+	return Eval{
+		blackMG: sideMaterial(materials, Black, pawnFactorMG),
+		whiteMG: sideMaterial(materials, White, pawnFactorMG),
+		blackEG: sideMaterial(materials, Black, pawnFactorEG),
+		whiteEG: sideMaterial(materials, White, pawnFactorEG),
+	}
+}
+
+func sideMaterial(materials *[12]int16, color Color, pawnFactor int16) int16 {
+	return materials[GetPiece(Pawn, color)-1]*WhitePawn.Weight() +
+		materials[GetPiece(Knight, color)-1]*(WhiteKnight.Weight()-pawnFactor) +
+		materials[GetPiece(Bishop, color)-1]*WhiteBishop.Weight() +
+		materials[GetPiece(Rook, color)-1]*(WhiteRook.Weight()+pawnFactor) +
+		materials[GetPiece(Queen, color)-1]*WhiteQueen.Weight()
+}
+
+func BishopPairEval(materials *[12]int16) Eval {
+	var blackMG, whiteMG, blackEG, whiteEG int16
+	if materials[WhiteBishop-1] >= 2 {
+		whiteMG = MiddlegameBishopPairAward
+		whiteEG = EndgameBishopPairAward
+	}
+	if materials[BlackBishop-1] >= 2 {
+		blackMG = MiddlegameBishopPairAward
+		blackEG = EndgameBishopPairAward
+	}
+	return Eval{blackMG: blackMG, whiteMG: whiteMG, blackEG: blackEG, whiteEG: whiteEG}
+}
+
+// Major pieces are partly redundant, and the bishop pair is stronger when the
+// opponent has no minor pieces to challenge it
+func ImbalanceEval(materials *[12]int16) Eval {
+	whiteMG, whiteEG := imbalance(materials, White)
+	blackMG, blackEG := imbalance(materials, Black)
+	return Eval{blackMG: blackMG, whiteMG: whiteMG, blackEG: blackEG, whiteEG: whiteEG}
+}
+
+func imbalance(materials *[12]int16, color Color) (int16, int16) {
+	var mg, eg int16
+	other := color.Other()
+	rooks := materials[GetPiece(Rook, color)-1]
+	queens := materials[GetPiece(Queen, color)-1]
+	bishops := materials[GetPiece(Bishop, color)-1]
+	enemyMinors := materials[GetPiece(Knight, other)-1] + materials[GetPiece(Bishop, other)-1]
+
+	if rooks >= 2 {
+		mg -= MiddlegameRookRedundancyPenalty
+		eg -= EndgameRookRedundancyPenalty
+	}
+	if queens >= 1 && rooks >= 1 {
+		mg -= MiddlegameQueenRookRedundancyPenalty
+		eg -= EndgameQueenRookRedundancyPenalty
+	}
+	if bishops >= 2 && enemyMinors == 0 {
+		mg += MiddlegameUncontestedBishopPairAward
+		eg += EndgameUncontestedBishopPairAward
+	}
+	return mg, eg
+}
+
+// The phase of the game, 0 is the middlegame and 256 is the endgame
+func GamePhase(materials *[12]int16) int16 {
+	phase := TotalPhase -
+		(materials[WhitePawn-1]+materials[BlackPawn-1])*PawnPhase -
+		(materials[WhiteKnight-1]+materials[BlackKnight-1])*KnightPhase -
+		(materials[WhiteBishop-1]+materials[BlackBishop-1])*BishopPhase -
+		(materials[WhiteRook-1]+materials[BlackRook-1])*RookPhase -
+		(materials[WhiteQueen-1]+materials[BlackQueen-1])*QueenPhase
+	return (phase*256 + HalfPhase) / TotalPhase
+}
+
+// Drawish material, the evaluation is shifted right by the returned value
+func drawDivider(materials *[12]int16) int16 {
+	whitePawnsCount := materials[WhitePawn-1]
+	whiteKnightsCount := materials[WhiteKnight-1]
+	whiteBishopsCount := materials[WhiteBishop-1]
+	whiteRooksCount := materials[WhiteRook-1]
+	whiteQueensCount := materials[WhiteQueen-1]
+
+	blackPawnsCount := materials[BlackPawn-1]
+	blackKnightsCount := materials[BlackKnight-1]
+	blackBishopsCount := materials[BlackBishop-1]
+	blackRooksCount := materials[BlackRook-1]
+	blackQueensCount := materials[BlackQueen-1]
+
+	allPiecesCount :=
+		whitePawnsCount +
+			blackPawnsCount +
+			whiteKnightsCount +
+			blackKnightsCount +
+			whiteBishopsCount +
+			blackBishopsCount +
+			whiteRooksCount +
+			blackRooksCount +
+			whiteQueensCount +
+			blackQueensCount
+
+	if (allPiecesCount == 2 && whiteRooksCount == 1 && (blackKnightsCount == 1 || blackBishopsCount == 1)) ||
+		(allPiecesCount == 2 && blackRooksCount == 1 && (whiteKnightsCount == 1 || whiteBishopsCount == 1)) ||
+		(allPiecesCount == 2 && (blackKnightsCount == 1 || blackBishopsCount == 1) && whitePawnsCount == 1) ||
+		(allPiecesCount == 2 && (whiteKnightsCount == 1 || whiteBishopsCount == 1) && blackPawnsCount == 1) ||
+		(allPiecesCount == 3 && blackRooksCount == 1 && whiteRooksCount == 1 && (whiteKnightsCount == 1 || blackKnightsCount == 1 || blackBishopsCount == 1 || whiteBishopsCount == 1)) {
+		return 3
+	}
+	return 0
 }
 
 func KnightOutpostEval(p *Position) Eval {
@@ -365,18 +481,21 @@ func RookFilesEval(blackRook uint64, whiteRook uint64, blackPawns uint64, whiteP
 	return Eval{blackMG: blackMG, whiteMG: whiteMG, blackEG: blackEG, whiteEG: whiteEG}
 }
 
+// A nil cache always computes the values
 func CachedPawnStructureEval(p *Position, pawnhash *PawnCache) (int16, int16) {
 	hash := p.Pawnhash()
-	mg, eg, ok := pawnhash.Get(hash)
-
-	if ok {
-		return mg, eg
+	if pawnhash != nil {
+		if mg, eg, ok := pawnhash.Get(hash); ok {
+			return mg, eg
+		}
 	}
 
 	eval := PawnStructureEval(p)
-	mg = eval.whiteMG - eval.blackMG
-	eg = eval.whiteEG - eval.blackEG
-	pawnhash.Set(hash, mg, eg)
+	mg := eval.whiteMG - eval.blackMG
+	eg := eval.whiteEG - eval.blackEG
+	if pawnhash != nil {
+		pawnhash.Set(hash, mg, eg)
+	}
 
 	return mg, eg
 }
@@ -572,13 +691,90 @@ func KingSafety(blackKing uint64, whiteKing uint64, blackPawn uint64,
 	return Eval{blackMG: blackCentipawnsMG, whiteMG: whiteCentipawnsMG, blackEG: blackCentipawnsEG, whiteEG: whiteCentipawnsEG}
 }
 
-func Mobility(p *Position, blackKingIndex int, whiteKingIndex int) Eval {
-	board := p.Board
+// Attack-unit model, every attacker, attacked square near the king, safe check
+// and open file adds to the danger, and the danger grows quadratically in middlegame
+func KingAttackEval(p *Position, white *AttackMaps, black *AttackMaps) Eval {
+	whiteAttack, blackAttack := p.Board.KingAttacks(white, black)
+	whiteMG, whiteEG := kingAttackScore(&whiteAttack)
+	blackMG, blackEG := kingAttackScore(&blackAttack)
+	return Eval{blackMG: blackMG, whiteMG: whiteMG, blackEG: blackEG, whiteEG: whiteEG}
+}
+
+func kingAttackScore(info *KingAttackInfo) (int16, int16) {
+	// A single attacker, unless it is the queen, is rarely dangerous
+	if info.Attackers() < 2 && info.QueenAttackers == 0 {
+		return 0, 0
+	}
+	units := int32(KnightKingAttackWeight)*int32(info.KnightAttackers) +
+		int32(BishopKingAttackWeight)*int32(info.BishopAttackers) +
+		int32(RookKingAttackWeight)*int32(info.RookAttackers) +
+		int32(QueenKingAttackWeight)*int32(info.QueenAttackers) +
+		int32(InnerRingAttackWeight)*int32(info.InnerRingAttacks) +
+		int32(OuterRingAttackWeight)*int32(info.OuterRingAttacks) +
+		int32(KnightSafeCheckWeight)*int32(info.KnightSafeChecks) +
+		int32(BishopSafeCheckWeight)*int32(info.BishopSafeChecks) +
+		int32(RookSafeCheckWeight)*int32(info.RookSafeChecks) +
+		int32(QueenSafeCheckWeight)*int32(info.QueenSafeChecks) +
+		int32(KingOpenFileWeight)*int32(info.OpenFiles) +
+		int32(KingSemiOpenFileWeight)*int32(info.SemiOpenFiles)
+	if units <= 0 {
+		return 0, 0
+	}
+	if units > 100 {
+		units = 100
+	}
+	mg := units * units * int32(MiddlegameKingAttackScale) / 1024
+	eg := units * int32(EndgameKingAttackScale) / 16
+	return int16(mg), int16(eg)
+}
+
+// The piece dependent part of passed pawn evaluation, the rank based part is
+// in PawnStructureEval, so that it can be cached
+func PassedPawnEval(p *Position, white *AttackMaps, black *AttackMaps) Eval {
+	whiteInfo, blackInfo := p.PassedPawns(white, black)
+	whiteMG, whiteEG := passedPawnScore(&whiteInfo)
+	blackMG, blackEG := passedPawnScore(&blackInfo)
+	return Eval{blackMG: blackMG, whiteMG: whiteMG, blackEG: blackEG, whiteEG: whiteEG}
+}
+
+func passedPawnScore(info *PassedPawnInfo) (int16, int16) {
+	mg := info.FreeAdvance*MiddlegameFreePassedPawnAward +
+		info.SafePath*MiddlegameSafePassedPawnAward -
+		info.Blockaded*MiddlegameBlockadedPassedPawnPenalty
+	eg := info.EnemyKingDistance*EndgameEnemyKingPassedPawnDistanceAward -
+		info.OwnKingDistance*EndgameOwnKingPassedPawnDistancePenalty +
+		info.FreeAdvance*EndgameFreePassedPawnAward +
+		info.SafePath*EndgameSafePassedPawnAward -
+		info.Blockaded*EndgameBlockadedPassedPawnPenalty +
+		info.Unstoppable*EndgameUnstoppablePassedPawnAward
+	return mg, eg
+}
+
+func ThreatsEval(p *Position, white *AttackMaps, black *AttackMaps) Eval {
+	whiteThreats, blackThreats := p.Board.Threats(white, black)
+	whiteMG, whiteEG := threatsScore(&whiteThreats)
+	blackMG, blackEG := threatsScore(&blackThreats)
+	return Eval{blackMG: blackMG, whiteMG: whiteMG, blackEG: blackEG, whiteEG: whiteEG}
+}
+
+func threatsScore(info *ThreatInfo) (int16, int16) {
+	mg := info.PawnThreats*MiddlegamePawnThreatAward +
+		info.MinorThreats*MiddlegameMinorThreatAward +
+		info.HangingPieces*MiddlegameHangingPieceAward +
+		info.PawnPushThreats*MiddlegamePawnPushThreatAward
+	eg := info.PawnThreats*EndgamePawnThreatAward +
+		info.MinorThreats*EndgameMinorThreatAward +
+		info.HangingPieces*EndgameHangingPieceAward +
+		info.PawnPushThreats*EndgamePawnPushThreatAward
+	return mg, eg
+}
+
+func Mobility(p *Position, blackKingIndex int, whiteKingIndex int, white *AttackMaps, black *AttackMaps) Eval {
 	var whiteCentipawnsMG, whiteCentipawnsEG, blackCentipawnsMG, blackCentipawnsEG int16
 
 	// mobility and attacks
-	whitePawnAttacks, whiteMinorAttacks, whiteMajorAttacks := board.AllAttacks(White) // get the squares that are attacked by white
-	blackPawnAttacks, blackMinorAttacks, blackMajorAttacks := board.AllAttacks(Black) // get the squares that are attacked by black
+	whitePawnAttacks, whiteMinorAttacks, whiteMajorAttacks := white.Groups() // get the squares that are attacked by white
+	blackPawnAttacks, blackMinorAttacks, blackMajorAttacks := black.Groups() // get the squares that are attacked by black
 
 	blackKingZone := SquareInnerRingMask[blackKingIndex] | SquareOuterRingMask[blackKingIndex]
 	whiteKingZone := SquareInnerRingMask[whiteKingIndex] | SquareOuterRingMask[whiteKingIndex]
@@ -11,7 +11,7 @@ func TestMaterialValue(t *testing.T) {
 	fen := "rnb2bnr/ppqppkpp/8/2p5/4P3/8/PPPP1PPP/RNB1KBNR w KQ - 0 1"
 	game := FromFen(fen)
 
-	actual := Evaluate(game.Position(), NewPawnCache(DEFAULT_PAWNHASH_SIZE), NoColor, 0)
+	actual := Evaluate(game.Position(), NewPawnCache(DEFAULT_PAWNHASH_SIZE), NewMaterialCache(DEFAULT_MATERIALHASH_SIZE), NoColor, 0)
 
 	if actual >= 0 {
 		t.Errorf("Expected: a negative number\nGot: %d\n", actual)
@@ -21,7 +21,7 @@ func TestMaterialValue(t *testing.T) {
 
 	game = FromFen(fen)
 
-	actual = Evaluate(game.Position(), NewPawnCache(DEFAULT_PAWNHASH_SIZE), NoColor, 0)
+	actual = Evaluate(game.Position(), NewPawnCache(DEFAULT_PAWNHASH_SIZE), NewMaterialCache(DEFAULT_MATERIALHASH_SIZE), NoColor, 0)
 
 	if actual <= 0 {
 		t.Errorf("Expected: a positive number\nGot: %d\n", actual)
@@ -30,7 +30,7 @@ func TestMaterialValue(t *testing.T) {
 	fen = "2k2b1r/ppp1pppp/4b3/1P6/2P3P1/3BKP1P/7B/1R4N1 b - - 0 23"
 	game = FromFen(fen)
 
-	actual = Evaluate(game.Position(), NewPawnCache(DEFAULT_PAWNHASH_SIZE), NoColor, 0)
+	actual = Evaluate(game.Position(), NewPawnCache(DEFAULT_PAWNHASH_SIZE), NewMaterialCache(DEFAULT_MATERIALHASH_SIZE), NoColor, 0)
 
 	if actual >= 0 {
 		t.Errorf("Expected: a negative number\nGot: %d\n", actual)
@@ -74,7 +74,7 @@ func TestPawnStructureEval(t *testing.T) {
 	fen := "k7/4pp2/6p1/8/8/4P1P1/5P2/K7 w - - 0 1"
 	game := FromFen(fen)
 
-	actual := Evaluate(game.Position(), NewPawnCache(DEFAULT_PAWNHASH_SIZE), NoColor, 0)
+	actual := Evaluate(game.Position(), NewPawnCache(DEFAULT_PAWNHASH_SIZE), NewMaterialCache(DEFAULT_MATERIALHASH_SIZE), NoColor, 0)
 	expected := int16(-9)
 
 	if actual != expected {
@@ -85,7 +85,7 @@ func TestPawnStructureEval(t *testing.T) {
 	fen = "k7/5p2/4p1p1/8/8/6P1/4PP2/K7 b - - 0 1"
 	game = FromFen(fen)
 
-	actual = Evaluate(game.Position(), NewPawnCache(DEFAULT_PAWNHASH_SIZE), NoColor, 0)
+	actual = Evaluate(game.Position(), NewPawnCache(DEFAULT_PAWNHASH_SIZE), NewMaterialCache(DEFAULT_MATERIALHASH_SIZE), NoColor, 0)
 	expected = int16(-9)
 
 	if actual != expected {
@@ -98,7 +98,7 @@ func TestRookStructureEval(t *testing.T) {
 	fen := "k4r2/5p2/8/8/8/8/4P3/K4R2 w - - 0 1"
 	game := FromFen(fen)
 
-	actual := Evaluate(game.Position(), NewPawnCache(DEFAULT_PAWNHASH_SIZE), NoColor, 0)
+	actual := Evaluate(game.Position(), NewPawnCache(DEFAULT_PAWNHASH_SIZE), NewMaterialCache(DEFAULT_MATERIALHASH_SIZE), NoColor, 0)
 	expected := int16(50)
 
 	if actual != expected {
@@ -109,7 +109,7 @@ func TestRookStructureEval(t *testing.T) {
 	fen = "k4r2/4p3/8/8/8/8/5P2/K4R2 b - - 0 1"
 	game = FromFen(fen)
 
-	actual = Evaluate(game.Position(), NewPawnCache(DEFAULT_PAWNHASH_SIZE), NoColor, 0)
+	actual = Evaluate(game.Position(), NewPawnCache(DEFAULT_PAWNHASH_SIZE), NewMaterialCache(DEFAULT_MATERIALHASH_SIZE), NoColor, 0)
 	expected = int16(50)
 
 	if actual != expected {
@@ -232,3 +232,246 @@ func TestKingSafetyBlackNotCastling(t *testing.T) {
 		t.Errorf(err)
 	}
 }
+
+func TestKingAttackEval(t *testing.T) {
+	fen := "r4rk1/ppp2ppp/8/6N1/7Q/8/PPP2PPP/R5K1 w - - 0 1"
+	game := FromFen(fen)
+
+	board := game.Position().Board
+	white, black := board.AttackMapsOf(White), board.AttackMapsOf(Black)
+	info, _ := board.KingAttacks(&white, &black)
+	if info.QueenAttackers != 1 || info.KnightAttackers != 1 {
+		err := fmt.Sprintf("Expected: a queen and a knight attacking the king\nGot: %v\n", info)
+		t.Errorf(err)
+	}
+
+	actual := KingAttackEval(game.Position(), &white, &black)
+	if actual.whiteMG <= 0 || actual.blackMG != 0 {
+		err := fmt.Sprintf("Expected: only white to get a king attack bonus\nGot: %d\n", actual)
+		t.Errorf(err)
+	}
+
+	fen = "r4rk1/ppp2ppp/8/8/8/8/PPP2PPP/R5K1 w - - 0 1"
+	game = FromFen(fen)
+	board = game.Position().Board
+	white, black = board.AttackMapsOf(White), board.AttackMapsOf(Black)
+
+	actual = KingAttackEval(game.Position(), &white, &black)
+	expected := Eval{}
+	if actual != expected {
+		err := fmt.Sprintf("Expected: %d\nGot: %d\n", expected, actual)
+		t.Errorf(err)
+	}
+}
+
+func TestTraceEvaluateMatchesEvaluate(t *testing.T) {
+	fens := []string{
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1",
+		"rnb2bnr/ppqppkpp/8/2p5/4P3/8/PPPP1PPP/RNB1KBNR w KQ - 0 1",
+		"3N1k2/N7/1p2ppR1/1P6/P2pP3/3Pb3/1K5n/8 w - - 0 4",
+		"2k2b1r/ppp1pppp/4b3/1P6/2P3P1/3BKP1P/7B/1R4N1 b - - 0 23",
+		"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q2/PPPBBPpP/R3K2R b KQkq - 0 1",
+		"8/8/4k3/8/8/3KR3/8/5n2 w - - 0 1",
+	}
+
+	for _, fen := range fens {
+		game := FromFen(fen)
+		expected := Evaluate(game.Position(), NewPawnCache(DEFAULT_PAWNHASH_SIZE), NewMaterialCache(DEFAULT_MATERIALHASH_SIZE), NoColor, 0)
+		actual := TraceEvaluate(game.Position()).Eval
+		if actual != expected {
+			t.Errorf("Trace does not match the evaluation of %s%s", fen, fmt.Sprintf("\nExpected: %d\nGot: %d\n", expected, actual))
+		}
+	}
+}
+
+func TestTraceTermsAddUpToTheEvaluation(t *testing.T) {
+	fens := []string{
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1",
+		"rnb2bnr/ppqppkpp/8/2p5/4P3/8/PPPP1PPP/RNB1KBNR w KQ - 0 1",
+		"3N1k2/N7/1p2ppR1/1P6/P2pP3/3Pb3/1K5n/8 w - - 0 4",
+		"2k2b1r/ppp1pppp/4b3/1P6/2P3P1/3BKP1P/7B/1R4N1 b - - 0 23",
+		"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q2/PPPBBPpP/R3K2R b KQkq - 0 1",
+	}
+
+	for _, fen := range fens {
+		game := FromFen(fen)
+		trace := TraceEvaluate(game.Position())
+		var mg, eg int32
+		for _, term := range trace.Terms {
+			if term.Name == "Tempo" {
+				continue
+			}
+			mg += int32(term.Eval.whiteMG - term.Eval.blackMG)
+			eg += int32(term.Eval.whiteEG - term.Eval.blackEG)
+		}
+		if trace.Turn == Black {
+			mg, eg = -mg, -eg
+		}
+		eg = eg * int32(trace.ScaleFactor) / int32(NormalScale)
+		phase := int32(trace.Phase)
+		tapered := int16((mg*(256-phase) + eg*phase) / 256)
+		actual := toEval(tapered+Tempo) >> trace.DrawDivider
+		expected := Evaluate(game.Position(), NewPawnCache(DEFAULT_PAWNHASH_SIZE), NewMaterialCache(DEFAULT_MATERIALHASH_SIZE), NoColor, 0)
+		if actual != expected {
+			t.Errorf("Trace terms do not add up to the evaluation of %s%s", fen, fmt.Sprintf("\nExpected: %d\nGot: %d\n", expected, actual))
+		}
+	}
+}
+
+func TestEvaluationIsSymmetric(t *testing.T) {
+	fens := []string{
+		"rnb2bnr/ppqppkpp/8/2p5/4P3/8/PPPP1PPP/RNB1KBNR w KQ - 0 1",
+		"3N1k2/N7/1p2ppR1/1P6/P2pP3/3Pb3/1K5n/8 w - - 0 4",
+		"2k2b1r/ppp1pppp/4b3/1P6/2P3P1/3BKP1P/7B/1R4N1 b - - 0 23",
+		"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q2/PPPBBPpP/R3K2R b KQkq - 0 1",
+	}
+
+	for _, fen := range fens {
+		game := FromFen(fen)
+		pos := game.Position()
+		expected := Evaluate(pos, NewPawnCache(DEFAULT_PAWNHASH_SIZE), NewMaterialCache(DEFAULT_MATERIALHASH_SIZE), NoColor, 0)
+		actual := Evaluate(pos.Mirror(), NewPawnCache(DEFAULT_PAWNHASH_SIZE), NewMaterialCache(DEFAULT_MATERIALHASH_SIZE), NoColor, 0)
+		if actual != expected {
+			t.Errorf("Mirrored position evaluates differently %s%s", fen, fmt.Sprintf("\nExpected: %d\nGot: %d\n", expected, actual))
+		}
+	}
+}
+
+func TestKPK(t *testing.T) {
+	tests := []struct {
+		fen string
+		win bool
+	}{
+		{"4k3/8/4K3/4P3/8/8/8/8 w - - 0 1", true},
+		{"4k3/8/4K3/4P3/8/8/8/8 b - - 0 1", true},
+		{"4k3/4P3/4K3/8/8/8/8/8 w - - 0 1", true},
+		{"4k3/4P3/4K3/8/8/8/8/8 b - - 0 1", false},
+		{"k7/8/8/8/8/8/P7/7K w - - 0 1", false},
+		{"8/8/8/8/P7/8/8/k6K w - - 0 1", true},
+		{"8/8/8/8/8/4k3/4p3/4K3 w - - 0 1", false},
+		{"8/8/8/4p3/4k3/8/8/4K3 b - - 0 1", true},
+	}
+
+	for _, test := range tests {
+		game := FromFen(test.fen)
+		eval := Evaluate(game.Position(), NewPawnCache(DEFAULT_PAWNHASH_SIZE), NewMaterialCache(DEFAULT_MATERIALHASH_SIZE), NoColor, 0)
+		if test.win && eval < KnownWin && eval > -KnownWin {
+			t.Errorf("Expected a win in %s\nGot: %d\n", test.fen, eval)
+		}
+		if !test.win && eval != 0 {
+			t.Errorf("Expected a draw in %s\nGot: %d\n", test.fen, eval)
+		}
+	}
+}
+
+func TestKBNKDrivesToTheBishopCorner(t *testing.T) {
+	pawnhash := NewPawnCache(DEFAULT_PAWNHASH_SIZE)
+	game := FromFen("7k/8/5K2/8/8/8/8/4BN2 w - - 0 1")
+	rightCorner := Evaluate(game.Position(), pawnhash, nil, NoColor, 0)
+	game = FromFen("k7/8/2K5/8/8/8/8/4BN2 w - - 0 1")
+	wrongCorner := Evaluate(game.Position(), pawnhash, nil, NoColor, 0)
+
+	if rightCorner < KnownWin || wrongCorner < KnownWin || rightCorner <= wrongCorner {
+		t.Errorf("Expected: %d > %d > %d\n", rightCorner, wrongCorner, KnownWin)
+	}
+}
+
+func TestScaleFactor(t *testing.T) {
+	tests := []struct {
+		fen      string
+		eg       int16
+		expected int16
+	}{
+		{"8/8/4k3/8/8/3KR3/8/5n2 w - - 0 1", 100, 4},
+		{"8/8/4k3/8/8/3K4/8/3NN3 w - - 0 1", 100, DrawScale},
+		{"k7/8/8/8/P7/P7/8/2BK4 w - - 0 1", 100, DrawScale},
+		{"k7/8/8/8/P7/P7/8/1B1K4 w - - 0 1", 100, NormalScale},
+		{"4k3/2b2ppp/8/8/8/8/4BPPP/4K3 w - - 0 1", 100, OppositeBishop},
+		{"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", 100, NormalScale},
+	}
+
+	for _, test := range tests {
+		game := FromFen(test.fen)
+		actual := ScaleFactor(game.Position(), test.eg)
+		if actual != test.expected {
+			t.Errorf("Scale factor of %s\nExpected: %d\nGot: %d\n", test.fen, test.expected, actual)
+		}
+	}
+}
+
+func TestMaterialCache(t *testing.T) {
+	materialhash := NewMaterialCache(DEFAULT_MATERIALHASH_SIZE)
+	game := FromFen("r1bqkb1r/pppp1ppp/2n2n2/4p3/2B1P3/5N2/PPPP1PPP/RNBQK2R w KQkq - 4 4")
+	pos := game.Position()
+
+	expected := computeMaterialEval(&pos.MaterialsOnBoard)
+	expected.Key = pos.MaterialKey()
+	first := CachedMaterialEval(pos, materialhash)
+	second := CachedMaterialEval(pos, materialhash)
+	if first != expected || second != expected {
+		t.Errorf("Expected: %v\nGot: %v and %v\n", expected, first, second)
+	}
+	if materialhash.MaterialhashMisses != 1 || materialhash.MaterialhashHits != 1 {
+		t.Errorf("Expected one miss and one hit\nGot: %d misses and %d hits\n",
+			materialhash.MaterialhashMisses, materialhash.MaterialhashHits)
+	}
+}
+
+func TestImbalanceEval(t *testing.T) {
+	// The bishop pair of white is not challenged by black minor pieces, but its rooks are redundant
+	game := FromFen("3qk3/8/8/8/8/8/8/R2BKB1R w - - 0 1")
+	actual := ImbalanceEval(&game.Position().MaterialsOnBoard)
+	expected := Eval{
+		blackMG: 0,
+		whiteMG: MiddlegameUncontestedBishopPairAward - MiddlegameRookRedundancyPenalty,
+		blackEG: 0,
+		whiteEG: EndgameUncontestedBishopPairAward - EndgameRookRedundancyPenalty,
+	}
+	if actual != expected {
+		t.Errorf("Expected: %v\nGot: %v\n", expected, actual)
+	}
+
+	game = FromFen("r2qk3/8/8/8/8/8/8/R2BKB1R w - - 0 1")
+	actual = ImbalanceEval(&game.Position().MaterialsOnBoard)
+	expected = Eval{
+		blackMG: -MiddlegameQueenRookRedundancyPenalty,
+		whiteMG: MiddlegameUncontestedBishopPairAward - MiddlegameRookRedundancyPenalty,
+		blackEG: -EndgameQueenRookRedundancyPenalty,
+		whiteEG: EndgameUncontestedBishopPairAward - EndgameRookRedundancyPenalty,
+	}
+	if actual != expected {
+		t.Errorf("Expected: %v\nGot: %v\n", expected, actual)
+	}
+}
+
+func TestEvalCache(t *testing.T) {
+	evalhash := NewEvalCache(DEFAULT_EVALHASH_SIZE)
+	hash := uint64(0xABCDEF0123456789)
+	if _, ok := evalhash.Get(hash); ok {
+		t.Errorf("Expected a miss in an empty cache\n")
+	}
+	for _, expected := range []int16{-MAX_INT, -1, 0, 37, MAX_INT} {
+		evalhash.Set(hash, expected)
+		actual, ok := evalhash.Get(hash)
+		if !ok || actual != expected {
+			t.Errorf("Expected: %d\nGot: %d, %t\n", expected, actual, ok)
+		}
+	}
+	if _, ok := evalhash.Get(hash ^ (1 << 63)); ok {
+		t.Errorf("Expected a miss for a different hash\n")
+	}
+}
+
+func TestWinProbability(t *testing.T) {
+	if p := WinProbability(0, 1); p != 0.5 {
+		t.Errorf("Expected an even position to be a draw\nGot: %f\n", p)
+	}
+	if WinProbability(100, 1) <= WinProbability(50, 1) || WinProbability(-100, 1) >= 0.5 {
+		t.Errorf("Expected the win probability to grow with the evaluation\n")
+	}
+	for _, eval := range []int16{-800, -120, 0, 35, 400} {
+		if actual := EvalFromWinProbability(WinProbability(eval, 1.2), 1.2); actual-eval > 1 || eval-actual > 1 {
+			t.Errorf("Expected: %d\nGot: %d\n", eval, actual)
+		}
+	}
+}
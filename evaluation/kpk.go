@@ -0,0 +1,155 @@
+package evaluation
+
+import (
+	"sync"
+
+	. "github.com/amanjpro/zahak/engine"
+)
+
+// KPK bitbase, it is generated by retrograde analysis the first time it is needed.
+// The positions are normalized so that white has the pawn, and the pawn is on
+// files A to D. The idea is taken from Stockfish.
+
+const (
+	kpkInvalid uint8 = 0
+	kpkUnknown uint8 = 1
+	kpkDraw    uint8 = 2
+	kpkWin     uint8 = 4
+)
+
+// stm * file * rank * white king * black king
+const kpkSize = 2 * 4 * 6 * 64 * 64
+
+var kpkBitbase []uint8
+var kpkOnce sync.Once
+
+func kpkIndex(whiteToMove bool, blackKing Square, whiteKing Square, pawn Square) int {
+	stm := 0
+	if !whiteToMove {
+		stm = 1
+	}
+	return int(whiteKing) | int(blackKing)<<6 | stm<<12 | int(pawn.File())<<13 | (int(Rank7)-int(pawn.Rank()))<<15
+}
+
+func kingNeighbours(sq Square) []Square {
+	neighbours := make([]Square, 0, 8)
+	for to := Square(0); to < 64; to++ {
+		if SquareDistance(sq, to) == 1 {
+			neighbours = append(neighbours, to)
+		}
+	}
+	return neighbours
+}
+
+func whitePawnAttacks(pawn Square, sq Square) bool {
+	return sq.Rank() == pawn.Rank()+1 && SquareDistance(pawn, sq) == 1 && sq.File() != pawn.File()
+}
+
+func generateKPK() {
+	db := make([]uint8, kpkSize)
+	var neighbours [64][]Square
+	for sq := Square(0); sq < 64; sq++ {
+		neighbours[sq] = kingNeighbours(sq)
+	}
+
+	forEach := func(f func(index int, whiteToMove bool, whiteKing Square, blackKing Square, pawn Square)) {
+		for _, file := range []File{FileA, FileB, FileC, FileD} {
+			for rank := Rank2; rank <= Rank7; rank++ {
+				pawn := SquareOf(file, rank)
+				for whiteKing := Square(0); whiteKing < 64; whiteKing++ {
+					for blackKing := Square(0); blackKing < 64; blackKing++ {
+						for _, whiteToMove := range []bool{true, false} {
+							f(kpkIndex(whiteToMove, blackKing, whiteKing, pawn), whiteToMove, whiteKing, blackKing, pawn)
+						}
+					}
+				}
+			}
+		}
+	}
+
+	// Initial classification
+	forEach(func(index int, whiteToMove bool, whiteKing Square, blackKing Square, pawn Square) {
+		push := pawn + 8
+		if SquareDistance(whiteKing, blackKing) <= 1 || whiteKing == pawn || blackKing == pawn ||
+			(whiteToMove && whitePawnAttacks(pawn, blackKing)) {
+			db[index] = kpkInvalid
+		} else if whiteToMove && pawn.Rank() == Rank7 && whiteKing != push && blackKing != push &&
+			(SquareDistance(blackKing, push) > 1 || SquareDistance(whiteKing, push) == 1) {
+			// The pawn promotes, and the queen cannot be taken
+			db[index] = kpkWin
+		} else if !whiteToMove && blackIsStalemated(neighbours[blackKing], whiteKing, pawn) {
+			db[index] = kpkDraw
+		} else if !whiteToMove && SquareDistance(blackKing, pawn) == 1 && SquareDistance(whiteKing, pawn) > 1 {
+			// The pawn is lost
+			db[index] = kpkDraw
+		} else {
+			db[index] = kpkUnknown
+		}
+	})
+
+	for changed := true; changed; {
+		changed = false
+		forEach(func(index int, whiteToMove bool, whiteKing Square, blackKing Square, pawn Square) {
+			if db[index] != kpkUnknown {
+				return
+			}
+			result := kpkInvalid
+			if whiteToMove {
+				for _, to := range neighbours[whiteKing] {
+					result |= db[kpkIndex(false, blackKing, to, pawn)]
+				}
+				if pawn.Rank() < Rank7 {
+					push := pawn + 8
+					result |= db[kpkIndex(false, blackKing, whiteKing, push)]
+					if pawn.Rank() == Rank2 && push != whiteKing && push != blackKing {
+						result |= db[kpkIndex(false, blackKing, whiteKing, push+8)]
+					}
+				}
+				if result&kpkWin != 0 {
+					db[index] = kpkWin
+				} else if result&kpkUnknown == 0 {
+					db[index] = kpkDraw
+				}
+			} else {
+				for _, to := range neighbours[blackKing] {
+					result |= db[kpkIndex(true, to, whiteKing, pawn)]
+				}
+				if result&kpkDraw != 0 {
+					db[index] = kpkDraw
+				} else if result&kpkUnknown == 0 {
+					db[index] = kpkWin
+				}
+			}
+			if db[index] != kpkUnknown {
+				changed = true
+			}
+		})
+	}
+
+	kpkBitbase = db
+}
+
+func blackIsStalemated(blackKingMoves []Square, whiteKing Square, pawn Square) bool {
+	for _, to := range blackKingMoves {
+		if SquareDistance(to, whiteKing) > 1 && !whitePawnAttacks(pawn, to) {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns true if the side with the pawn wins
+func probeKPK(strongKing Square, pawn Square, weakKing Square, strongSideToMove bool, strong Color) bool {
+	kpkOnce.Do(generateKPK)
+	if strong == Black {
+		strongKing ^= 56
+		pawn ^= 56
+		weakKing ^= 56
+	}
+	if pawn.File() > FileD {
+		strongKing ^= 7
+		pawn ^= 7
+		weakKing ^= 7
+	}
+	return kpkBitbase[kpkIndex(strongSideToMove, weakKing, strongKing, pawn)] == kpkWin
+}
@@ -0,0 +1,97 @@
+package evaluation
+
+import (
+	. "github.com/amanjpro/zahak/engine"
+)
+
+// Everything that only depends on the material on board
+type MaterialEval struct {
+	Key         uint64 // 8
+	Middlegame  int16  // 2, material and imbalance, from white's point of view
+	Endgame     int16  // 2
+	Phase       int16  // 2
+	WhiteScale  int16  // 2, scale factor of the endgame score, when white is the strong side
+	BlackScale  int16  // 2, scale factor of the endgame score, when black is the strong side
+	DrawDivider int16  // 2
+}
+
+var MATERIAL_ENTRY_SIZE = 8 + 2 + 2 + 2 + 2 + 2 + 2
+
+type MaterialCache struct {
+	items              []MaterialEval
+	size               int
+	MaterialhashMisses int64
+	MaterialhashHits   int64
+}
+
+const DEFAULT_MATERIALHASH_SIZE = 1
+
+// Material keys only use the lower bits, they are spread before picking a slot
+func (c *MaterialCache) hash(key uint64) uint32 {
+	return uint32((key*0x9E3779B97F4A7C15)>>32) % uint32(len(c.items))
+}
+
+func (c *MaterialCache) Set(entry MaterialEval) {
+	c.items[c.hash(entry.Key)] = entry
+}
+
+func (c *MaterialCache) Size() int {
+	return c.size
+}
+
+func (c *MaterialCache) Get(key uint64) (MaterialEval, bool) {
+	item := c.items[c.hash(key)]
+	if item.Key == key {
+		c.MaterialhashHits += 1
+		return item, true
+	}
+	c.MaterialhashMisses += 1
+	return MaterialEval{}, false
+}
+
+func NewMaterialCache(megabytes int) *MaterialCache {
+	size := int(megabytes * 1024 * 1024 / MATERIAL_ENTRY_SIZE)
+	return &MaterialCache{make([]MaterialEval, RoundPowerOfTwo(size)), megabytes, 0, 0}
+}
+
+// Looks the material of the position up in the cache, and computes it on a miss.
+// A nil cache always computes the values, which is needed when they are tuned
+func CachedMaterialEval(p *Position, materialhash *MaterialCache) MaterialEval {
+	key := p.MaterialKey()
+	if materialhash != nil {
+		if entry, ok := materialhash.Get(key); ok {
+			return entry
+		}
+	}
+	entry := computeMaterialEval(&p.MaterialsOnBoard)
+	entry.Key = key
+	if materialhash != nil {
+		materialhash.Set(entry)
+	}
+	return entry
+}
+
+// The terms that only depend on the material, the cache keeps their sum
+func materialTerms(materials *[12]int16) [3]TraceTerm {
+	return [3]TraceTerm{
+		{"Material", MaterialBalance(materials)},
+		{"Bishop pair", BishopPairEval(materials)},
+		{"Imbalance", ImbalanceEval(materials)},
+	}
+}
+
+func computeMaterialEval(materials *[12]int16) MaterialEval {
+	var mg, eg int16
+	for _, term := range materialTerms(materials) {
+		mg += term.Eval.whiteMG - term.Eval.blackMG
+		eg += term.Eval.whiteEG - term.Eval.blackEG
+	}
+	return MaterialEval{
+		Middlegame:  mg,
+		Endgame:     eg,
+		Phase:       GamePhase(materials),
+		WhiteScale:  materialScaleFactor(materials, White),
+		BlackScale:  materialScaleFactor(materials, Black),
+		DrawDivider: drawDivider(materials),
+	}
+}
@@ -0,0 +1,25 @@
+package evaluation
+
+import (
+	"math"
+)
+
+// Maps an evaluation in centipawns to the expected score of the side it is
+// for, between 0 (a loss) and 1 (a win). K scales the evaluation, the tuner
+// finds the K that fits the evaluation best
+func WinProbability(eval int16, K float64) float64 {
+	return (1.0 / (1.0 + math.Pow(10, -(K*float64(eval))/400.0)))
+}
+
+// The inverse of WinProbability, the result is clamped to the evaluations that
+// are not checkmates
+func EvalFromWinProbability(probability float64, K float64) int16 {
+	if probability <= 0 {
+		return -MAX_NON_CHECKMATE
+	}
+	if probability >= 1 {
+		return MAX_NON_CHECKMATE
+	}
+	eval := -400.0 * math.Log10(1.0/probability-1.0) / K
+	return int16(math.Max(math.Min(eval, float64(MAX_NON_CHECKMATE)), -float64(MAX_NON_CHECKMATE)))
+}
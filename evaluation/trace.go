@@ -0,0 +1,89 @@
+package evaluation
+
+import (
+	"fmt"
+	"strings"
+
+	. "github.com/amanjpro/zahak/engine"
+)
+
+type TraceTerm struct {
+	Name string
+	Eval Eval
+}
+
+// A breakdown of the static evaluation of a position, all the terms are from
+// the point of view of their own color
+type EvalTrace struct {
+	Terms       []TraceTerm
+	Phase       int16
+	DrawDivider int16
+	ScaleFactor int16  // The scale factor of the endgame score, in 64ths
+	Endgame     string // The dedicated evaluator of the endgame, if any
+	Turn        Color
+	Eval        int16 // The final evaluation, relative to the side to move
+}
+
+// Runs Evaluate without the caches, and keeps every term apart. This is
+// slow, and is only meant for debugging the evaluation function
+func TraceEvaluate(position *Position) EvalTrace {
+	trace := EvalTrace{
+		Terms:       make([]TraceTerm, 0, 13),
+		ScaleFactor: NormalScale,
+		Turn:        position.Turn(),
+	}
+	trace.Eval = evaluate(position, nil, nil, NoColor, 0, &trace)
+	return trace
+}
+
+func (t *EvalTrace) add(name string, eval Eval) {
+	if t != nil {
+		t.Terms = append(t.Terms, TraceTerm{name, eval})
+	}
+}
+
+// The final evaluation from white's point of view
+func (t EvalTrace) WhiteEval() int16 {
+	if t.Turn == Black {
+		return -t.Eval
+	}
+	return t.Eval
+}
+
+func (t EvalTrace) String() string {
+	var sb strings.Builder
+	line := "----------------+-------------------+-------------------+------------------\n"
+	sb.WriteString("      Term      |       White       |       Black       |       Total\n")
+	sb.WriteString("                |    MG        EG   |    MG        EG   |    MG        EG\n")
+	sb.WriteString(line)
+	var totalMG, totalEG int16
+	for _, term := range t.Terms {
+		e := term.Eval
+		mg := e.whiteMG - e.blackMG
+		eg := e.whiteEG - e.blackEG
+		totalMG += mg
+		totalEG += eg
+		sb.WriteString(fmt.Sprintf("%15s | %s %s | %s %s | %s %s\n", term.Name,
+			centipawns(e.whiteMG), centipawns(e.whiteEG),
+			centipawns(e.blackMG), centipawns(e.blackEG),
+			centipawns(mg), centipawns(eg)))
+	}
+	sb.WriteString(line)
+	sb.WriteString(fmt.Sprintf("%15s | %17s | %17s | %s %s\n", "Total", "", "", centipawns(totalMG), centipawns(totalEG)))
+	sb.WriteString("\n")
+	sb.WriteString(fmt.Sprintf("Phase: %d/256 (0 is middlegame, 256 is endgame)\n", t.Phase))
+	if t.Endgame != "" {
+		sb.WriteString(fmt.Sprintf("%s endgame, the terms are replaced by a dedicated evaluator\n", t.Endgame))
+	} else if t.ScaleFactor != NormalScale {
+		sb.WriteString(fmt.Sprintf("Endgame score is scaled by %d/%d\n", t.ScaleFactor, NormalScale))
+	}
+	if t.DrawDivider > 0 {
+		sb.WriteString(fmt.Sprintf("Drawish material, evaluation is divided by %d\n", 1<<t.DrawDivider))
+	}
+	sb.WriteString(fmt.Sprintf("Final evaluation: %s (white side)\n", strings.TrimSpace(centipawns(t.WhiteEval()))))
+	return sb.String()
+}
+
+func centipawns(score int16) string {
+	return fmt.Sprintf("%8.2f", float64(score)/100)
+}
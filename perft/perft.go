@@ -29,14 +29,13 @@ func PerftTree(game Game, depth int, moves []Move) {
 		for i := 0; i < depth; i++ {
 			cache[i] = make(map[uint64]int64, 1000_000)
 		}
-		moves = game.Position().PseudoLegalMoves()
+		moves = game.Position().LegalMoves()
 		for _, move := range moves {
-			if ep, tg, hc, ok := game.Position().MakeMove(move); ok {
-				nodes := bulkyPerft(game.Position(), depth)
-				fmt.Printf("%s %d\n", move.ToString(), nodes)
-				sum += nodes
-				game.Position().UnMakeMove(move, tg, ep, hc)
-			}
+			ep, tg, hc, _ := game.Position().MakeMove(move)
+			nodes := bulkyPerft(game.Position(), depth)
+			fmt.Printf("%s %d\n", move.ToString(), nodes)
+			sum += nodes
+			game.Position().UnMakeMove(move, tg, ep, hc)
 		}
 	}
 
@@ -227,16 +226,7 @@ func testNodesOnly(fen string, depth int, expected int64) int8 {
 func perft(p *Position, depth int, currentMove Move, acc *PerftNodes) {
 	if depth == 0 {
 		isCheck := p.IsInCheck()
-		moves := p.PseudoLegalMoves()
-		hasLegalMoves := false
-		for _, move := range moves {
-			if ep, tag, hc, ok := p.MakeMove(move); ok {
-				hasLegalMoves = true
-				p.UnMakeMove(move, tag, ep, hc)
-				break
-			}
-		}
-		isCheckmate := isCheck && !hasLegalMoves
+		isCheckmate := isCheck && len(p.LegalMoves()) == 0
 		acc.nodes += 1
 		if isCheckmate {
 			acc.checkmates += 1
@@ -260,13 +250,12 @@ func perft(p *Position, depth int, currentMove Move, acc *PerftNodes) {
 		return
 	}
 
-	moves := p.PseudoLegalMoves()
+	moves := p.LegalMoves()
 
 	for _, move := range moves {
-		if ep, tag, hc, ok := p.MakeMove(move); ok {
-			perft(p, depth-1, move, acc)
-			p.UnMakeMove(move, tag, ep, hc)
-		}
+		ep, tag, hc, _ := p.MakeMove(move)
+		perft(p, depth-1, move, acc)
+		p.UnMakeMove(move, tag, ep, hc)
 	}
 }
 
@@ -277,31 +266,23 @@ func bulkyPerft(p *Position, depth int) int64 {
 		return 1
 	}
 
-	moves := p.PseudoLegalMoves()
+	moves := p.LegalMoves()
 	if depth == 1 {
-		count := int64(0)
-		for _, move := range moves {
-			if ep, tag, hc, ok := p.MakeMove(move); ok {
-				count += 1
-				p.UnMakeMove(move, tag, ep, hc)
-			}
-		}
-		return count
+		return int64(len(moves))
 	}
 
 	for _, move := range moves {
-		if ep, tag, hc, ok := p.MakeMove(move); ok {
-			hash := p.Hash()
-			n, ok := cache[depth-1][hash]
-			if ok {
-				nodes += n
-			} else {
-				n := bulkyPerft(p, depth-1)
-				cache[depth-1][hash] = n
-				nodes += n
-			}
-			p.UnMakeMove(move, tag, ep, hc)
+		ep, tag, hc, _ := p.MakeMove(move)
+		hash := p.Hash()
+		n, ok := cache[depth-1][hash]
+		if ok {
+			nodes += n
+		} else {
+			n := bulkyPerft(p, depth-1)
+			cache[depth-1][hash] = n
+			nodes += n
 		}
+		p.UnMakeMove(move, tag, ep, hc)
 	}
 	return nodes
 }
@@ -0,0 +1,70 @@
+package search
+
+import (
+	. "github.com/amanjpro/zahak/engine"
+)
+
+// The threads of a runner either search on their own and only share the
+// transposition table (Lazy SMP), or share the work at every node (ABDADA). With
+// ABDADA, a thread marks the positions it is searching in the transposition
+// table, and the other threads search these moves after all the others
+type SMPMode uint8
+
+const (
+	LazySMP SMPMode = iota
+	ABDADA
+)
+
+// Moves are only deferred at nodes that are deep enough, the shallow ones are
+// too cheap to share
+const ABDADA_DEFER_DEPTH int8 = 3
+
+func (m SMPMode) String() string {
+	if m == ABDADA {
+		return "ABDADA"
+	}
+	return "LazySMP"
+}
+
+func ParseSMPMode(name string) (SMPMode, bool) {
+	switch name {
+	case "LazySMP":
+		return LazySMP, true
+	case "ABDADA":
+		return ABDADA, true
+	}
+	return LazySMP, false
+}
+
+func (e *Engine) shouldDefer(hash uint64, depthLeft int8) bool {
+	return e.abdada && depthLeft >= ABDADA_DEFER_DEPTH && e.TranspositionTable.IsBusy(hash)
+}
+
+func (e *Engine) startSearching(hash uint64, depthLeft int8) {
+	if e.abdada && depthLeft >= ABDADA_DEFER_DEPTH {
+		e.TranspositionTable.MarkBusy(hash)
+	}
+}
+
+func (e *Engine) finishSearching(hash uint64, depthLeft int8) {
+	if e.abdada && depthLeft >= ABDADA_DEFER_DEPTH {
+		e.TranspositionTable.ClearBusy(hash)
+	}
+}
+
+func (e *Engine) deferMove(searchHeight int8, move Move, score int32) {
+	deferred := e.deferredMoves[searchHeight]
+	deferred.Scores[deferred.Size] = score
+	deferred.Add(move)
+}
+
+// The next deferred move of the node, and its score in the move picker
+func (e *Engine) nextDeferredMove(searchHeight int8) (Move, int32) {
+	deferred := e.deferredMoves[searchHeight]
+	if deferred.Next >= deferred.Size {
+		return EmptyMove, 0
+	}
+	next := deferred.Next
+	deferred.IncNext()
+	return deferred.Moves[next], deferred.Scores[next]
+}
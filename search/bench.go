@@ -70,15 +70,24 @@ func RunBenchmark() {
 	totalTime := float64(0)
 	runner.AddTimeManager(NewTimeManager(time.Now(), MAX_TIME, false, 0, 0, false))
 	var pawnHashHits, pawnHashMisses int64
+	var materialHashHits, materialHashMisses int64
+	var evalHashHits, evalHashMisses int64
 	for _, fen := range fens {
 		runner.Engines[0].TranspositionTable = NewCache(cacheSize)
 		runner.Engines[0].Pawnhash = NewPawnCache(1)
+		runner.Engines[0].Materialhash = NewMaterialCache(DEFAULT_MATERIALHASH_SIZE)
+		runner.Engines[0].Evalhash = NewEvalCache(DEFAULT_EVALHASH_SIZE)
+		runner.ClearHistories()
 		game := FromFen(fen)
 		runner.Engines[0].Position = game.Position()
 		runner.Engines[0].Search(depth)
-		nodes += runner.nodesVisited
+		nodes += runner.Nodes()
 		pawnHashMisses += runner.Engines[0].Pawnhash.PawnhashMisses
 		pawnHashHits += runner.Engines[0].Pawnhash.PawnhashHits
+		materialHashMisses += runner.Engines[0].Materialhash.MaterialhashMisses
+		materialHashHits += runner.Engines[0].Materialhash.MaterialhashHits
+		evalHashMisses += runner.Engines[0].Evalhash.EvalhashMisses
+		evalHashHits += runner.Engines[0].Evalhash.EvalhashHits
 		totalTime += runner.Engines[0].TotalTime
 	}
 
@@ -88,4 +97,73 @@ func RunBenchmark() {
 	fmt.Printf("nps %d\n", int64(float64(nodes)/totalTime))
 	fmt.Printf("Pawn Miss %d\n", pawnHashMisses)
 	fmt.Printf("Pawn Hit %d\n", pawnHashHits)
+	fmt.Printf("Material Miss %d\n", materialHashMisses)
+	fmt.Printf("Material Hit %d\n", materialHashHits)
+	fmt.Printf("Eval Miss %d\n", evalHashMisses)
+	fmt.Printf("Eval Hit %d\n", evalHashHits)
+}
+
+// Measures how the search scales with the number of threads, every position is
+// searched to the same depth with 1, 2, 4 ... threads in both SMP modes, then
+// the time to depth and the nps are compared with a single thread
+func RunSMPBenchmark(maxThreads int, depth int8) {
+	if maxThreads < 1 {
+		maxThreads = 1
+	}
+	threadCounts := []int{}
+	for threads := 1; threads < maxThreads; threads *= 2 {
+		threadCounts = append(threadCounts, threads)
+	}
+	threadCounts = append(threadCounts, maxThreads)
+
+	type result struct {
+		mode    SMPMode
+		threads int
+		time    float64
+		nodes   int64
+	}
+	results := []result{}
+	for _, threads := range threadCounts {
+		for _, mode := range []SMPMode{LazySMP, ABDADA} {
+			if threads == 1 && mode == ABDADA {
+				continue // The same as Lazy SMP
+			}
+			time, nodes := smpBenchmark(mode, threads, depth)
+			results = append(results, result{mode, threads, time, nodes})
+		}
+	}
+
+	fmt.Println("====================================================")
+	fmt.Printf("Depth %d, %d positions\n", depth, len(fens))
+	fmt.Printf("%8s %8s %10s %12s %10s %12s %12s\n", "Mode", "Threads", "Time (ms)", "Nodes", "nps", "TTD speedup", "nps scaling")
+	base := results[0]
+	baseNps := float64(base.nodes) / base.time
+	for _, r := range results {
+		nps := float64(r.nodes) / r.time
+		fmt.Printf("%8s %8d %10d %12d %10d %12.2f %12.2f\n", r.mode, r.threads, int64(r.time*1000), r.nodes, int64(nps),
+			base.time/r.time, nps/baseNps)
+	}
+}
+
+func smpBenchmark(mode SMPMode, threads int, depth int8) (float64, int64) {
+	cacheSize := uint32(64)
+	runner := NewRunner(NewCache(cacheSize), NewPawnCache(1), threads)
+	runner.SMPMode = mode
+	var totalTime float64
+	var nodes int64
+	for _, fen := range fens {
+		tt := NewCache(cacheSize)
+		game := FromFen(fen)
+		for _, e := range runner.Engines {
+			e.TranspositionTable = tt
+			e.Position = game.Position().Copy()
+		}
+		runner.ClearHistories()
+		runner.AddTimeManager(NewTimeManager(time.Now(), MAX_TIME, false, 0, 0, false))
+		start := time.Now()
+		runner.Search(depth)
+		totalTime += time.Since(start).Seconds()
+		nodes += runner.Nodes()
+	}
+	return totalTime, nodes
 }
@@ -0,0 +1,160 @@
+package search
+
+import (
+	. "github.com/amanjpro/zahak/engine"
+)
+
+// Besides the killers and the history of (piece, destination), quiet moves are
+// ordered by:
+//  - The counter move, the quiet move that refuted the previous move the last time
+//  - The continuation histories, how good the move was after the previous move
+//    (1-ply) and after our own previous move (2-ply)
+// Captures are ordered by SEE, and then by the history of (piece, destination,
+// captured piece)
+
+const pieceSquares = 12 * 64
+
+const COUNTER_MOVE_SCORE int32 = 70_000_000
+
+// The capture history only breaks ties between captures of the same SEE band
+const CAPTURE_HISTORY_DIVISOR int32 = 16
+
+func pieceSquareIndex(piece Piece, square Square) int {
+	return int(piece-1)*64 + int(square)
+}
+
+func isHistoryMove(move Move) bool {
+	return move != EmptyMove && move.MovingPiece() != NoPiece
+}
+
+// The continuation histories are too large to clear before every search, they
+// are kept until a new game, see Runner.ClearHistories. historyBonus keeps
+// their values bounded
+func (e *Engine) clearHistories() {
+	if e.counterMoves == nil {
+		e.counterMoves = make([]Move, pieceSquares)
+		e.captureHistory = make([]int32, pieceSquares*12)
+		for i := 0; i < len(e.continuationHistory); i++ {
+			e.continuationHistory[i] = make([]int32, pieceSquares*pieceSquares)
+		}
+	}
+	for i := range e.counterMoves {
+		e.counterMoves[i] = EmptyMove
+	}
+	for i := range e.captureHistory {
+		e.captureHistory[i] = 0
+	}
+	for i := 0; i < len(e.triedCaptureMoves); i++ {
+		if e.triedCaptureMoves[i] == nil {
+			e.triedCaptureMoves[i] = make([]Move, 250) // Number of potential legal moves per position
+		}
+	}
+}
+
+// Forgets the continuation histories of all the threads, meant for a new game
+func (r *Runner) ClearHistories() {
+	for _, e := range r.Engines {
+		for i := 0; i < len(e.continuationHistory); i++ {
+			history := e.continuationHistory[i]
+			for j := range history {
+				history[j] = 0
+			}
+		}
+	}
+}
+
+// The move that was played to reach the position at the given height, plies
+// moves ago
+func (e *Engine) previousMove(searchHeight int8, plies int8) Move {
+	height := searchHeight + 1 - plies
+	if height < 0 {
+		return EmptyMove
+	}
+	return e.positionMoves[height]
+}
+
+func (e *Engine) CounterMove(searchHeight int8) Move {
+	previous := e.previousMove(searchHeight, 1)
+	if !isHistoryMove(previous) {
+		return EmptyMove
+	}
+	return e.counterMoves[pieceSquareIndex(previous.MovingPiece(), previous.Destination())]
+}
+
+func (e *Engine) AddCounterMove(move Move, searchHeight int8) {
+	previous := e.previousMove(searchHeight, 1)
+	if !isHistoryMove(previous) {
+		return
+	}
+	e.info.counterMoveCounter += 1
+	e.counterMoves[pieceSquareIndex(previous.MovingPiece(), previous.Destination())] = move
+}
+
+func (e *Engine) ContinuationHistoryScore(move Move, searchHeight int8) int32 {
+	var score int32
+	index := pieceSquareIndex(move.MovingPiece(), move.Destination())
+	for i := 0; i < len(e.continuationHistory); i++ {
+		previous := e.previousMove(searchHeight, int8(i+1))
+		if isHistoryMove(previous) {
+			score += e.continuationHistory[i][pieceSquareIndex(previous.MovingPiece(), previous.Destination())*pieceSquares+index]
+		}
+	}
+	return score
+}
+
+func (e *Engine) updateContinuationHistory(move Move, searchHeight int8, bonus int32) {
+	index := pieceSquareIndex(move.MovingPiece(), move.Destination())
+	for i := 0; i < len(e.continuationHistory); i++ {
+		previous := e.previousMove(searchHeight, int8(i+1))
+		if isHistoryMove(previous) {
+			entry := &e.continuationHistory[i][pieceSquareIndex(previous.MovingPiece(), previous.Destination())*pieceSquares+index]
+			*entry = historyBonus(*entry, bonus)
+		}
+	}
+}
+
+func captureHistoryIndex(move Move) int {
+	return pieceSquareIndex(move.MovingPiece(), move.Destination())*12 + int(move.CapturedPiece()-1)
+}
+
+func (e *Engine) CaptureHistoryScore(move Move) int32 {
+	return e.captureHistory[captureHistoryIndex(move)]
+}
+
+// Records every capture that is counted, including promotions, so that no slot
+// keeps a capture of another node. AddCaptureHistory skips the promotions
+func (e *Engine) NoteCapture(move Move, captureMovesCounter int, height int8) {
+	if captureMovesCounter < 0 || height < 0 || !move.IsCapture() {
+		return
+	}
+	e.triedCaptureMoves[height][captureMovesCounter] = move
+}
+
+// Rewards the capture that caused a cutoff, and punishes the captures that were
+// tried before it
+func (e *Engine) AddCaptureHistory(move Move, depthLeft int8, searchHeight int8, captureMovesCounter int) {
+	if searchHeight < 0 || depthLeft < 0 {
+		return
+	}
+	bonus := int32(depthLeft) * int32(depthLeft)
+	e.info.captureHistoryCounter += 1
+	index := captureHistoryIndex(move)
+	e.captureHistory[index] = historyBonus(e.captureHistory[index], bonus)
+	triedMoves := e.triedCaptureMoves[searchHeight]
+	for i := 0; i <= captureMovesCounter; i++ {
+		tried := triedMoves[i]
+		if tried != move && tried.IsCapture() && tried.PromoType() == NoType {
+			index := captureHistoryIndex(tried)
+			e.captureHistory[index] = historyBonus(e.captureHistory[index], -bonus)
+		}
+	}
+}
+
+// Keeps track of how early the moves that cause a cutoff are searched
+func (e *Engine) noteCutoff(legalMoves int) {
+	e.info.betaCutoffCounter += 1
+	e.info.cutoffMoveCounter += int64(legalMoves)
+	if legalMoves == 1 {
+		e.info.firstMoveCutoffCounter += 1
+	}
+}
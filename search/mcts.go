@@ -0,0 +1,371 @@
+package search
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	. "github.com/amanjpro/zahak/book"
+	. "github.com/amanjpro/zahak/engine"
+	. "github.com/amanjpro/zahak/evaluation"
+)
+
+// Besides alpha-beta, the engine can grow a tree best first with Monte Carlo
+// Tree Search. Every playout walks down the tree picking the child with the
+// best PUCT score, adds the children of the node it reaches, and evaluates it
+// with a quiescence search, mapped to a win probability with the sigmoid of
+// the tuner. The move ordering scores of the MovePicker are the priors of the
+// children. The tree is kept between searches, and the subtree of the new
+// position is reused. The tree is bounded by the Hash option, once it is full
+// the playouts stop adding nodes, and evaluate the leaves they reach instead.
+// MCTS only runs on the main thread
+type SearchMode uint8
+
+const (
+	AlphaBeta SearchMode = iota
+	MCTS
+)
+
+func (m SearchMode) String() string {
+	if m == MCTS {
+		return "MCTS"
+	}
+	return "AlphaBeta"
+}
+
+func ParseSearchMode(name string) (SearchMode, bool) {
+	switch name {
+	case "AlphaBeta":
+		return AlphaBeta, true
+	case "MCTS":
+		return MCTS, true
+	}
+	return AlphaBeta, false
+}
+
+const MCTS_EXPLORATION = 1.5
+
+// Unvisited children are assumed to be a bit worse than their parent
+const MCTS_FPU_REDUCTION = 0.2
+
+// The K of the sigmoid, the tuner starts from the same value
+const MCTS_SIGMOID_K = 1.0
+
+// Playouts stop growing the tree at this height, and evaluate the node instead
+const MCTS_MAX_HEIGHT int8 = 50
+
+// How often the principal variation is sent, in milliseconds
+const MCTS_REPORT_INTERVAL = 1000
+
+// The memory a node takes, roughly, including its pointer in the children of
+// its parent and the headroom of the garbage collector. The tree gets as many
+// nodes as fit in the size of the Hash option
+const MCTS_NODE_BYTES = 256
+
+type mctsNode struct {
+	move     Move
+	hash     uint64
+	prior    float64
+	visits   int64
+	value    float64 // Sum of the results, for the side that played the move
+	children []*mctsNode
+	expanded bool
+	terminal bool
+	result   float64 // The result of a terminal node
+}
+
+func (n *mctsNode) q() float64 {
+	return n.value / float64(n.visits)
+}
+
+func (n *mctsNode) selectChild() *mctsNode {
+	fpu := 0.5 - MCTS_FPU_REDUCTION
+	if n.visits > 0 {
+		fpu = 1 - n.q() - MCTS_FPU_REDUCTION
+	}
+	sqrtVisits := math.Sqrt(float64(max64(n.visits, 1)))
+	var best *mctsNode
+	bestScore := -math.MaxFloat64
+	for _, child := range n.children {
+		q := fpu
+		if child.visits > 0 {
+			q = child.q()
+		}
+		score := q + MCTS_EXPLORATION*child.prior*sqrtVisits/float64(1+child.visits)
+		if score > bestScore {
+			best = child
+			bestScore = score
+		}
+	}
+	return best
+}
+
+// The most visited child
+func (n *mctsNode) bestChild() *mctsNode {
+	var best *mctsNode
+	for _, child := range n.children {
+		if best == nil || child.visits > best.visits ||
+			(child.visits == best.visits && child.visits > 0 && child.q() > best.q()) {
+			best = child
+		}
+	}
+	return best
+}
+
+func (n *mctsNode) principalVariation(pv *PVLine) {
+	moves := []Move{}
+	for node := n.bestChild(); node != nil && len(moves) < int(MAX_DEPTH); node = node.bestChild() {
+		if node.visits == 0 && len(moves) != 0 {
+			break
+		}
+		moves = append(moves, node.move)
+	}
+	pv.SetLine(moves)
+}
+
+// The number of nodes in the subtree of the node
+func (n *mctsNode) size() int64 {
+	size := int64(1)
+	for _, child := range n.children {
+		size += child.size()
+	}
+	return size
+}
+
+func (n *mctsNode) find(hash uint64, plies int) *mctsNode {
+	if n.hash == hash {
+		return n
+	}
+	if plies == 0 {
+		return nil
+	}
+	for _, child := range n.children {
+		if node := child.find(hash, plies-1); node != nil {
+			return node
+		}
+	}
+	return nil
+}
+
+// Returns the node of the position in the tree of the last search, or a new
+// tree. The position is looked for up to two plies deep, after our move and
+// the reply of the opponent
+func (r *Runner) mctsRoot(hash uint64) *mctsNode {
+	if r.mctsTree != nil {
+		if node := r.mctsTree.find(hash, 2); node != nil && !node.terminal {
+			r.mctsTree = node
+			r.mctsNodes = node.size()
+			return node
+		}
+	}
+	r.mctsTree = &mctsNode{move: EmptyMove, hash: hash}
+	r.mctsNodes = 1
+	return r.mctsTree
+}
+
+// The most nodes the tree can have. It is only checked before a node is
+// expanded, so the tree can go over it by the children of one node
+func (r *Runner) mctsBudget() int64 {
+	return int64(r.Engines[0].TranspositionTable.Size()) << 20 / MCTS_NODE_BYTES
+}
+
+// Maps the ordering score of a move to the logit of its prior
+func movePriorLogit(score int32) float64 {
+	switch {
+	case score >= 900_000_000: // The hash move
+		return 3
+	case score >= 100_000_000: // Promotions, and captures that do not lose material
+		return 2
+	case score >= COUNTER_MOVE_SCORE: // Killers and the counter move
+		return 1
+	case score <= -50_000_000: // Captures that lose material
+		return -1
+	}
+	return 0.5 * math.Max(math.Min(float64(score)/8192, 1), -1)
+}
+
+func (e *Engine) expand(node *mctsNode, height int8) {
+	position := e.Position
+	node.expanded = true
+	hashmove := EmptyMove
+	if compact, _, _, _, _, ok := e.TranspositionTable.Get(position.Hash()); ok {
+		hashmove = position.MoveFromCompact(compact)
+	}
+	movePicker := e.MovePickers[height]
+	movePicker.RecycleWith(position, e, 0, height, hashmove, false)
+	total := 0.0
+	for move := movePicker.Next(); move != EmptyMove; move = movePicker.Next() {
+		score := movePicker.scoreOf(move)
+		if ep, tag, hc, ok := position.MakeMove(move); ok {
+			child := &mctsNode{move: move, hash: position.Hash(), prior: math.Exp(movePriorLogit(score))}
+			position.UnMakeMove(move, tag, ep, hc)
+			total += child.prior
+			node.children = append(node.children, child)
+		}
+	}
+	for _, child := range node.children {
+		child.prior /= total
+	}
+	e.parent.mctsNodes += int64(len(node.children))
+}
+
+// Whether the side to move has a legal move, the children of the node are not
+// known when the tree is full
+func (e *Engine) hasLegalMoves(node *mctsNode) bool {
+	if node.expanded {
+		return len(node.children) != 0
+	}
+	return len(e.Position.LegalMoves()) != 0
+}
+
+// The result of the node for the side that played its move
+func (e *Engine) mctsEvaluate(node *mctsNode, height int8) float64 {
+	position := e.Position
+	if height > 0 && (IsRepetition(position, e.pred, node.move) || position.IsDraw()) {
+		node.terminal = true
+		node.result = 0.5
+		return node.result
+	}
+	if !node.expanded && e.parent.mctsNodes < e.parent.mctsBudget() {
+		e.expand(node, height)
+	}
+	if !e.hasLegalMoves(node) {
+		node.terminal = true
+		node.result = 0.5
+		if position.IsInCheck() {
+			node.result = 1
+		}
+		return node.result
+	}
+	e.staticEvals[height] = e.evaluate(NoColor, 0)
+	score := e.quiescence(-MAX_INT, MAX_INT, height, 0)
+	return 1 - WinProbability(score, MCTS_SIGMOID_K)
+}
+
+type mctsStep struct {
+	node      *mctsNode
+	enPassant Square
+	tag       PositionTag
+	halfClock uint8
+}
+
+// Runs one playout from the root, it returns false if the search was stopped
+// before the result was known
+func (e *Engine) playout(root *mctsNode, path []mctsStep) ([]mctsStep, bool) {
+	position := e.Position
+	path = append(path[:0], mctsStep{node: root})
+	node := root
+	height := int8(0)
+	for node.expanded && !node.terminal && height < MCTS_MAX_HEIGHT {
+		node = node.selectChild()
+		ep, tag, hc, _ := position.MakeMove(node.move)
+		height += 1
+		e.VisitNode()
+		e.positionMoves[height] = node.move
+		e.pred.Push(position.Hash())
+		path = append(path, mctsStep{node, ep, tag, hc})
+	}
+
+	result := node.result
+	if !node.terminal {
+		result = e.mctsEvaluate(node, height)
+	}
+
+	for i := len(path) - 1; i > 0; i-- {
+		step := path[i]
+		e.pred.Pop()
+		position.UnMakeMove(step.node.move, step.tag, step.enPassant, step.halfClock)
+	}
+
+	if e.TimeManager().AbruptStop {
+		return path, false
+	}
+	for i := len(path) - 1; i >= 0; i-- {
+		path[i].node.visits += 1
+		path[i].node.value += result
+		result = 1 - result
+	}
+	return path, true
+}
+
+func (e *Engine) mctsSearch(depth int8) {
+	pv := NewPVLine(MAX_DEPTH)
+	lastDepth := int8(1)
+	e.vsHuman = false
+	e.positionMoves[0] = EmptyMove
+
+	bookmove := GetBookMove(e.Position)
+	tbmove := EmptyMove
+	var tbscore int16
+	if bookmove == EmptyMove {
+		tbmove, tbscore = e.tablebaseMove()
+	}
+	if bookmove != EmptyMove {
+		pv.AddFirst(bookmove)
+		e.updatePv(pv, 0, 1, true)
+	} else if tbmove != EmptyMove {
+		pv.AddFirst(tbmove)
+		e.updatePv(pv, tbscore, 1, true)
+	} else {
+		root := e.parent.mctsRoot(e.Position.Hash())
+		reused := root.visits
+		if !root.expanded {
+			e.expand(root, 0)
+		}
+		if len(root.children) != 0 {
+			path := make([]mctsStep, 0, MCTS_MAX_HEIGHT+1)
+			lastReport := time.Now()
+			var playouts, heights int64
+			for e.TimeManager().CanStartNewIteration() {
+				var ok bool
+				if path, ok = e.playout(root, path); !ok {
+					break
+				}
+				playouts += 1
+				heights += int64(len(path) - 1)
+				averageDepth := int8(heights / playouts)
+				if averageDepth > lastDepth || time.Since(lastReport).Milliseconds() >= MCTS_REPORT_INTERVAL {
+					lastDepth = max8(lastDepth, averageDepth)
+					e.mctsReport(root, &pv, lastDepth)
+					e.SendPv(pv, e.score, lastDepth)
+					lastReport = time.Now()
+				}
+				if averageDepth >= depth {
+					break
+				}
+			}
+			e.mctsReport(root, &pv, lastDepth)
+			if e.parent.DebugMode {
+				fmt.Printf("info string mcts playouts %d reused %d\n", playouts, reused)
+			}
+		}
+	}
+
+	e.TimeManager().Pondering = false
+	e.parent.Stop = true
+	e.SendPv(pv, e.score, lastDepth)
+}
+
+// Publishes the current principal variation of the tree
+func (e *Engine) mctsReport(root *mctsNode, pv *PVLine, depth int8) {
+	root.principalVariation(pv)
+	best := root.bestChild()
+	var score int16
+	if best.terminal && best.result == 1 {
+		score = CHECKMATE_EVAL - 1
+	} else if best.visits > 0 {
+		score = EvalFromWinProbability(best.q(), MCTS_SIGMOID_K)
+	}
+	e.pv.Clone(*pv)
+	e.score = score
+	e.completedDepth = depth
+
+	parent := e.parent
+	parent.mu.Lock()
+	parent.pv.Clone(*pv)
+	parent.move = parent.pv.MoveAt(0)
+	parent.score = score
+	parent.depth = depth
+	parent.mu.Unlock()
+	e.ShareInfo()
+}
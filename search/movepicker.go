@@ -13,8 +13,11 @@ type MovePicker struct {
 	quietMoveList   *MoveList
 	captureMoveList *MoveList
 	moveOrder       int8
+	searchHeight    int8
 	canUseHashMove  bool
 	isQuiescence    bool
+	evasions        bool
+	quietChecks     bool
 }
 
 func EmptyMovePicker() *MovePicker {
@@ -27,19 +30,29 @@ func EmptyMovePicker() *MovePicker {
 		quietMoveList:   qml,
 		captureMoveList: cml,
 		moveOrder:       0,
+		searchHeight:    0,
 		canUseHashMove:  false,
 		isQuiescence:    false,
+		evasions:        false,
+		quietChecks:     false,
 	}
 	return mp
 
 }
 
-func (mp *MovePicker) RecycleWith(p *Position, e *Engine, moveOrder int8, hashmove Move, isQuiescence bool) {
+func (mp *MovePicker) RecycleWith(p *Position, e *Engine, moveOrder int8, searchHeight int8, hashmove Move, isQuiescence bool) {
+	if hashmove != EmptyMove && !p.IsPseudoLegal(hashmove) {
+		// The transposition table entry belongs to another position
+		hashmove = EmptyMove
+	}
 	mp.engine = e
 	mp.position = p
 	mp.moveOrder = moveOrder
+	mp.searchHeight = searchHeight
 	mp.hashmove = hashmove
 	mp.isQuiescence = isQuiescence
+	mp.evasions = false
+	mp.quietChecks = false
 	mp.canUseHashMove = hashmove != EmptyMove
 	nextCapture := 0
 	nextQuiet := 0
@@ -58,18 +71,39 @@ func (mp *MovePicker) RecycleWith(p *Position, e *Engine, moveOrder int8, hashmo
 	mp.captureMoveList.IsScored = false
 }
 
+// Only generate the moves that get the side to move out of check, in check
+// most of the pseudo-legal moves are illegal, so these are legal moves
+func (mp *MovePicker) UseEvasions() {
+	mp.evasions = true
+}
+
+// Generate the quiet moves that give check, even in quiescence
+func (mp *MovePicker) AddQuietChecks() {
+	mp.quietChecks = true
+}
+
 func (mp *MovePicker) generateQuietMoves() {
-	if mp.isQuiescence || !mp.quietMoveList.IsEmpty() {
+	if !mp.quietMoveList.IsEmpty() {
 		return
 	}
-	mp.position.GetQuietMoves(mp.quietMoveList)
+	if mp.evasions {
+		mp.position.GetLegalQuietMoves(mp.quietMoveList)
+	} else if mp.quietChecks {
+		mp.position.GetQuietChecks(mp.quietMoveList)
+	} else if !mp.isQuiescence {
+		mp.position.GetQuietMoves(mp.quietMoveList)
+	}
 }
 
 func (mp *MovePicker) generateCaptureMoves() {
 	if !mp.captureMoveList.IsEmpty() || !mp.quietMoveList.IsEmpty() {
 		return
 	}
-	mp.position.GetCaptureMoves(mp.captureMoveList)
+	if mp.evasions {
+		mp.position.GetLegalCaptureMoves(mp.captureMoveList)
+	} else {
+		mp.position.GetCaptureMoves(mp.captureMoveList)
+	}
 }
 
 func (mp *MovePicker) HasNoPVMove() bool {
@@ -92,6 +126,7 @@ func (mp *MovePicker) UpgradeToPvMove(pvMove Move) {
 func (mp *MovePicker) scoreCaptureMoves() int {
 	position := mp.position
 	board := position.Board
+	engine := mp.engine
 	var highestNonHashIndex int = -1
 	var highestNonHashScore int32 = math.MinInt32
 
@@ -129,15 +164,16 @@ func (mp *MovePicker) scoreCaptureMoves() int {
 			} else if !move.IsEnPassant() {
 				// SEE for ordering
 				gain := int32(board.StaticExchangeEval(dest, capPiece, source, piece))
+				history := engine.CaptureHistoryScore(move) / CAPTURE_HISTORY_DIVISOR
 				if gain < 0 {
-					scores[i] = -90_000_000 + gain
+					scores[i] = -90_000_000 + gain + history
 				} else if gain == 0 {
-					scores[i] = 100_000_000 + int32(capPiece.Weight()-piece.Weight())
+					scores[i] = 100_000_000 + int32(capPiece.Weight()-piece.Weight()) + history
 				} else {
-					scores[i] = 100_100_000 + gain
+					scores[i] = 100_100_000 + gain + history
 				}
 			} else {
-				scores[i] = 100_100_000 + int32(capPiece.Weight()-piece.Weight())
+				scores[i] = 100_100_000 + int32(capPiece.Weight()-piece.Weight()) + engine.CaptureHistoryScore(move)/CAPTURE_HISTORY_DIVISOR
 			}
 			goto end
 		}
@@ -165,6 +201,7 @@ func (mp *MovePicker) scoreQuietMoves() int {
 	var highestNonHashScore int32 = math.MinInt32
 	engine := mp.engine
 	moveOrder := mp.moveOrder
+	counterMove := engine.CounterMove(mp.searchHeight)
 	scores := mp.quietMoveList.Scores
 	moves := mp.quietMoveList.Moves
 	size := mp.quietMoveList.Size
@@ -195,7 +232,12 @@ func (mp *MovePicker) scoreQuietMoves() int {
 			goto end
 		}
 
-		history = engine.MoveHistoryScore(piece, dest, moveOrder)
+		if move == counterMove {
+			scores[i] = COUNTER_MOVE_SCORE
+			goto end
+		}
+
+		history = engine.MoveHistoryScore(piece, dest, moveOrder) + engine.ContinuationHistoryScore(move, mp.searchHeight)
 		scores[i] = history
 
 	end:
@@ -208,6 +250,17 @@ func (mp *MovePicker) scoreQuietMoves() int {
 	return highestNonHashIndex
 }
 
+// The ordering score of a move that Next just returned
+func (mp *MovePicker) scoreOf(move Move) int32 {
+	if move == mp.hashmove {
+		return 900_000_000
+	}
+	if move.IsCapture() || move.PromoType() != NoType {
+		return mp.captureMoveList.Scores[mp.captureMoveList.Next-1]
+	}
+	return mp.quietMoveList.Scores[mp.quietMoveList.Next-1]
+}
+
 func (mp *MovePicker) Reset() {
 	mp.canUseHashMove = mp.hashmove != EmptyMove
 	mp.quietMoveList.Next = 0
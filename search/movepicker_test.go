@@ -30,8 +30,11 @@ func TestMovepickerNextAndResetWithQuietHashmove(t *testing.T) {
 			Next:     0,
 		},
 		0,
+		0,
 		true,
 		false,
+		false,
+		false,
 	}
 
 	expectedOrder := []Move{10, 20, 18, 17, 16, 15, 14, 13, 12, 11, 9, 8, 7, 6, 5, 4, 3, 2, 1, 19}
@@ -76,8 +79,11 @@ func TestMovepickerNextAndResetWithCaptureHashmove(t *testing.T) {
 			Next:     1,
 		},
 		0,
+		0,
 		true,
 		false,
+		false,
+		false,
 	}
 
 	expectedOrder := []Move{capture, 20, 17, 16, 15, 14, 13, 12, 11, 10, 9, 8, 7, 6, 5, 4, 3, 2, 1, 19}
@@ -135,6 +141,9 @@ func TestMovepickerNextAndResetWithNoHashmove(t *testing.T) {
 			Next:     0,
 		},
 		0,
+		0,
+		false,
+		false,
 		false,
 		false,
 	}
@@ -180,7 +189,7 @@ func TestMovePickerNormalSearch(t *testing.T) {
 	game := FromFen(fen)
 	engine := NewEngine(NewCache(2), NewPawnCache(2), nil)
 	engine.ClearForSearch()
-	mp.RecycleWith(game.Position(), engine, 1, NewMove(A1, B1, WhiteRook, NoPiece, NoType, 0), false)
+	mp.RecycleWith(game.Position(), engine, 1, 0, NewMove(A1, B1, WhiteRook, NoPiece, NoType, 0), false)
 
 	engine.AddKillerMove(NewMove(B2, B3, WhitePawn, NoPiece, NoType, 0), 1)
 	engine.AddKillerMove(NewMove(B2, B4, WhitePawn, NoPiece, NoType, 0), 1)
@@ -266,7 +275,7 @@ func TestUpgradeMoveToHashmoveQuiet(t *testing.T) {
 	game := FromFen(fen)
 	engine := NewEngine(NewCache(2), NewPawnCache(2), nil)
 	engine.ClearForSearch()
-	mp.RecycleWith(game.Position(), engine, 1, EmptyMove, false)
+	mp.RecycleWith(game.Position(), engine, 1, 0, EmptyMove, false)
 
 	engine.AddKillerMove(NewMove(B2, B3, WhitePawn, NoPiece, NoType, 0), 1)
 	engine.AddKillerMove(NewMove(B2, B4, WhitePawn, NoPiece, NoType, 0), 1)
@@ -354,7 +363,7 @@ func TestMovePickerNormalSearchNoHashmove(t *testing.T) {
 	game := FromFen(fen)
 	engine := NewEngine(NewCache(2), NewPawnCache(2), nil)
 	engine.ClearForSearch()
-	mp.RecycleWith(game.Position(), engine, 1, EmptyMove, false)
+	mp.RecycleWith(game.Position(), engine, 1, 0, EmptyMove, false)
 
 	engine.AddKillerMove(NewMove(B2, B3, WhitePawn, NoPiece, NoType, 0), 1)
 	engine.AddKillerMove(NewMove(B2, B4, WhitePawn, NoPiece, NoType, 0), 1)
@@ -440,7 +449,7 @@ func TestMovePickerNormalSearchCaptureHashmove(t *testing.T) {
 	game := FromFen(fen)
 	engine := NewEngine(NewCache(2), NewPawnCache(2), nil)
 	engine.ClearForSearch()
-	mp.RecycleWith(game.Position(), engine, 1, NewMove(C3, D5, WhiteKnight, BlackPawn, NoType, Capture), false)
+	mp.RecycleWith(game.Position(), engine, 1, 0, NewMove(C3, D5, WhiteKnight, BlackPawn, NoType, Capture), false)
 
 	engine.AddKillerMove(NewMove(B2, B3, WhitePawn, NoPiece, NoType, 0), 1)
 	engine.AddKillerMove(NewMove(B2, B4, WhitePawn, NoPiece, NoType, 0), 1)
@@ -527,7 +536,7 @@ func TestMovePickerNormalSearchUpgradeToHashmoveCapture(t *testing.T) {
 	game := FromFen(fen)
 	engine := NewEngine(NewCache(2), NewPawnCache(2), nil)
 	engine.ClearForSearch()
-	mp.RecycleWith(game.Position(), engine, 1, EmptyMove, false)
+	mp.RecycleWith(game.Position(), engine, 1, 0, EmptyMove, false)
 
 	mp.UpgradeToPvMove(NewMove(C3, D5, WhiteKnight, BlackPawn, NoType, Capture))
 
@@ -616,7 +625,7 @@ func TestMovePickerQuiescenceSearch(t *testing.T) {
 	game := FromFen(fen)
 	engine := NewEngine(NewCache(2), NewPawnCache(2), nil)
 	engine.ClearForSearch()
-	mp.RecycleWith(game.Position(), engine, 1, EmptyMove, true)
+	mp.RecycleWith(game.Position(), engine, 1, 0, EmptyMove, true)
 
 	// all these are no-op
 	engine.AddKillerMove(NewMove(B2, B3, WhitePawn, NoPiece, NoType, 0), 1)
@@ -669,7 +678,7 @@ func TestMovePickerNormalSearchWithPromotionNoHashmove(t *testing.T) {
 	game := FromFen(fen)
 	engine := NewEngine(NewCache(2), NewPawnCache(2), nil)
 	engine.ClearForSearch()
-	mp.RecycleWith(game.Position(), engine, 1, EmptyMove, false)
+	mp.RecycleWith(game.Position(), engine, 1, 0, EmptyMove, false)
 
 	moves := []Move{
 		NewMove(H7, G8, WhitePawn, BlackKnight, Queen, Capture),
@@ -730,7 +739,7 @@ func TestMovePickerNormalSearchWithPromotionPromotionQuietHashmove(t *testing.T)
 	game := FromFen(fen)
 	engine := NewEngine(NewCache(2), NewPawnCache(2), nil)
 	engine.ClearForSearch()
-	mp.RecycleWith(game.Position(), engine, 1, NewMove(H7, H8, WhitePawn, NoPiece, Knight, 0), false)
+	mp.RecycleWith(game.Position(), engine, 1, 0, NewMove(H7, H8, WhitePawn, NoPiece, Knight, 0), false)
 
 	moves := []Move{
 		NewMove(H7, H8, WhitePawn, NoPiece, Knight, 0),
@@ -791,7 +800,7 @@ func TestMovePickerNormalSearchWithPromotionPromotionCaptureHashmove(t *testing.
 	game := FromFen(fen)
 	engine := NewEngine(NewCache(2), NewPawnCache(2), nil)
 	engine.ClearForSearch()
-	mp.RecycleWith(game.Position(), engine, 1, NewMove(H7, G8, WhitePawn, BlackKnight, Knight, Capture), false)
+	mp.RecycleWith(game.Position(), engine, 1, 0, NewMove(H7, G8, WhitePawn, BlackKnight, Knight, Capture), false)
 
 	moves := []Move{
 		NewMove(H7, G8, WhitePawn, BlackKnight, Knight, Capture),
@@ -852,7 +861,7 @@ func TestMovePickerNormalSearchWithPromotionUpgradeToPromotionQuietHashmove(t *t
 	game := FromFen(fen)
 	engine := NewEngine(NewCache(2), NewPawnCache(2), nil)
 	engine.ClearForSearch()
-	mp.RecycleWith(game.Position(), engine, 1, EmptyMove, false)
+	mp.RecycleWith(game.Position(), engine, 1, 0, EmptyMove, false)
 	mp.UpgradeToPvMove(NewMove(H7, H8, WhitePawn, NoPiece, Knight, 0))
 
 	moves := []Move{
@@ -914,7 +923,7 @@ func TestMovePickerNormalSearchWithPromotionUpgradeToPromotionCaptureHashmove(t
 	game := FromFen(fen)
 	engine := NewEngine(NewCache(2), NewPawnCache(2), nil)
 	engine.ClearForSearch()
-	mp.RecycleWith(game.Position(), engine, 1, EmptyMove, false)
+	mp.RecycleWith(game.Position(), engine, 1, 0, EmptyMove, false)
 	mp.UpgradeToPvMove(NewMove(H7, G8, WhitePawn, BlackKnight, Knight, Capture))
 
 	moves := []Move{
@@ -970,6 +979,73 @@ func TestMovePickerNormalSearchWithPromotionUpgradeToPromotionCaptureHashmove(t
 	}
 }
 
+func TestMovePickerCounterMoveAndHistories(t *testing.T) {
+	fen := "rnbqkb1r/ppp2ppp/5n2/3p4/4P3/2N1P3/PPP2PPP/R1BQKBNR w KQkq - 1 2"
+
+	game := FromFen(fen)
+	engine := NewEngine(NewCache(2), NewPawnCache(2), nil)
+	engine.ClearForSearch()
+	engine.positionMoves[0] = NewMove(E2, E3, WhitePawn, NoPiece, NoType, 0)
+	engine.positionMoves[1] = NewMove(D7, D5, BlackPawn, NoPiece, NoType, 0)
+
+	engine.AddKillerMove(NewMove(B2, B3, WhitePawn, NoPiece, NoType, 0), 1)
+	engine.AddCounterMove(NewMove(G2, G3, WhitePawn, NoPiece, NoType, 0), 1)
+	engine.updateContinuationHistory(NewMove(F2, F4, WhitePawn, NoPiece, NoType, 0), 1, 10)
+	engine.updateContinuationHistory(NewMove(H2, H3, WhitePawn, NoPiece, NoType, 0), 1, -10)
+	engine.AddMoveHistory(NewMove(F1, C4, WhiteBishop, NoPiece, NoType, 0), WhiteBishop, C4, 1)
+
+	// The knight capture caused a cutoff after the pawn capture was tried
+	pawnCapture := NewMove(E4, D5, WhitePawn, BlackPawn, NoType, Capture)
+	knightCapture := NewMove(C3, D5, WhiteKnight, BlackPawn, NoType, Capture)
+	engine.NoteCapture(pawnCapture, 0, 1)
+	engine.AddCaptureHistory(knightCapture, 11, 1, 0)
+	if engine.CaptureHistoryScore(knightCapture) <= 0 || engine.CaptureHistoryScore(pawnCapture) >= 0 {
+		t.Errorf("Unexpected capture history: %d %d\n", engine.CaptureHistoryScore(knightCapture), engine.CaptureHistoryScore(pawnCapture))
+	}
+
+	if counterMove := engine.CounterMove(1); counterMove != NewMove(G2, G3, WhitePawn, NoPiece, NoType, 0) {
+		t.Errorf("Unexpected counter move: %s\n", counterMove.ToString())
+	}
+	if counterMove := engine.CounterMove(2); counterMove != EmptyMove {
+		t.Errorf("Unexpected counter move after an empty move: %s\n", counterMove.ToString())
+	}
+
+	mp.RecycleWith(game.Position(), engine, 1, 1, EmptyMove, false)
+
+	first := []Move{
+		knightCapture,
+		pawnCapture,
+		NewMove(B2, B3, WhitePawn, NoPiece, NoType, 0),
+		NewMove(G2, G3, WhitePawn, NoPiece, NoType, 0),
+		NewMove(F2, F4, WhitePawn, NoPiece, NoType, 0),
+		NewMove(F1, C4, WhiteBishop, NoPiece, NoType, 0),
+	}
+	last := []Move{
+		NewMove(H2, H3, WhitePawn, NoPiece, NoType, 0),
+		NewMove(D1, D5, WhiteQueen, BlackPawn, NoType, Capture),
+	}
+
+	moves := []Move{}
+	for move := mp.Next(); move != EmptyMove; move = mp.Next() {
+		moves = append(moves, move)
+	}
+	if len(moves) != 37 {
+		t.Errorf("Wrong number of moves: %d\n", len(moves))
+		return
+	}
+	for i, expected := range first {
+		if moves[i] != expected {
+			t.Errorf("Move number %d Expected %s But got %s which has score of %d\n", i+1, expected.ToString(), moves[i].ToString(), mp.getScore(moves[i]))
+		}
+	}
+	for i, expected := range last {
+		j := len(moves) - len(last) + i
+		if moves[j] != expected {
+			t.Errorf("Move number %d Expected %s But got %s which has score of %d\n", j+1, expected.ToString(), moves[j].ToString(), mp.getScore(moves[j]))
+		}
+	}
+}
+
 func (mp *MovePicker) getScore(m Move) int32 {
 	if mp.hashmove == m {
 		return 900_000_000
@@ -988,3 +1064,24 @@ func (mp *MovePicker) getScore(m Move) int32 {
 	}
 	return -900_000_000
 }
+
+func TestCaptureHistorySkipsPromotionCaptures(t *testing.T) {
+	engine := NewEngine(NewCache(2), NewPawnCache(2), nil)
+	engine.ClearForSearch()
+
+	// A capture of an earlier node at the same height
+	staleCapture := NewMove(E4, D5, WhitePawn, BlackPawn, NoType, Capture)
+	engine.NoteCapture(staleCapture, 0, 1)
+
+	promotionCapture := NewMove(B7, A8, WhitePawn, BlackRook, Queen, Capture)
+	knightCapture := NewMove(C3, D5, WhiteKnight, BlackPawn, NoType, Capture)
+	engine.NoteCapture(promotionCapture, 0, 1)
+	engine.NoteCapture(knightCapture, 1, 1)
+	engine.AddCaptureHistory(knightCapture, 11, 1, 1)
+	if engine.CaptureHistoryScore(staleCapture) != 0 || engine.CaptureHistoryScore(promotionCapture) != 0 {
+		t.Errorf("Unexpected capture history: %d %d\n", engine.CaptureHistoryScore(staleCapture), engine.CaptureHistoryScore(promotionCapture))
+	}
+	if engine.CaptureHistoryScore(knightCapture) <= 0 {
+		t.Errorf("Expected the cutoff capture to be rewarded, got %d\n", engine.CaptureHistoryScore(knightCapture))
+	}
+}
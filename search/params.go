@@ -0,0 +1,96 @@
+package search
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Search parameters that can be tuned, all of them are integers so that SPSA can
+// perturb them directly. The LMR coefficients are in hundredths.
+type SearchParams struct {
+	AspirationWindow         int16
+	RazoringMargin           int16
+	RazoringDepthMargin      int16
+	ReverseFutilityMargin    int16
+	ReverseFutilityImproving int16
+	NullMoveBaseReduction    int16
+	NullMoveDepthDivisor     int16
+	LMRBase                  int16
+	LMRMoveMultiplier        int16
+	LMRDivisor               int16
+	lmrReductions            [32][32]int
+}
+
+var SearchParamNames = []string{
+	"AspirationWindow",
+	"RazoringMargin",
+	"RazoringDepthMargin",
+	"ReverseFutilityMargin",
+	"ReverseFutilityImproving",
+	"NullMoveBaseReduction",
+	"NullMoveDepthDivisor",
+	"LMRBase",
+	"LMRMoveMultiplier",
+	"LMRDivisor",
+}
+
+func DefaultSearchParams() *SearchParams {
+	params := &SearchParams{}
+	params.Update([]int16{25, 100, 100, 100, 100, 4, 4, 80, 120, 250})
+	return params
+}
+
+func (sp *SearchParams) Values() []int16 {
+	return []int16{
+		sp.AspirationWindow,
+		sp.RazoringMargin,
+		sp.RazoringDepthMargin,
+		sp.ReverseFutilityMargin,
+		sp.ReverseFutilityImproving,
+		sp.NullMoveBaseReduction,
+		sp.NullMoveDepthDivisor,
+		sp.LMRBase,
+		sp.LMRMoveMultiplier,
+		sp.LMRDivisor,
+	}
+}
+
+// Sets the parameters in the same order as SearchParamNames, and recomputes
+// the LMR table
+func (sp *SearchParams) Update(values []int16) {
+	sp.AspirationWindow = values[0]
+	sp.RazoringMargin = values[1]
+	sp.RazoringDepthMargin = values[2]
+	sp.ReverseFutilityMargin = values[3]
+	sp.ReverseFutilityImproving = values[4]
+	sp.NullMoveBaseReduction = values[5]
+	sp.NullMoveDepthDivisor = max16(1, values[6])
+	sp.LMRBase = values[7]
+	sp.LMRMoveMultiplier = max16(1, values[8])
+	sp.LMRDivisor = max16(1, values[9])
+	sp.lmrReductions = initLMR(sp)
+}
+
+func (sp *SearchParams) String() string {
+	var builder strings.Builder
+	for i, value := range sp.Values() {
+		builder.WriteString(fmt.Sprintf("%s: %d\n", SearchParamNames[i], value))
+	}
+	return builder.String()
+}
+
+// This idea is taken from Weiss, which I believe in turn is taken from many open source
+// engines.
+func initLMR(sp *SearchParams) [32][32]int {
+	base := float64(sp.LMRBase) / 100
+	multiplier := float64(sp.LMRMoveMultiplier) / 100
+	divisor := float64(sp.LMRDivisor) / 100
+	var reductions [32][32]int
+	for depth := 1; depth < 32; depth++ {
+		for moves := 1; moves < 32; moves++ {
+			reductions[depth][moves] = int(base + math.Log(float64(depth))*math.Log(multiplier*float64(moves))/divisor)
+		}
+	}
+	return reductions
+}
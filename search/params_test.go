@@ -0,0 +1,44 @@
+package search
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSearchParamsUpdateRoundTrip(t *testing.T) {
+	defaults := DefaultSearchParams()
+	values := defaults.Values()
+	if len(values) != len(SearchParamNames) {
+		t.Fatalf("Expected %d values, got %d", len(SearchParamNames), len(values))
+	}
+
+	params := DefaultSearchParams()
+	changed := make([]int16, len(values))
+	for i, value := range values {
+		changed[i] = value + 7
+	}
+	params.Update(changed)
+	if !reflect.DeepEqual(params.Values(), changed) {
+		t.Errorf("Expected %v, got %v", changed, params.Values())
+	}
+	if params.lmrReductions == defaults.lmrReductions {
+		t.Errorf("Expected the LMR table to change along with the LMR parameters")
+	}
+
+	params.Update(values)
+	if !reflect.DeepEqual(params, defaults) {
+		t.Errorf("Expected the defaults back, got:\n%s", params.String())
+	}
+}
+
+func TestSearchParamsUpdateKeepsDivisorsPositive(t *testing.T) {
+	params := DefaultSearchParams()
+	values := params.Values()
+	values[6] = 0  // NullMoveDepthDivisor
+	values[8] = -3 // LMRMoveMultiplier
+	values[9] = 0  // LMRDivisor
+	params.Update(values)
+	if params.NullMoveDepthDivisor != 1 || params.LMRMoveMultiplier != 1 || params.LMRDivisor != 1 {
+		t.Errorf("Expected the divisors to be clamped to 1, got:\n%s", params.String())
+	}
+}
@@ -42,6 +42,18 @@ func (thisLine *PVLine) Clone(otherLine PVLine) {
 	thisLine.hasFirst = otherLine.hasFirst
 }
 
+func (thisLine *PVLine) SetLine(moves []Move) {
+	thisLine.moveCount = int8(copy(thisLine.line, moves))
+	thisLine.hasFirst = thisLine.moveCount != 0
+}
+
+// A copy of the moves of the line
+func (thisLine *PVLine) Moves() []Move {
+	moves := make([]Move, thisLine.moveCount)
+	copy(moves, thisLine.line)
+	return moves
+}
+
 func (thisLine *PVLine) AddFirst(move Move) {
 	if !thisLine.hasFirst {
 		thisLine.moveCount += 1
@@ -61,7 +73,7 @@ func (thisLine *PVLine) Recycle() {
 
 func (pv *PVLine) Pop() Move {
 	var toReturn Move
-	if pv.moveCount >= 0 {
+	if pv.moveCount > 0 {
 		emptySlice := make([]Move, len(pv.line))
 		mv, newSlice := pv.line[0], pv.line[1:]
 		toReturn = mv
@@ -39,17 +39,30 @@ func dynamicMargin(pos *Position) int16 {
 	return delta + p
 }
 
-func (e *Engine) quiescence(alpha int16, beta int16, searchHeight int8) int16 {
+// The first ply of quiescence, where qsDepth is 0, also searches the quiet
+// moves that give check. Nodes that are in check search all the evasions
+func (e *Engine) quiescence(alpha int16, beta int16, searchHeight int8, qsDepth int8) int16 {
+	if e.trace == nil {
+		return e.quiescenceNode(alpha, beta, searchHeight, qsDepth)
+	}
+	e.trace.enter(e.positionMoves[searchHeight], EmptyMove, searchHeight, qsDepth, alpha, beta, true)
+	e.trace.eval(e.staticEvals[searchHeight])
+	score := e.quiescenceNode(alpha, beta, searchHeight, qsDepth)
+	e.trace.exit(score)
+	return score
+}
+
+func (e *Engine) quiescenceNode(alpha int16, beta int16, searchHeight int8, qsDepth int8) int16 {
 
 	e.info.quiesceCounter += 1
 	e.VisitNode()
 
 	position := e.Position
-	pawnhash := e.Pawnhash
 
 	currentMove := e.positionMoves[searchHeight]
 	// Position is drawn
 	if IsRepetition(position, e.pred, currentMove) || position.IsDraw() {
+		e.trace.prune("draw")
 		return 0
 	}
 
@@ -64,8 +77,10 @@ func (e *Engine) quiescence(alpha int16, beta int16, searchHeight int8) int16 {
 		}
 	}
 
+	isInCheck := position.IsInCheck()
 	standPat := e.staticEvals[searchHeight]
-	if standPat >= beta {
+	if !isInCheck && standPat >= beta {
+		e.trace.prune("stand pat")
 		return beta // fail hard
 	}
 
@@ -77,21 +92,31 @@ func (e *Engine) quiescence(alpha int16, beta int16, searchHeight int8) int16 {
 		return 0
 	}
 
-	// Delta Pruning
-	if standPat+dynamicMargin(position) < alpha {
-		e.info.deltaPruningCounter += 1
-		return alpha
-	}
-
-	if alpha < standPat {
-		alpha = standPat
-	}
-
-	var isInCheck = e.Position.IsInCheck()
 	movePicker := e.MovePickers[searchHeight]
-	movePicker.RecycleWith(position, e, -1, EmptyMove, !isInCheck)
+	movePicker.RecycleWith(position, e, -1, searchHeight, EmptyMove, true)
 
 	bestscore := standPat
+	if isInCheck {
+		// No stand pat, if no evasion works this is a checkmate
+		movePicker.UseEvasions()
+		bestscore = -CHECKMATE_EVAL + int16(searchHeight)
+	} else {
+		// Delta Pruning
+		if standPat+dynamicMargin(position) < alpha {
+			e.info.deltaPruningCounter += 1
+			e.trace.prune("delta")
+			return alpha
+		}
+
+		if alpha < standPat {
+			alpha = standPat
+		}
+
+		if qsDepth == 0 {
+			movePicker.AddQuietChecks()
+		}
+	}
+
 	noisyMoves := -1
 	seeScores := movePicker.captureMoveList.Scores
 
@@ -102,31 +127,42 @@ func (e *Engine) quiescence(alpha int16, beta int16, searchHeight int8) int16 {
 		}
 
 		isCaptureMove := move.IsCapture()
-		if isCaptureMove || move.PromoType() != NoType {
+		isNoisyMove := isCaptureMove || move.PromoType() != NoType
+		if isNoisyMove {
 			noisyMoves += 1
 		}
 
-		if isCaptureMove && seeScores[noisyMoves] < 0 {
-			// SEE pruning
-			e.info.seeQuiescenceCounter += 1
-			continue
-		}
+		if !isInCheck {
+			if isCaptureMove && seeScores[noisyMoves] < 0 {
+				// SEE pruning
+				e.info.seeQuiescenceCounter += 1
+				e.trace.pruneMove(move, "see")
+				continue
+			}
 
-		// promoType := move.PromoType()
-		if !IsPromoting(move) {
-			margin := p + move.CapturedPiece().Weight()
-			if standPat+margin <= alpha {
-				e.info.fpCounter += 1
+			if !isNoisyMove && position.Board.StaticExchangeEval(move.Destination(), NoPiece, move.Source(), move.MovingPiece()) < 0 {
+				// Checks that lose the checking piece
+				e.info.seeQuiescenceCounter += 1
+				e.trace.pruneMove(move, "see")
 				continue
 			}
+
+			if isCaptureMove && !IsPromoting(move) {
+				margin := p + move.CapturedPiece().Weight()
+				if standPat+margin <= alpha {
+					e.info.fpCounter += 1
+					e.trace.pruneMove(move, "futility")
+					continue
+				}
+			}
 		}
 
 		if ep, tg, hc, ok := position.MakeMove(move); ok {
 			e.positionMoves[searchHeight+1] = move
-			e.staticEvals[searchHeight+1] = Evaluate(position, pawnhash, weakColor, weakDelta)
+			e.staticEvals[searchHeight+1] = e.evaluate(weakColor, weakDelta)
 
 			e.pred.Push(position.Hash())
-			score := -e.quiescence(-beta, -alpha, searchHeight+1)
+			score := -e.quiescence(-beta, -alpha, searchHeight+1, qsDepth-1)
 			e.pred.Pop()
 			position.UnMakeMove(move, tg, ep, hc)
 			if score > bestscore {
@@ -0,0 +1,61 @@
+package search
+
+import (
+	. "github.com/amanjpro/zahak/engine"
+)
+
+// A search that runs in other processes, next to the threads of a runner. The
+// results of the remote searches take part in the vote for the best move
+type RemoteSearch interface {
+	// Starts searching the position of the runner
+	Start(runner *Runner, depth int8)
+	// Stops the search, and returns the results of the remote searches
+	Stop() []SearchResult
+}
+
+type SearchResult struct {
+	Line  []Move
+	Score int16
+	Depth int8
+	Nodes int64
+}
+
+// An entry of the transposition table, that is deep enough to be worth sending
+// to other processes
+type SharedEntry struct {
+	Hash  uint64
+	Entry CacheEntry
+}
+
+const DEFAULT_SHARE_DEPTH int8 = 6
+
+// Whether the best move is voted for by all the threads and remote searches, or
+// it is simply the move of the main thread
+func (r *Runner) votesForBestMove() bool {
+	return len(r.Engines) > 1 || r.Remote != nil
+}
+
+// The principal variation of the last search
+func (r *Runner) Line() []Move {
+	return r.pv.Moves()
+}
+
+// The depth of the last search
+func (r *Runner) Depth() int8 {
+	return r.depth
+}
+
+func (e *Engine) result() SearchResult {
+	if e.completedDepth == 0 || e.pv.moveCount == 0 {
+		return SearchResult{Nodes: e.nodesVisited}
+	}
+	return SearchResult{e.pv.Moves(), e.score, e.completedDepth, e.nodesVisited}
+}
+
+// Entries are dropped when nobody reads them fast enough, the search never waits
+func (e *Engine) shareEntry(hash uint64, entry CacheEntry) {
+	select {
+	case e.parent.SharedEntries <- SharedEntry{hash, entry}:
+	default:
+	}
+}
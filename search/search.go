@@ -2,42 +2,147 @@ package search
 
 import (
 	"fmt"
-	"math"
 	"sync"
 
 	. "github.com/amanjpro/zahak/book"
 	. "github.com/amanjpro/zahak/engine"
 	. "github.com/amanjpro/zahak/evaluation"
+	. "github.com/amanjpro/zahak/tablebase"
 )
 
 func (r *Runner) Search(depth int8) {
-	if len(r.Engines) == 1 {
+	if r.SearchMode == MCTS {
+		e := r.Engines[0]
+		r.ClearForSearch()
+		e.ClearForSearch()
+		e.mctsSearch(depth)
+		r.SendBestMove()
+		return
+	}
+	r.Engines[0].trace = r.Trace
+	if len(r.Engines) == 1 && r.Remote == nil {
 		e := r.Engines[0]
 		e.Search(depth)
 	} else {
 		r.ClearForSearch()
+		if r.Remote != nil {
+			r.Remote.Start(r, depth)
+		}
 		var wg sync.WaitGroup
 		for i := 0; i < len(r.Engines); i++ {
 			wg.Add(1)
-			go func(e *Engine, depth int8, i int) {
-				e.ParallelSearch(depth, int8(1+i%2), 2)
+			go func(e *Engine, depth int8) {
+				e.ParallelSearch(depth)
 				wg.Done()
-			}(r.Engines[i], depth, i)
+			}(r.Engines[i], depth)
 		}
 		wg.Wait()
+		var remote []SearchResult
+		if r.Remote != nil {
+			remote = r.Remote.Stop()
+			for _, result := range remote {
+				r.remoteNodes += result.Nodes
+			}
+		}
+		r.selectBestThread(remote)
 		r.SendBestMove()
 	}
+	if r.Trace != nil && r.Trace.Path != "" {
+		if err := r.Trace.Save(r.Trace.Path); err != nil {
+			fmt.Printf("info string %s\n", err)
+		} else {
+			fmt.Printf("info string saved the search trace to %s\n", r.Trace.Path)
+		}
+	}
+}
+
+// Picks the move of the thread with the most votes, every thread votes for its
+// move by its score and depth. Idea is taken from Stockfish. The results of the
+// remote searches, if any, vote too
+func (r *Runner) selectBestThread(remote []SearchResult) {
+	if r.isBookmove {
+		r.Engines[0].SendPv(r.pv, r.score, r.depth)
+		return
+	}
+	results := make([]SearchResult, 0, len(r.Engines)+len(remote))
+	for _, e := range r.Engines {
+		results = append(results, e.result())
+	}
+	results = append(results, remote...)
+
+	minScore := int64(MAX_INT)
+	for _, result := range results {
+		if result.Depth > 0 && int64(result.Score) < minScore {
+			minScore = int64(result.Score)
+		}
+	}
+	votes := make(map[Move]int64, len(results))
+	for _, result := range results {
+		if result.Depth > 0 {
+			votes[result.Line[0]] += (int64(result.Score) - minScore + 14) * int64(result.Depth)
+		}
+	}
+
+	best := 0
+	for i := 1; i < len(results); i++ {
+		result := results[i]
+		bestResult := results[best]
+		if result.Depth == 0 {
+			continue
+		}
+		if bestResult.Depth == 0 {
+			best = i
+		} else if isCheckmateEval(bestResult.Score) {
+			// The shortest mate, or the longest way to be mated
+			if result.Score > bestResult.Score {
+				best = i
+			}
+		} else if isCheckmateEval(result.Score) {
+			if result.Score > 0 {
+				best = i
+			}
+		} else if vote, bestVote := votes[result.Line[0]], votes[bestResult.Line[0]]; vote > bestVote ||
+			(vote == bestVote && result.Depth > bestResult.Depth) {
+			best = i
+		}
+	}
+
+	if r.DebugMode {
+		for i, result := range results {
+			name := fmt.Sprintf("thread %d", i)
+			if i >= len(r.Engines) {
+				name = fmt.Sprintf("remote %d", i-len(r.Engines))
+			}
+			move := EmptyMove
+			if result.Depth > 0 {
+				move = result.Line[0]
+			}
+			fmt.Printf("info string %s depth %d nodes %d score %s move %s votes %d\n", name, result.Depth,
+				result.Nodes, ScoreToCp(result.Score), move.ToString(), votes[move])
+		}
+	}
+
+	if results[best].Depth == 0 {
+		return
+	}
+	r.mu.Lock()
+	r.pv.SetLine(results[best].Line)
+	r.move = r.pv.MoveAt(0)
+	r.score = results[best].Score
+	r.depth = results[best].Depth
+	r.mu.Unlock()
+	r.Engines[0].SendPv(r.pv, r.score, r.depth)
 }
 
-func (e *Engine) ParallelSearch(depth int8, start int8, inc int8) {
+func (e *Engine) ParallelSearch(depth int8) {
 	e.ClearForSearch()
-	e.rootSearch(depth, start, inc)
+	e.rootSearch(depth)
 }
 
 func (e *Engine) Search(depth int8) {
 	e.parent.ClearForSearch()
 	e.ClearForSearch()
-	e.rootSearch(depth, 1, 1)
+	e.rootSearch(depth)
 	e.parent.SendBestMove()
 }
 
@@ -49,21 +154,12 @@ var (
 	WIN_IN_MAX = CHECKMATE_EVAL - int16(MAX_DEPTH)
 )
 
-var lmrReductions [32][32]int = initLMR()
-
-// This idea is taken from Weiss, which I believe in turn is taken from many open source
-// engines.
-func initLMR() [32][32]int {
-	var reductions [32][32]int
-	for depth := 1; depth < 32; depth++ {
-		for moves := 1; moves < 32; moves++ {
-			reductions[depth][moves] = int(0.8 + math.Log(float64(depth))*math.Log(1.2*float64(moves))/2.5)
-		}
-	}
-	return reductions
-}
-
-func (e *Engine) updatePv(pvLine PVLine, score int16, depth int8, isBookmove bool) (PVLine, int16, int8, bool) {
+// Records the result of an iteration of the thread, the runner keeps the deepest
+// result of all threads, which is what is reported while searching
+func (e *Engine) updatePv(pvLine PVLine, score int16, depth int8, isBookmove bool) bool {
+	e.pv.Clone(pvLine)
+	e.score = score
+	e.completedDepth = depth
 	parent := e.parent
 	parent.mu.Lock()
 	updated := false
@@ -74,27 +170,45 @@ func (e *Engine) updatePv(pvLine PVLine, score int16, depth int8, isBookmove boo
 		parent.depth = depth
 		parent.isBookmove = isBookmove
 		updated = true
-	} else {
-		score = parent.score
-		depth = parent.depth
-		pvLine.Clone(parent.pv)
 	}
 	parent.mu.Unlock()
-	return pvLine, score, depth, updated
+	return updated
 }
 
-func (e *Engine) rootSearch(depth int8, startDepth int8, depthIncrement int8) {
+// Helper threads skip some of the depths, so that they do not all search the
+// same depth at the same time, the schedule is taken from Stockfish
+var skipSize = []int{1, 1, 2, 2, 2, 2, 3, 3, 3, 3, 3, 3, 4, 4, 4, 4, 4, 4, 4, 4}
+var skipPhase = []int{0, 1, 0, 1, 2, 3, 0, 1, 2, 3, 4, 5, 0, 1, 2, 3, 4, 5, 6, 7}
+
+func (e *Engine) skipsDepth(depth int8) bool {
+	if e.threadIndex == 0 || e.abdada {
+		return false
+	}
+	i := (e.threadIndex - 1) % len(skipSize)
+	return ((int(depth)+int(e.Ply)+skipPhase[i])/skipSize[i])%2 != 0
+}
+
+func (e *Engine) rootSearch(depth int8) {
 	pv := NewPVLine(MAX_DEPTH)
 
 	lastDepth := int8(1)
 
 	bookmove := GetBookMove(e.Position)
+	tbmove := EmptyMove
+	var tbscore int16
+	if e.isMainThread && bookmove == EmptyMove {
+		tbmove, tbscore = e.tablebaseMove()
+	}
 	if e.isMainThread && bookmove != EmptyMove {
 		pv.Recycle()
 		pv.AddFirst(bookmove)
-		pv, e.score, _, _ = e.updatePv(pv, 0, 1, true)
+		e.updatePv(pv, 0, 1, true)
+	} else if e.isMainThread && tbmove != EmptyMove {
+		pv.Recycle()
+		pv.AddFirst(tbmove)
+		e.updatePv(pv, tbscore, 1, true)
 	} else {
-		for iterationDepth := startDepth; iterationDepth <= depth; iterationDepth += depthIncrement {
+		for iterationDepth := int8(1); iterationDepth <= depth; iterationDepth++ {
 
 			if e.isMainThread {
 				if iterationDepth > 1 && !e.TimeManager().CanStartNewIteration() {
@@ -105,12 +219,10 @@ func (e *Engine) rootSearch(depth int8, startDepth int8, depthIncrement int8) {
 			}
 
 			var bookmove bool
-			var globalDepth int8
 			e.parent.mu.RLock()
-			globalDepth = e.parent.depth
 			bookmove = e.parent.isBookmove
-			e.score = e.parent.score
 			e.vsHuman = e.parent.VsHuman
+			e.abdada = e.parent.SMPMode == ABDADA && len(e.parent.Engines) > 1
 			e.meColor = e.Position.Turn()
 			e.parent.mu.RUnlock()
 
@@ -118,35 +230,32 @@ func (e *Engine) rootSearch(depth int8, startDepth int8, depthIncrement int8) {
 				break
 			}
 
-			if iterationDepth <= globalDepth {
+			if e.skipsDepth(iterationDepth) {
 				continue
 			}
 
+			if e.isMainThread {
+				e.trace.startIteration(iterationDepth)
+			}
 			e.innerLines[0].Recycle()
-			e.startDepth = iterationDepth
 			newScore := e.aspirationWindow(e.score, iterationDepth)
 
 			if (e.isMainThread && e.TimeManager().AbruptStop) || (!e.isMainThread && e.parent.Stop) {
 				break
 			}
-			if e.startDepth == 0 {
-				continue
-			}
 			pv.Clone(e.innerLines[0])
 
 			if e.isMainThread && iterationDepth >= 8 && e.score-newScore >= 30 { // Position degrading
 				e.TimeManager().ExtraTime()
 			}
 
-			var newDepth int8
-			var updated bool
-			pv, e.score, newDepth, updated = e.updatePv(pv, newScore, iterationDepth, false)
+			updated := e.updatePv(pv, newScore, iterationDepth, false)
 
-			lastDepth = newDepth
+			lastDepth = iterationDepth
 			e.pred.Clear()
 			e.ShareInfo()
 			if updated {
-				e.SendPv(pv, e.score, newDepth)
+				e.SendPv(pv, e.score, lastDepth)
 			}
 			if e.isMainThread && !e.TimeManager().Pondering && e.parent.DebugMode {
 				e.parent.globalInfo.Print()
@@ -160,7 +269,10 @@ func (e *Engine) rootSearch(depth int8, startDepth int8, depthIncrement int8) {
 	if e.isMainThread {
 		e.TimeManager().Pondering = false
 		e.parent.Stop = true
-		e.SendPv(pv, e.score, lastDepth)
+		if !e.parent.votesForBestMove() {
+			// Otherwise, the line of the best thread is sent after all threads stop
+			e.SendPv(pv, e.score, lastDepth)
+		}
 	}
 }
 
@@ -169,15 +281,12 @@ func (e *Engine) aspirationWindow(prevScore int16, iterationDepth int8) int16 {
 	if iterationDepth <= 6 {
 		return e.alphaBeta(iterationDepth, 0, -MAX_INT, MAX_INT)
 	} else {
-		alphaMargin := int16(25)
-		betaMargin := int16(25)
+		alphaMargin := e.params.AspirationWindow
+		betaMargin := e.params.AspirationWindow
 		for i := 0; i < 2; i++ {
 			alpha := max16(prevScore-alphaMargin, -MAX_INT)
 			beta := min16(prevScore+betaMargin, MAX_INT)
 			score := e.alphaBeta(iterationDepth, 0, alpha, beta)
-			if e.startDepth == 0 {
-				return -MAX_INT
-			}
 			if score <= alpha {
 				alphaMargin *= 2
 			} else if score >= beta {
@@ -190,6 +299,39 @@ func (e *Engine) aspirationWindow(prevScore int16, iterationDepth int8) int16 {
 	return e.alphaBeta(iterationDepth, 0, -MAX_INT, MAX_INT)
 }
 
+// Looks the root position up in the tablebases, the move is empty if the
+// position is not in the tablebases
+func (e *Engine) tablebaseMove() (Move, int16) {
+	if !IsTablebaseLoaded() {
+		return EmptyMove, 0
+	}
+	move, wdl, dtm, ok := ProbeRoot(e.Position)
+	if !ok {
+		return EmptyMove, 0
+	}
+	e.TablebaseHit()
+	e.ShareInfo()
+	return move, tablebaseScore(wdl, dtm, 0, e.Position.HalfMoveClock)
+}
+
+// Converts a tablebase result to a score, wins and losses are scored as mates.
+// A mate that is further away than the fifty-move rule allows is a draw. The
+// tables only know the distance to mate, so this also draws some wins that a
+// capture or a pawn move on the way would save
+func tablebaseScore(wdl WDL, dtm int16, searchHeight int8, halfMoveClock uint8) int16 {
+	if int16(halfMoveClock)+dtm > 100 {
+		return 0
+	}
+	mate := CHECKMATE_EVAL - int16(searchHeight) - dtm
+	switch wdl {
+	case Won:
+		return mate
+	case Lost:
+		return -mate
+	}
+	return 0
+}
+
 func weakDelta(h int16) int16 {
 	if h > 32 {
 		return 16
@@ -197,18 +339,65 @@ func weakDelta(h int16) int16 {
 	return h / 2
 }
 
+// Evaluates the current position, it is looked up in the eval hash first. Against
+// humans, the evaluation depends on the search height and it is never cached
+func (e *Engine) evaluate(weakColor Color, weakDelta int16) int16 {
+	position := e.Position
+	if e.vsHuman {
+		return Evaluate(position, e.Pawnhash, e.Materialhash, weakColor, weakDelta)
+	}
+	hash := position.Hash()
+	if eval, ok := e.Evalhash.Get(hash); ok {
+		return eval
+	}
+	eval := Evaluate(position, e.Pawnhash, e.Materialhash, weakColor, weakDelta)
+	e.Evalhash.Set(hash, eval)
+	return eval
+}
+
+func (e *Engine) storeInTT(hash uint64, move Move, score int16, depthLeft int8, nodeType NodeType, searchHeight int8) {
+	e.ttCounters.Writes += 1
+	if e.TranspositionTable.Set(hash, move, score, e.staticEvals[searchHeight], depthLeft, nodeType, e.Ply) {
+		e.ttCounters.Overwrites += 1
+	}
+	if e.parent.SharedEntries != nil && depthLeft >= e.parent.ShareDepth {
+		e.shareEntry(hash, CacheEntry{
+			Move:       move.Compact(),
+			Eval:       score,
+			StaticEval: e.staticEvals[searchHeight],
+			Depth:      depthLeft,
+			Type:       nodeType,
+			Age:        e.Ply,
+		})
+	}
+}
+
 func (e *Engine) alphaBeta(depthLeft int8, searchHeight int8, alpha int16, beta int16) int16 {
+	if e.trace == nil {
+		return e.alphaBetaNode(depthLeft, searchHeight, alpha, beta)
+	}
+	excluded := EmptyMove
+	if e.skipHeight == searchHeight {
+		excluded = e.skipMove
+	}
+	e.trace.enter(e.positionMoves[searchHeight], excluded, searchHeight, depthLeft, alpha, beta, false)
+	score := e.alphaBetaNode(depthLeft, searchHeight, alpha, beta)
+	e.trace.exit(score)
+	return score
+}
+
+func (e *Engine) alphaBetaNode(depthLeft int8, searchHeight int8, alpha int16, beta int16) int16 {
 	e.VisitNode()
 
 	isRootNode := searchHeight == 0
 	isPvNode := alpha != beta-1
 
 	position := e.Position
-	pawnhash := e.Pawnhash
 
 	currentMove := e.positionMoves[searchHeight]
 	// Position is drawn
 	if IsRepetition(position, e.pred, currentMove) || position.IsDraw() {
+		e.trace.prune("draw")
 		return 0
 	}
 
@@ -224,20 +413,22 @@ func (e *Engine) alphaBeta(depthLeft int8, searchHeight int8, alpha int16, beta
 	}
 
 	if searchHeight >= MAX_DEPTH-1 {
-		eval := Evaluate(position, pawnhash, weakColor, weakDelta)
+		eval := e.evaluate(weakColor, weakDelta)
 		e.staticEvals[searchHeight] = eval
+		e.trace.eval(eval)
 		return eval
 	}
 
 	isInCheck := position.IsInCheck()
 	if isInCheck {
 		e.info.checkExtentionCounter += 1
+		e.trace.extend(1)
 		depthLeft += 1 // Check Extension
 	}
 
 	if depthLeft <= 0 {
-		e.staticEvals[searchHeight] = Evaluate(position, pawnhash, weakColor, weakDelta)
-		return e.quiescence(alpha, beta, searchHeight)
+		e.staticEvals[searchHeight] = e.evaluate(weakColor, weakDelta)
+		return e.quiescence(alpha, beta, searchHeight, 0)
 	}
 
 	if isPvNode {
@@ -248,25 +439,33 @@ func (e *Engine) alphaBeta(depthLeft int8, searchHeight int8, alpha int16, beta
 
 	firstLayerOfSingularity := e.skipHeight == searchHeight && e.skipMove != EmptyMove
 	hash := position.Hash()
-	nHashMove, nEval, nDepth, nType, ttHit := e.TranspositionTable.Get(hash)
+	nCompactMove, nEval, nStaticEval, nDepth, nType, ttHit := e.TranspositionTable.Get(hash)
+	e.ttCounters.Probes += 1
+	if ttHit {
+		e.ttCounters.Hits += 1
+	}
+	nHashMove := position.MoveFromCompact(nCompactMove)
 	if !isPvNode && ttHit && nDepth >= depthLeft && !firstLayerOfSingularity {
-		if nEval >= beta && nType == LowerBound {
+		if (nEval >= beta && nType == LowerBound) || (nEval <= alpha && nType == UpperBound) || nType == Exact {
 			e.CacheHit()
+			e.trace.prune("tt cutoff")
 			return nEval
 		}
-		if nEval <= alpha && nType == UpperBound {
-			e.CacheHit()
-			return nEval
-		}
-		if nType == Exact {
-			e.CacheHit()
-			return nEval
+	}
+
+	// Positions with castling or en passant rights are never found in the tables
+	if !isRootNode && !firstLayerOfSingularity && IsTablebaseLoaded() {
+		if wdl, dtm, ok := ProbeTablebase(position); ok {
+			e.TablebaseHit()
+			e.trace.prune("tablebase")
+			return tablebaseScore(wdl, dtm, searchHeight, position.HalfMoveClock)
 		}
 	}
 
 	// Internal iterative reduction based on Rebel's idea
 	if !isPvNode && !ttHit && depthLeft >= 3 {
 		e.info.internalIterativeReduction += 1
+		e.trace.reduce(1)
 		depthLeft -= 1
 	}
 
@@ -283,11 +482,14 @@ func (e *Engine) alphaBeta(depthLeft int8, searchHeight int8, alpha int16, beta
 	var eval int16 = -MAX_INT
 	if !isRootNode && currentMove == EmptyMove {
 		eval = -1 * (e.staticEvals[searchHeight-1] + Tempo + Tempo)
+	} else if ttHit && !e.vsHuman {
+		eval = nStaticEval
 	} else {
-		eval = Evaluate(position, pawnhash, weakColor, weakDelta)
+		eval = e.evaluate(weakColor, weakDelta)
 	}
 
 	e.staticEvals[searchHeight] = eval
+	e.trace.eval(eval)
 	improving := currentMove == EmptyMove ||
 		(searchHeight > 2 && e.staticEvals[searchHeight] > e.staticEvals[searchHeight-2])
 
@@ -296,27 +498,29 @@ func (e *Engine) alphaBeta(depthLeft int8, searchHeight int8, alpha int16, beta
 
 	if pruningAllowed {
 		// Razoring
-		razoringMargin := eval + int16(depthLeft)*p + p
+		razoringMargin := eval + int16(depthLeft)*e.params.RazoringDepthMargin + e.params.RazoringMargin
 		if depthLeft < 3 && eval+razoringMargin < beta {
-			newEval := e.quiescence(alpha, beta, searchHeight)
+			newEval := e.quiescence(alpha, beta, searchHeight, 0)
 			e.info.razoringCounter += 1
+			e.trace.prune("razoring")
 			return newEval
 		}
 
 		// Reverse Futility Pruning
-		reverseFutilityMargin := int16(depthLeft) * p //(b - p)
+		reverseFutilityMargin := int16(depthLeft) * e.params.ReverseFutilityMargin
 		if improving {
-			reverseFutilityMargin += p // int16(depthLeft) * p
+			reverseFutilityMargin += e.params.ReverseFutilityImproving
 		}
 		if depthLeft < 8 && eval-reverseFutilityMargin >= beta {
 			e.info.rfpCounter += 1
+			e.trace.prune("rfp")
 			return eval - reverseFutilityMargin /* fail soft */
 		}
 
 		// NullMove pruning
 		isNullMoveAllowed := currentMove != EmptyMove && !position.IsEndGame()
 		if isNullMoveAllowed && depthLeft >= 2 && eval > beta {
-			R := 4 + depthLeft/4
+			R := int8(e.params.NullMoveBaseReduction) + depthLeft/int8(e.params.NullMoveDepthDivisor)
 			if eval >= beta+50 {
 				R = min8(R, depthLeft)
 			} else {
@@ -332,6 +536,7 @@ func (e *Engine) alphaBeta(depthLeft int8, searchHeight int8, alpha int16, beta
 				position.UnMakeNullMove(ep)
 				if score >= beta {
 					e.info.nullMoveCounter += 1
+					e.trace.prune("null move")
 					return score
 				}
 			}
@@ -347,7 +552,7 @@ func (e *Engine) alphaBeta(depthLeft int8, searchHeight int8, alpha int16, beta
 				hashMove = nHashMove
 			}
 			movePicker := e.MovePickers[searchHeight]
-			movePicker.RecycleWith(position, e, depthLeft, hashMove, true)
+			movePicker.RecycleWith(position, e, depthLeft, searchHeight, hashMove, true)
 			seeScores := movePicker.captureMoveList.Scores
 			i := 0
 			for true {
@@ -361,9 +566,9 @@ func (e *Engine) alphaBeta(depthLeft int8, searchHeight int8, alpha int16, beta
 						e.innerLines[searchHeight+1].Recycle()
 						e.pred.Push(position.Hash())
 						e.positionMoves[searchHeight+1] = move
-						childEval := Evaluate(position, pawnhash, weakColor, weakDelta)
+						childEval := e.evaluate(weakColor, weakDelta)
 						e.staticEvals[searchHeight+1] = childEval
-						score = -e.quiescence(-probBeta, -probBeta+1, searchHeight+1)
+						score = -e.quiescence(-probBeta, -probBeta+1, searchHeight+1, 0)
 						e.pred.Pop()
 					}
 
@@ -378,6 +583,7 @@ func (e *Engine) alphaBeta(depthLeft int8, searchHeight int8, alpha int16, beta
 
 					if score >= probBeta {
 						e.info.probCutCounter += 1
+						e.trace.prune("probcut")
 						return score
 					}
 				}
@@ -404,7 +610,7 @@ func (e *Engine) alphaBeta(depthLeft int8, searchHeight int8, alpha int16, beta
 	}
 
 	movePicker := e.MovePickers[searchHeight]
-	movePicker.RecycleWith(position, e, depthLeft, nHashMove, false)
+	movePicker.RecycleWith(position, e, depthLeft, searchHeight, nHashMove, false)
 	oldAlpha := alpha
 
 	// using fail soft with negamax:
@@ -413,6 +619,7 @@ func (e *Engine) alphaBeta(depthLeft int8, searchHeight int8, alpha int16, beta
 	legalMoves := 0
 	quietMoves := -1
 	legalQuiteMove := -1
+	legalCaptureMoves := -1
 	noisyMoves := -1
 	for true {
 		hashmove = movePicker.Next()
@@ -434,6 +641,8 @@ func (e *Engine) alphaBeta(depthLeft int8, searchHeight int8, alpha int16, beta
 			legalMoves += 1
 			if isQuiet {
 				legalQuiteMove += 1
+			} else if hashmove.IsCapture() {
+				legalCaptureMoves += 1
 			}
 			// Singular Extension
 			var extension int8
@@ -473,6 +682,7 @@ func (e *Engine) alphaBeta(depthLeft int8, searchHeight int8, alpha int16, beta
 				if pruningAllowed {
 					if threshold >= beta {
 						e.info.multiCutCounter += 1
+						e.trace.prune("multi-cut")
 						return beta
 					} else if score >= beta {
 						e.skipHeight = 0
@@ -487,6 +697,7 @@ func (e *Engine) alphaBeta(depthLeft int8, searchHeight int8, alpha int16, beta
 						e.info.multiCutCounter += 1
 
 						if score >= beta {
+							e.trace.prune("multi-cut")
 							return beta
 						}
 					}
@@ -500,16 +711,19 @@ func (e *Engine) alphaBeta(depthLeft int8, searchHeight int8, alpha int16, beta
 			e.innerLines[searchHeight+1].Recycle()
 			e.positionMoves[searchHeight+1] = hashmove
 			e.NoteMove(hashmove, legalQuiteMove, searchHeight)
+			e.NoteCapture(hashmove, legalCaptureMoves, searchHeight)
+			e.trace.reduceNext(0, extension)
 			bestscore = -e.alphaBeta(depthLeft-1+extension, searchHeight+1, -beta, -alpha)
 			e.pred.Pop()
 			position.UnMakeMove(hashmove, oldTag, oldEnPassant, hc)
 			if bestscore > alpha {
 				if bestscore >= beta {
+					e.noteCutoff(legalMoves)
 					if (e.isMainThread && !e.TimeManager().AbruptStop) || (!e.isMainThread && !e.parent.Stop) {
 						if !firstLayerOfSingularity {
-							e.TranspositionTable.Set(hash, hashmove, bestscore, depthLeft, LowerBound, e.Ply)
+							e.storeInTT(hash, hashmove, bestscore, depthLeft, LowerBound, searchHeight)
 						}
-						e.AddHistory(hashmove, hashmove.MovingPiece(), hashmove.Destination(), depthLeft, searchHeight, legalQuiteMove)
+						e.AddHistory(hashmove, hashmove.MovingPiece(), hashmove.Destination(), depthLeft, searchHeight, legalQuiteMove, legalCaptureMoves)
 					}
 					return bestscore
 				}
@@ -545,6 +759,8 @@ func (e *Engine) alphaBeta(depthLeft int8, searchHeight int8, alpha int16, beta
 	quietScores := movePicker.quietMoveList.Scores
 	var historyThreashold int32 = int32(depthLeft) * -1024
 	var move Move
+	e.deferredMoves[searchHeight].Size = 0
+	e.deferredMoves[searchHeight].Next = 0
 	for true {
 
 		if isRootNode {
@@ -553,25 +769,45 @@ func (e *Engine) alphaBeta(depthLeft int8, searchHeight int8, alpha int16, beta
 			}
 		}
 
+		var moveScore int32
+		isDeferred := false
 		move = movePicker.Next()
 		if move == EmptyMove {
-			break
+			// Moves that other threads were searching come last
+			move, moveScore = e.nextDeferredMove(searchHeight)
+			if move == EmptyMove {
+				break
+			}
+			isDeferred = true
 		}
 
 		isCaptureMove := move.IsCapture()
 		promoType := move.PromoType()
-		isQuiet := false
-		if isCaptureMove || promoType != NoType {
-			noisyMoves += 1
-		} else {
-			isQuiet = true
-			quietMoves += 1
+		isQuiet := !isCaptureMove && promoType == NoType
+		if !isDeferred {
+			if isQuiet {
+				quietMoves += 1
+				moveScore = quietScores[quietMoves]
+			} else {
+				noisyMoves += 1
+				moveScore = seeScores[noisyMoves]
+			}
 		}
 
 		if oldEnPassant, oldTag, hc, ok := position.MakeMove(move); ok {
+			childHash := position.Hash()
+			// The eldest brother is always searched right away, it sets the bounds
+			// that the other moves are searched with
+			if !isDeferred && legalMoves != 0 && e.shouldDefer(childHash, depthLeft) {
+				position.UnMakeMove(move, oldTag, oldEnPassant, hc)
+				e.deferMove(searchHeight, move, moveScore)
+				continue
+			}
 			legalMoves += 1
 			if isQuiet {
 				legalQuiteMove += 1
+			} else if isCaptureMove {
+				legalCaptureMoves += 1
 			}
 
 			if e.isMainThread && e.parent.DebugMode && isRootNode {
@@ -579,6 +815,7 @@ func (e *Engine) alphaBeta(depthLeft int8, searchHeight int8, alpha int16, beta
 			}
 
 			e.NoteMove(move, legalQuiteMove, searchHeight)
+			e.NoteCapture(move, legalCaptureMoves, searchHeight)
 			isCheckMove := position.IsInCheck()
 			notPromoting := !IsPromoting(move)
 			LMR := int8(0)
@@ -590,22 +827,25 @@ func (e *Engine) alphaBeta(depthLeft int8, searchHeight int8, alpha int16, beta
 				if notPromoting && !isCaptureMove && !isCheckMove && depthLeft <= 8 &&
 					legalMoves > pruningThreashold && killerScore <= 0 && abs16(alpha) < WIN_IN_MAX {
 					e.info.lmpCounter += 1
+					e.trace.pruneMove(move, "lmp")
 					position.UnMakeMove(move, oldTag, oldEnPassant, hc)
 					continue // LMP
 				}
 
 				// SEE pruning
-				if isCaptureMove && seeScores[noisyMoves] < 0 &&
+				if isCaptureMove && moveScore < 0 &&
 					!isCheckMove && depthLeft <= 2 && eval <= alpha && abs16(alpha) < WIN_IN_MAX {
 					e.info.seeCounter += 1
+					e.trace.pruneMove(move, "see")
 					position.UnMakeMove(move, oldTag, oldEnPassant, hc)
 					continue
 				}
 
 				// History pruning
-				lmrDepth := depthLeft - int8(lmrReductions[min8(31, depthLeft)][min(31, legalMoves)])
-				if killerScore <= 0 && !isCheckMove && isQuiet && quietScores[quietMoves] < historyThreashold && lmrDepth < 3 && legalMoves > lmrThreashold {
+				lmrDepth := depthLeft - int8(e.params.lmrReductions[min8(31, depthLeft)][min(31, legalMoves)])
+				if killerScore <= 0 && !isCheckMove && isQuiet && moveScore < historyThreashold && lmrDepth < 3 && legalMoves > lmrThreashold {
 					e.info.historyPruningCounter += 1
+					e.trace.pruneMove(move, "history")
 					position.UnMakeMove(move, oldTag, oldEnPassant, hc)
 					continue
 				}
@@ -614,10 +854,13 @@ func (e *Engine) alphaBeta(depthLeft int8, searchHeight int8, alpha int16, beta
 			// Late Move Reduction
 			if !isInCheck && e.doPruning && isQuiet && depthLeft > 2 && legalMoves > lmrThreashold {
 				e.info.lmrCounter += 1
-				LMR = int8(lmrReductions[min8(31, depthLeft)][min(31, legalMoves)])
+				LMR = int8(e.params.lmrReductions[min8(31, depthLeft)][min(31, legalMoves)])
 
-				if killerScore > 0 {
+				if killerScore > 0 || moveScore == COUNTER_MOVE_SCORE {
 					LMR -= 1
+				} else {
+					// Moves with a good history are reduced less, and the ones with a bad history more
+					LMR -= int8(max32(-2, min32(2, moveScore/16384)))
 				}
 
 				if isPvNode {
@@ -628,16 +871,14 @@ func (e *Engine) alphaBeta(depthLeft int8, searchHeight int8, alpha int16, beta
 					LMR -= 1
 				}
 
-				// if killerScore <= 0 && quietScores[quietMoves] > 0 {
-				// 	LMR -= 1 //int8(quietScores[quietMoves] / 8192)
-				// }
-
 				LMR = min8(depthLeft-2, max8(LMR, 1))
 			}
 
+			e.startSearching(childHash, depthLeft)
 			e.pred.Push(position.Hash())
 			e.innerLines[searchHeight+1].Recycle()
 			e.positionMoves[searchHeight+1] = move
+			e.trace.reduceNext(LMR, 0)
 			score := -e.alphaBeta(depthLeft-1-LMR, searchHeight+1, -alpha-1, -alpha)
 			e.pred.Pop()
 			if score > alpha && score < beta {
@@ -651,15 +892,17 @@ func (e *Engine) alphaBeta(depthLeft int8, searchHeight int8, alpha int16, beta
 					alpha = score
 				}
 			}
+			e.finishSearching(childHash, depthLeft)
 			position.UnMakeMove(move, oldTag, oldEnPassant, hc)
 
 			if score > bestscore {
 				if score >= beta {
+					e.noteCutoff(legalMoves)
 					if (e.isMainThread && !e.TimeManager().AbruptStop) || (!e.isMainThread && !e.parent.Stop) {
 						if !firstLayerOfSingularity {
-							e.TranspositionTable.Set(hash, move, score, depthLeft, LowerBound, e.Ply)
+							e.storeInTT(hash, move, score, depthLeft, LowerBound, searchHeight)
 						}
-						e.AddHistory(move, move.MovingPiece(), move.Destination(), depthLeft, searchHeight, legalQuiteMove)
+						e.AddHistory(move, move.MovingPiece(), move.Destination(), depthLeft, searchHeight, legalQuiteMove, legalCaptureMoves)
 					}
 					return score
 				}
@@ -670,22 +913,12 @@ func (e *Engine) alphaBeta(depthLeft int8, searchHeight int8, alpha int16, beta
 				hashmove = move
 			}
 		}
-
-		if !isRootNode && e.startDepth > 6 {
-			e.parent.mu.RLock()
-			if e.startDepth <= e.parent.depth {
-				e.startDepth = 0
-				e.parent.mu.RUnlock()
-				return -MAX_INT
-			}
-			e.parent.mu.RUnlock()
-		}
 	}
 	if (e.isMainThread && !e.TimeManager().AbruptStop) || (!e.isMainThread && !e.parent.Stop) && !firstLayerOfSingularity {
 		if alpha > oldAlpha {
-			e.TranspositionTable.Set(hash, hashmove, bestscore, depthLeft, Exact, e.Ply)
+			e.storeInTT(hash, hashmove, bestscore, depthLeft, Exact, searchHeight)
 		} else {
-			e.TranspositionTable.Set(hash, hashmove, bestscore, depthLeft, UpperBound, e.Ply)
+			e.storeInTT(hash, hashmove, bestscore, depthLeft, UpperBound, searchHeight)
 		}
 	}
 	if e.isMainThread && isRootNode && legalMoves == 1 {
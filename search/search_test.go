@@ -1,12 +1,18 @@
 package search
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"strings"
 	"testing"
 	"time"
 
 	. "github.com/amanjpro/zahak/engine"
 	. "github.com/amanjpro/zahak/evaluation"
+	. "github.com/amanjpro/zahak/tablebase"
 )
 
 func TestBlackShouldFindEscape(t *testing.T) {
@@ -215,3 +221,388 @@ func equalMoves(moves1 []Move, moves2 []Move) bool {
 	}
 	return true
 }
+
+func TestParallelSearchCanFindASimpleTactic(t *testing.T) {
+	game := FromFen("3N1k2/N7/1p2ppR1/1P6/P2pP3/3Pb3/2r4n/3K4 b - - 0 1")
+	r := NewRunner(NewCache(DEFAULT_CACHE_SIZE), NewPawnCache(DEFAULT_PAWNHASH_SIZE), 4)
+	r.AddTimeManager(NewTimeManager(time.Now(), 400_000, true, 0, 0, false))
+	for _, e := range r.Engines {
+		e.Position = game.Position().Copy()
+		e.Ply = 1
+	}
+	r.Search(7)
+	expected := NewMove(C2, D2, BlackRook, NoPiece, NoType, 0)
+	mv := r.Move()
+	if mv != expected {
+		t.Errorf("Unexpected move was played:%s\n", fmt.Sprintf("Expected: %s\nGot: %s\n", expected.ToString(), mv.ToString()))
+	}
+	if r.Nodes() <= r.Engines[0].nodesVisited {
+		t.Errorf("Expected the nodes of all threads to be counted, Got %d\n", r.Nodes())
+	}
+}
+
+func TestSkipBlocks(t *testing.T) {
+	r := NewRunner(NewCache(1), NewPawnCache(1), 8)
+	for depth := int8(1); depth < 20; depth++ {
+		if r.Engines[0].skipsDepth(depth) {
+			t.Errorf("The main thread should not skip depth %d\n", depth)
+		}
+		if r.Engines[1].skipsDepth(depth) == r.Engines[2].skipsDepth(depth) {
+			t.Errorf("The first two helpers should search different depths, depth %d\n", depth)
+		}
+	}
+}
+
+func TestSelectBestThread(t *testing.T) {
+	r := NewRunner(NewCache(1), NewPawnCache(1), 3)
+	e4 := NewMove(E2, E4, WhitePawn, NoPiece, NoType, 0)
+	d4 := NewMove(D2, D4, WhitePawn, NoPiece, NoType, 0)
+	setResult := func(e *Engine, move Move, score int16, depth int8) {
+		e.pv.Recycle()
+		e.pv.AddFirst(move)
+		e.score = score
+		e.completedDepth = depth
+	}
+
+	// Two threads agree on d4, they outvote the main thread
+	setResult(r.Engines[0], e4, 30, 12)
+	setResult(r.Engines[1], d4, 20, 11)
+	setResult(r.Engines[2], d4, 20, 11)
+	r.selectBestThread(nil)
+	if r.Move() != d4 || r.depth != 11 {
+		t.Errorf("Unexpected best thread: %s at depth %d\n", r.Move().ToString(), r.depth)
+	}
+
+	// A mate is preferred
+	setResult(r.Engines[2], e4, CHECKMATE_EVAL-5, 9)
+	r.selectBestThread(nil)
+	if r.Move() != e4 || r.Score() != CHECKMATE_EVAL-5 {
+		t.Errorf("Unexpected best thread: %s with %d\n", r.Move().ToString(), r.Score())
+	}
+}
+
+func TestABDADASearchCanFindASimpleTactic(t *testing.T) {
+	game := FromFen("3N1k2/N7/1p2ppR1/1P6/P2pP3/3Pb3/2r4n/3K4 b - - 0 1")
+	r := NewRunner(NewCache(DEFAULT_CACHE_SIZE), NewPawnCache(DEFAULT_PAWNHASH_SIZE), 4)
+	r.SMPMode = ABDADA
+	r.AddTimeManager(NewTimeManager(time.Now(), 400_000, true, 0, 0, false))
+	for _, e := range r.Engines {
+		e.Position = game.Position().Copy()
+		e.Ply = 1
+	}
+	r.Search(8)
+	expected := NewMove(C2, D2, BlackRook, NoPiece, NoType, 0)
+	mv := r.Move()
+	if mv != expected {
+		t.Errorf("Unexpected move was played:%s\n", fmt.Sprintf("Expected: %s\nGot: %s\n", expected.ToString(), mv.ToString()))
+	}
+	for _, e := range r.Engines {
+		if !e.abdada {
+			t.Errorf("Expected all threads to use ABDADA\n")
+		}
+	}
+}
+
+func TestMCTSCanFindASimpleTactic(t *testing.T) {
+	game := FromFen("3N1k2/N7/1p2ppR1/1P6/P2pP3/3Pb3/2r4n/3K4 b - - 0 1")
+	r := NewRunner(NewCache(DEFAULT_CACHE_SIZE), NewPawnCache(DEFAULT_PAWNHASH_SIZE), 1)
+	r.SearchMode = MCTS
+	r.AddTimeManager(NewTimeManager(time.Now(), 1_000, true, 0, 0, false))
+	e := r.Engines[0]
+	e.Position = game.Position()
+	e.Ply = 1
+	r.Search(MAX_DEPTH)
+	expected := NewMove(C2, D2, BlackRook, NoPiece, NoType, 0)
+	mv := r.Move()
+	if mv != expected {
+		t.Errorf("Unexpected move was played:%s\n", fmt.Sprintf("Expected: %s\nGot: %s\n", expected.ToString(), mv.ToString()))
+	}
+}
+
+func TestMCTSReusesTheTree(t *testing.T) {
+	game := FromFen("rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1")
+	r := NewRunner(NewCache(1), NewPawnCache(1), 1)
+	r.SearchMode = MCTS
+	r.AddTimeManager(NewTimeManager(time.Now(), 300, true, 0, 0, false))
+	e := r.Engines[0]
+	e.Position = game.Position()
+	r.Search(MAX_DEPTH)
+
+	best := r.mctsTree.bestChild()
+	reply := best.bestChild()
+	if reply == nil || reply.visits == 0 {
+		t.Fatalf("Expected the reply to be searched\n")
+	}
+	game.Move(best.move)
+	game.Move(reply.move)
+	visits := reply.visits
+	if root := r.mctsRoot(game.Position().Hash()); root != reply || root.visits != visits {
+		t.Errorf("Expected the subtree of the position to be reused\n")
+	}
+	if root := r.mctsRoot(game.Position().Hash() ^ 1); root == reply || root.visits != 0 {
+		t.Errorf("Expected a new tree for an unknown position\n")
+	}
+}
+
+func TestMCTSTreeStaysWithinTheHashBudget(t *testing.T) {
+	game := FromFen("r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1")
+	r := NewRunner(NewCache(1), NewPawnCache(1), 1)
+	r.SearchMode = MCTS
+	r.AddTimeManager(NewTimeManager(time.Now(), MAX_TIME, false, 0, 0, false))
+	e := r.Engines[0]
+	e.Position = game.Position()
+	r.ClearForSearch()
+	e.ClearForSearch()
+
+	root := r.mctsRoot(e.Position.Hash())
+	e.expand(root, 0)
+	budget := r.mctsBudget()
+	path := make([]mctsStep, 0, MCTS_MAX_HEIGHT+1)
+	playouts := 0
+	for ; playouts < 10_000 && r.mctsNodes < budget; playouts++ {
+		path, _ = e.playout(root, path)
+	}
+	if r.mctsNodes < budget {
+		t.Fatalf("Expected the tree to be full after %d playouts, Got %d nodes\n", playouts, r.mctsNodes)
+	}
+	for i := 0; i < 500; i++ {
+		path, _ = e.playout(root, path)
+	}
+
+	size := root.size()
+	if size != r.mctsNodes {
+		t.Errorf("Expected the tree to have %d nodes, Got %d\n", r.mctsNodes, size)
+	}
+	// The budget can be exceeded by the children of the last expanded node, a
+	// position has at most 218 legal moves
+	if size > budget+218 {
+		t.Errorf("Expected the tree to stay within the budget of %d nodes, Got %d\n", budget, size)
+	}
+	if root.visits != int64(playouts+500) {
+		t.Errorf("Expected every playout to be counted, Got %d visits\n", root.visits)
+	}
+}
+
+func TestSearchTrace(t *testing.T) {
+	game := FromFen("3N1k2/N7/1p2ppR1/1P6/P2pP3/3Pb3/2r4n/3K4 b - - 0 1")
+	r := NewRunner(NewCache(1), NewPawnCache(1), 1)
+	r.Trace = NewSearchTrace(5_000, 3)
+	r.AddTimeManager(NewTimeManager(time.Now(), MAX_TIME, false, 0, 0, false))
+	e := r.Engines[0]
+	e.Position = game.Position()
+	e.Ply = 1
+	r.Search(6)
+
+	trace := r.Trace
+	if len(trace.Roots) == 0 || trace.Depth != r.depth {
+		t.Fatalf("Expected the last iteration to be traced, Got depth %d\n", trace.Depth)
+	}
+	if trace.Nodes > 5_000 {
+		t.Errorf("Expected at most 5000 nodes, Got %d\n", trace.Nodes)
+	}
+	pruning := map[string]bool{}
+	var walk func(node *TraceNode)
+	walk = func(node *TraceNode) {
+		if node.Height > 3 {
+			t.Errorf("Expected no node deeper than 3, Got %d\n", node.Height)
+		}
+		if node.Score != nil && !node.Quiescence && node.Height > 0 && node.Move == "" {
+			t.Errorf("Expected the move of the node\n")
+		}
+		if node.Pruning != "" {
+			pruning[node.Pruning] = true
+		}
+		for _, child := range node.Children {
+			if child.Height != node.Height+1 && child.Excluded == "" && !child.Quiescence {
+				t.Errorf("Expected the child to be one ply deeper\n")
+			}
+			walk(child)
+		}
+	}
+	for _, root := range trace.Roots {
+		walk(root)
+	}
+	if len(pruning) == 0 {
+		t.Errorf("Expected some pruning to be recorded\n")
+	}
+	if *trace.Roots[len(trace.Roots)-1].Score != r.Score() {
+		t.Errorf("Expected the score of the root to be recorded\n")
+	}
+
+	var out strings.Builder
+	if err := trace.WriteJSON(&out); err != nil || !json.Valid([]byte(out.String())) {
+		t.Errorf("Expected a valid JSON trace, Got %v\n", err)
+	}
+	out.Reset()
+	if err := trace.WriteDOT(&out); err != nil || !strings.HasPrefix(out.String(), "digraph search {") {
+		t.Errorf("Expected a DOT trace, Got %v\n", err)
+	}
+}
+
+func quiescenceScore(fen string) int16 {
+	game := FromFen(fen)
+	r := NewRunner(NewCache(DEFAULT_CACHE_SIZE), NewPawnCache(DEFAULT_PAWNHASH_SIZE), 1)
+	r.AddTimeManager(NewTimeManager(time.Now(), 400_000, true, 0, 0, false))
+	e := r.Engines[0]
+	e.Position = game.Position()
+	e.ClearForSearch()
+	e.staticEvals[0] = e.evaluate(NoColor, 0)
+	return e.quiescence(-MAX_INT, MAX_INT, 0, 0)
+}
+
+func TestQuiescenceFindsAMateWithAQuietCheck(t *testing.T) {
+	score := quiescenceScore("6k1/5ppp/8/8/8/8/5PPP/R5K1 w - - 0 1")
+	if score != CHECKMATE_EVAL-1 {
+		t.Errorf("Expected a mate in one, got: %d\n", score)
+	}
+}
+
+func TestQuiescenceFindsAForkWithAQuietCheck(t *testing.T) {
+	score := quiescenceScore("r3k3/8/8/1N6/8/8/4P3/4K3 w - - 0 1")
+	if score <= 0 {
+		t.Errorf("Expected Nc7+ to win the rook, got: %d\n", score)
+	}
+}
+
+func TestQuiescenceDoesNotStandPatInCheck(t *testing.T) {
+	score := quiescenceScore("R5k1/5ppp/8/8/8/8/5PPP/6K1 b - - 0 1")
+	if score != -CHECKMATE_EVAL {
+		t.Errorf("Expected a checkmate, got: %d\n", score)
+	}
+}
+
+func TestSearchIgnoresCollidingHashMoves(t *testing.T) {
+	fen := "r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1"
+	game := FromFen(fen)
+	tt := NewCache(DEFAULT_CACHE_SIZE)
+
+	// Every position near the root gets the entry of a made up position, whose
+	// move starts from a square of the side to move
+	random := rand.New(rand.NewSource(49))
+	var collide func(p *Position, depth int)
+	collide = func(p *Position, depth int) {
+		own := make([]Square, 0, 16)
+		for sq := A1; sq <= H8; sq++ {
+			if piece := p.Board.PieceAt(sq); piece != NoPiece && piece.Color() == p.Turn() {
+				own = append(own, sq)
+			}
+		}
+		move := CompactMove(uint16(own[random.Intn(len(own))]) | uint16(random.Intn(64))<<6 | uint16(random.Intn(8))<<12)
+		tt.Import(p.Hash(), CacheEntry{Move: move, Eval: 0, StaticEval: 0, Depth: 0, Type: UpperBound, Age: 0})
+		if depth == 0 {
+			return
+		}
+		for _, m := range p.LegalMoves() {
+			ep, tg, hc, _ := p.MakeMove(m)
+			collide(p, depth-1)
+			p.UnMakeMove(m, tg, ep, hc)
+		}
+	}
+	collide(game.Position(), 3)
+
+	r := NewRunner(tt, NewPawnCache(DEFAULT_PAWNHASH_SIZE), 1)
+	r.AddTimeManager(NewTimeManager(time.Now(), MAX_TIME, false, 0, 0, false))
+	e := r.Engines[0]
+	e.Position = game.Position()
+	r.Search(5)
+
+	if !strings.HasPrefix(fen, e.Position.Fen()) {
+		t.Errorf("The board was corrupted, Got: %s\n", e.Position.Fen())
+	}
+	if !game.IsLegalMove(r.Move()) {
+		t.Errorf("Expected a legal move, Got: %s\n", r.Move().ToString())
+	}
+}
+
+func TestPVLinePopOnEmptyLine(t *testing.T) {
+	pv := NewPVLine(10)
+	if mv := pv.Pop(); mv != EmptyMove || len(pv.Moves()) != 0 {
+		t.Errorf("Expected nothing to pop from an empty line, Got %s %v\n", mv.ToString(), pv.Moves())
+	}
+
+	e2e4 := NewMove(E2, E4, WhitePawn, NoPiece, NoType, 0)
+	e7e5 := NewMove(E7, E5, BlackPawn, NoPiece, NoType, 0)
+	pv.SetLine([]Move{e2e4, e7e5})
+	if mv := pv.Pop(); mv != e2e4 {
+		t.Errorf("Expected to pop %s, Got %s\n", e2e4.ToString(), mv.ToString())
+	}
+	pv.Pop()
+	if mv := pv.Pop(); mv != EmptyMove || len(pv.Moves()) != 0 {
+		t.Errorf("Expected the line to be empty, Got %s %v\n", mv.ToString(), pv.Moves())
+	}
+}
+
+func TestQuietSearchPrintsNothing(t *testing.T) {
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = writer
+	output := make(chan string)
+	go func() {
+		data, _ := io.ReadAll(reader)
+		output <- string(data)
+	}()
+
+	game := FromFen("rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1")
+	r := NewRunner(NewCache(DEFAULT_CACHE_SIZE), NewPawnCache(DEFAULT_PAWNHASH_SIZE), 1)
+	r.Quiet = true
+	r.AddTimeManager(NewTimeManager(time.Now(), 400_000, true, 0, 0, false))
+	r.Engines[0].Position = game.Position()
+	r.Search(5)
+
+	os.Stdout = stdout
+	writer.Close()
+	if printed := <-output; printed != "" {
+		t.Errorf("Expected no output, got:\n%s", printed)
+	}
+	if r.Move() == EmptyMove {
+		t.Errorf("Expected a move")
+	}
+}
+
+func TestTablebaseScoreRespectsTheFiftyMoveRule(t *testing.T) {
+	tests := []struct {
+		wdl           WDL
+		dtm           int16
+		halfMoveClock uint8
+		expected      int16
+	}{
+		{Won, 11, 0, CHECKMATE_EVAL - 3 - 11},
+		{Lost, 10, 0, -(CHECKMATE_EVAL - 3 - 10)},
+		{Won, 11, 89, CHECKMATE_EVAL - 3 - 11},
+		{Won, 11, 90, 0},
+		{Lost, 30, 80, 0},
+		{Drawn, 0, 99, 0},
+	}
+	for _, test := range tests {
+		if actual := tablebaseScore(test.wdl, test.dtm, 3, test.halfMoveClock); actual != test.expected {
+			t.Errorf("%d in %d with a clock of %d: expected %d, got %d", test.wdl, test.dtm, test.halfMoveClock, test.expected, actual)
+		}
+	}
+}
+
+func TestContinuationHistoriesSurviveUntilANewGame(t *testing.T) {
+	r := NewRunner(NewCache(1), NewPawnCache(DEFAULT_PAWNHASH_SIZE), 1)
+	e := r.Engines[0]
+	e.ClearForSearch()
+	previous := NewMove(E7, E5, BlackPawn, NoPiece, NoType, 0)
+	move := NewMove(G1, F3, WhiteKnight, NoPiece, NoType, 0)
+	e.positionMoves[1] = previous
+	e.updateContinuationHistory(move, 1, 100)
+	score := e.ContinuationHistoryScore(move, 1)
+	if score <= 0 {
+		t.Fatalf("Expected a bonus, got %d\n", score)
+	}
+
+	e.ClearForSearch()
+	if actual := e.ContinuationHistoryScore(move, 1); actual != score {
+		t.Errorf("Expected the history to be kept for the next search, got %d instead of %d\n", actual, score)
+	}
+
+	r.ClearHistories()
+	if actual := e.ContinuationHistoryScore(move, 1); actual != 0 {
+		t.Errorf("Expected a new game to clear the history, got %d\n", actual)
+	}
+}
@@ -0,0 +1,268 @@
+package search
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "github.com/amanjpro/zahak/engine"
+)
+
+// A search trace records the nodes that the main thread visits in the last
+// iteration of a search, with their windows, depths, static evaluations, the
+// pruning and reductions that were applied, and their scores. The moves that
+// were pruned without being searched are recorded too. Tracing is slow, it is
+// meant for debugging a single position
+type SearchTrace struct {
+	MaxNodes  int    `json:"maxNodes"`  // Nodes after this budget are searched, but not recorded
+	MaxHeight int8   `json:"maxHeight"` // Nodes deeper than this are searched, but not recorded
+	Path      string `json:"-"`         // When set, the trace is saved there after every search
+
+	Depth     int8 `json:"depth"`
+	Nodes     int  `json:"nodes"`
+	Truncated bool `json:"truncated"`
+	// Every search of the root in the iteration, the aspiration windows search it
+	// more than once
+	Roots []*TraceNode `json:"roots"`
+
+	stack         []*TraceNode // nil for the nodes that are not recorded
+	nextReduction int8
+	nextExtension int8
+}
+
+type TraceNode struct {
+	Move       string       `json:"move,omitempty"`
+	Excluded   string       `json:"excluded,omitempty"` // The move a singular search excludes
+	Height     int8         `json:"height"`
+	Depth      int8         `json:"depth"`
+	Alpha      int16        `json:"alpha"`
+	Beta       int16        `json:"beta"`
+	Quiescence bool         `json:"quiescence,omitempty"`
+	StaticEval *int16       `json:"staticEval,omitempty"`
+	Reduction  int8         `json:"reduction,omitempty"`
+	Extension  int8         `json:"extension,omitempty"`
+	Pruning    string       `json:"pruning,omitempty"`
+	Score      *int16       `json:"score,omitempty"` // Missing for the moves that were pruned
+	Children   []*TraceNode `json:"children,omitempty"`
+}
+
+const DEFAULT_TRACE_NODES = 100_000
+const DEFAULT_TRACE_HEIGHT int8 = 4
+
+func NewSearchTrace(maxNodes int, maxHeight int8) *SearchTrace {
+	return &SearchTrace{MaxNodes: maxNodes, MaxHeight: maxHeight}
+}
+
+func (t *SearchTrace) startIteration(depth int8) {
+	if t == nil {
+		return
+	}
+	t.Depth = depth
+	t.Nodes = 0
+	t.Truncated = false
+	t.Roots = nil
+	t.stack = t.stack[:0]
+	t.nextReduction = 0
+	t.nextExtension = 0
+}
+
+func (t *SearchTrace) current() *TraceNode {
+	if t == nil || len(t.stack) == 0 {
+		return nil
+	}
+	return t.stack[len(t.stack)-1]
+}
+
+func (t *SearchTrace) enter(move Move, excluded Move, height int8, depth int8, alpha int16, beta int16, quiescence bool) {
+	if t == nil {
+		return
+	}
+	reduction, extension := t.nextReduction, t.nextExtension
+	t.nextReduction, t.nextExtension = 0, 0
+	parent := t.current()
+	if (len(t.stack) != 0 && parent == nil) || height > t.MaxHeight {
+		t.stack = append(t.stack, nil)
+		return
+	}
+	if t.Nodes >= t.MaxNodes {
+		t.Truncated = true
+		t.stack = append(t.stack, nil)
+		return
+	}
+	t.Nodes += 1
+	node := &TraceNode{
+		Height:     height,
+		Depth:      depth,
+		Alpha:      alpha,
+		Beta:       beta,
+		Quiescence: quiescence,
+		Reduction:  reduction,
+		Extension:  extension,
+	}
+	if height != 0 {
+		node.Move = traceMove(move)
+	}
+	if excluded != EmptyMove {
+		node.Excluded = excluded.ToString()
+	}
+	if parent == nil {
+		t.Roots = append(t.Roots, node)
+	} else {
+		parent.Children = append(parent.Children, node)
+	}
+	t.stack = append(t.stack, node)
+}
+
+func (t *SearchTrace) exit(score int16) {
+	if t == nil || len(t.stack) == 0 {
+		return
+	}
+	if node := t.current(); node != nil {
+		node.Score = &score
+	}
+	t.stack = t.stack[:len(t.stack)-1]
+}
+
+func (t *SearchTrace) eval(staticEval int16) {
+	if node := t.current(); node != nil {
+		node.StaticEval = &staticEval
+	}
+}
+
+// Records the pruning that ended the current node
+func (t *SearchTrace) prune(kind string) {
+	if node := t.current(); node != nil {
+		node.Pruning = kind
+	}
+}
+
+// Records a move of the current node that was pruned without being searched
+func (t *SearchTrace) pruneMove(move Move, kind string) {
+	node := t.current()
+	if node == nil {
+		return
+	}
+	if t.Nodes >= t.MaxNodes {
+		t.Truncated = true
+		return
+	}
+	t.Nodes += 1
+	node.Children = append(node.Children, &TraceNode{
+		Move:    move.ToString(),
+		Height:  node.Height + 1,
+		Pruning: kind,
+	})
+}
+
+func (t *SearchTrace) reduce(reduction int8) {
+	if node := t.current(); node != nil {
+		node.Reduction += reduction
+	}
+}
+
+func (t *SearchTrace) extend(extension int8) {
+	if node := t.current(); node != nil {
+		node.Extension += extension
+	}
+}
+
+// The reduction and extension of the next child that is searched
+func (t *SearchTrace) reduceNext(reduction int8, extension int8) {
+	if t == nil {
+		return
+	}
+	t.nextReduction = reduction
+	t.nextExtension = extension
+}
+
+func traceMove(move Move) string {
+	if move == EmptyMove {
+		return "null"
+	}
+	return move.ToString()
+}
+
+func (t *SearchTrace) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(t)
+}
+
+// Writes the trace in the DOT language of Graphviz, the moves that were pruned
+// without being searched are dashed, and quiescence nodes are ellipses
+func (t *SearchTrace) WriteDOT(w io.Writer) error {
+	var b strings.Builder
+	b.WriteString("digraph search {\n")
+	b.WriteString("  node [shape=box, fontname=\"monospace\", fontsize=10];\n")
+	b.WriteString("  edge [fontname=\"monospace\", fontsize=10];\n")
+	fmt.Fprintf(&b, "  root [label=\"depth %d\\nnodes %d\", shape=plaintext];\n", t.Depth, t.Nodes)
+	id := 0
+	var write func(parent string, node *TraceNode)
+	write = func(parent string, node *TraceNode) {
+		name := fmt.Sprintf("n%d", id)
+		id += 1
+		attributes := ""
+		if node.Score == nil {
+			attributes = ", style=dashed, color=gray"
+		} else if node.Quiescence {
+			attributes = ", shape=ellipse"
+		}
+		fmt.Fprintf(&b, "  %s [label=\"%s\"%s];\n", name, node.label(), attributes)
+		fmt.Fprintf(&b, "  %s -> %s [label=\"%s\"];\n", parent, name, node.Move)
+		for _, child := range node.Children {
+			write(name, child)
+		}
+	}
+	for _, node := range t.Roots {
+		write("root", node)
+	}
+	b.WriteString("}\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func (node *TraceNode) label() string {
+	lines := []string{}
+	if node.Score == nil {
+		return node.Pruning
+	}
+	if node.Quiescence {
+		lines = append(lines, fmt.Sprintf("qs [%d, %d]", node.Alpha, node.Beta))
+	} else {
+		lines = append(lines, fmt.Sprintf("d %d [%d, %d]", node.Depth, node.Alpha, node.Beta))
+	}
+	if node.Excluded != "" {
+		lines = append(lines, fmt.Sprintf("excluding %s", node.Excluded))
+	}
+	if node.StaticEval != nil {
+		lines = append(lines, fmt.Sprintf("eval %d", *node.StaticEval))
+	}
+	if node.Reduction != 0 {
+		lines = append(lines, fmt.Sprintf("reduced %d", node.Reduction))
+	}
+	if node.Extension != 0 {
+		lines = append(lines, fmt.Sprintf("extended %d", node.Extension))
+	}
+	if node.Pruning != "" {
+		lines = append(lines, node.Pruning)
+	}
+	lines = append(lines, fmt.Sprintf("score %s", ScoreToCp(*node.Score)))
+	return strings.Join(lines, "\\n")
+}
+
+// Saves the trace as DOT if the file ends with .dot or .gv, otherwise as JSON
+func (t *SearchTrace) Save(path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	switch filepath.Ext(path) {
+	case ".dot", ".gv":
+		return t.WriteDOT(file)
+	}
+	return t.WriteJSON(file)
+}
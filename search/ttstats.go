@@ -0,0 +1,80 @@
+package search
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+
+	. "github.com/amanjpro/zahak/engine"
+)
+
+// The counters of the last search, the threads add to them while they search
+func (r *Runner) TTCounters() CacheCounters {
+	return CacheCounters{
+		Probes:     atomic.LoadInt64(&r.ttCounters.Probes),
+		Hits:       atomic.LoadInt64(&r.ttCounters.Hits),
+		Writes:     atomic.LoadInt64(&r.ttCounters.Writes),
+		Overwrites: atomic.LoadInt64(&r.ttCounters.Overwrites),
+	}
+}
+
+func percentage(part int64, total int64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(part) * 100 / float64(total)
+}
+
+// Describes the contents of the table
+func TTStatsReport(tt *Cache) string {
+	stats := tt.Stats()
+	used := int64(stats.Used)
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("Size: %dMB, entries: %d, used: %d (%.2f%%)\n", tt.Size(), stats.Entries, stats.Used,
+		percentage(used, int64(stats.Entries))))
+	sb.WriteString(fmt.Sprintf("Exact: %d (%.2f%%), upper bound: %d (%.2f%%), lower bound: %d (%.2f%%)\n",
+		stats.Exact, percentage(int64(stats.Exact), used),
+		stats.Upper, percentage(int64(stats.Upper), used),
+		stats.Lower, percentage(int64(stats.Lower), used)))
+	sb.WriteString("Depth:")
+	for depth, count := range stats.Depths {
+		if count != 0 {
+			sb.WriteString(fmt.Sprintf(" %d=%d", depth, count))
+		}
+	}
+	sb.WriteString("\nAge:")
+	for age, count := range stats.Ages {
+		if count != 0 {
+			sb.WriteString(fmt.Sprintf(" %d=%d", age, count))
+		}
+	}
+	sb.WriteString("\n")
+	return sb.String()
+}
+
+// Describes how the last search used the table
+func TTCountersReport(counters CacheCounters) string {
+	return fmt.Sprintf("Last search: probes: %d, hits: %d (%.2f%%), writes: %d, overwrites: %d (%.2f%%)\n",
+		counters.Probes, counters.Hits, percentage(counters.Hits, counters.Probes),
+		counters.Writes, counters.Overwrites, percentage(counters.Overwrites, counters.Writes))
+}
+
+// Describes the entry of the position
+func TTProbeReport(tt *Cache, position *Position) string {
+	entry, ok := tt.Lookup(position.Hash())
+	if !ok {
+		return fmt.Sprintf("No entry for %s\n", position.Fen())
+	}
+	bound := "exact"
+	if entry.Type == UpperBound {
+		bound = "upper bound"
+	} else if entry.Type == LowerBound {
+		bound = "lower bound"
+	}
+	move := "none"
+	if m := position.MoveFromCompact(entry.Move); m != EmptyMove {
+		move = m.ToString()
+	}
+	return fmt.Sprintf("Entry for %s\nMove: %s, score: %s (%s), static eval: %d, depth: %d, age: %d\n",
+		position.Fen(), move, ScoreToCp(entry.Eval), bound, entry.StaticEval, entry.Depth, entry.Age)
+}
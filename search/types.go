@@ -11,20 +11,33 @@ import (
 )
 
 type Runner struct {
-	mu           sync.RWMutex
-	Engines      []*Engine
-	globalInfo   Info
-	nodesVisited int64
-	Stop         bool
-	TimeManager  *TimeManager
-	DebugMode    bool
-	cacheHits    int64
-	pv           PVLine
-	isBookmove   bool
-	depth        int8
-	move         Move
-	score        int16
-	VsHuman      bool
+	mu          sync.RWMutex
+	Engines     []*Engine
+	globalInfo  Info
+	Stop        bool
+	TimeManager *TimeManager
+	DebugMode   bool
+	Quiet       bool // When set, the search does not print its progress and best move
+	cacheHits   int64
+	tbHits      int64
+	ttCounters  CacheCounters
+	pv          PVLine
+	isBookmove  bool
+	depth       int8
+	move        Move
+	score       int16
+	remoteNodes int64
+	VsHuman     bool
+	SMPMode     SMPMode
+	SearchMode  SearchMode
+	mctsTree    *mctsNode
+	mctsNodes   int64        // The number of nodes in the tree
+	Trace       *SearchTrace // Records the search of the main thread, when set
+	Remote      RemoteSearch
+	// When set, the entries that are at least ShareDepth deep are sent to it
+	SharedEntries chan SharedEntry
+	ShareDepth    int8
+	params        *SearchParams
 }
 
 type Info struct {
@@ -50,6 +63,11 @@ type Info struct {
 	historyPruningCounter      int64
 	multiCutCounter            int64
 	internalIterativeReduction int64
+	counterMoveCounter         int64
+	captureHistoryCounter      int64
+	betaCutoffCounter          int64
+	firstMoveCutoffCounter     int64
+	cutoffMoveCounter          int64
 }
 
 func (e *Engine) ShareInfo() {
@@ -75,12 +93,22 @@ func (e *Engine) ShareInfo() {
 	atomic.AddInt64(&e.parent.globalInfo.internalIterativeReduction, e.info.internalIterativeReduction)
 	atomic.AddInt64(&e.parent.globalInfo.singularExtensionCounter, e.info.singularExtensionCounter)
 	atomic.AddInt64(&e.parent.globalInfo.multiCutCounter, e.info.multiCutCounter)
+	atomic.AddInt64(&e.parent.globalInfo.counterMoveCounter, e.info.counterMoveCounter)
+	atomic.AddInt64(&e.parent.globalInfo.captureHistoryCounter, e.info.captureHistoryCounter)
+	atomic.AddInt64(&e.parent.globalInfo.betaCutoffCounter, e.info.betaCutoffCounter)
+	atomic.AddInt64(&e.parent.globalInfo.firstMoveCutoffCounter, e.info.firstMoveCutoffCounter)
+	atomic.AddInt64(&e.parent.globalInfo.cutoffMoveCounter, e.info.cutoffMoveCounter)
 
-	atomic.AddInt64(&e.parent.nodesVisited, e.nodesVisited)
 	atomic.AddInt64(&e.parent.cacheHits, e.cacheHits)
+	atomic.AddInt64(&e.parent.tbHits, e.tbHits)
+	atomic.AddInt64(&e.parent.ttCounters.Probes, e.ttCounters.Probes)
+	atomic.AddInt64(&e.parent.ttCounters.Hits, e.ttCounters.Hits)
+	atomic.AddInt64(&e.parent.ttCounters.Writes, e.ttCounters.Writes)
+	atomic.AddInt64(&e.parent.ttCounters.Overwrites, e.ttCounters.Overwrites)
 	e.info = NoInfo
-	e.nodesVisited = 0
 	e.cacheHits = 0
+	e.tbHits = 0
+	e.ttCounters = CacheCounters{}
 }
 
 func (i *Info) Print() {
@@ -105,37 +133,58 @@ func (i *Info) Print() {
 	fmt.Printf("info string History Pruning: %d\n", i.historyPruningCounter)
 	fmt.Printf("info string Singular Extension: %d\n", i.singularExtensionCounter)
 	fmt.Printf("info string Multi-Cut: %d\n", i.multiCutCounter)
+	fmt.Printf("info string Counter Moves: %d\n", i.counterMoveCounter)
+	fmt.Printf("info string Capture History: %d\n", i.captureHistoryCounter)
+	fmt.Printf("info string Beta Cutoffs: %d\n", i.betaCutoffCounter)
+	if i.betaCutoffCounter != 0 {
+		fmt.Printf("info string First Move Cutoffs: %.2f%%\n", float64(i.firstMoveCutoffCounter)*100/float64(i.betaCutoffCounter))
+		fmt.Printf("info string Average Cutoff Move: %.2f\n", float64(i.cutoffMoveCounter)/float64(i.betaCutoffCounter))
+	}
 	fmt.Printf("info string Internal Iterative Reduction: %d\n", i.internalIterativeReduction)
 }
 
 type Engine struct {
-	Position           *Position
-	Ply                uint16
-	nodesVisited       int64
-	cacheHits          int64
-	positionMoves      []Move
-	killerMoves        [][]Move
-	searchHistory      [][]int32
-	MovePickers        []*MovePicker
-	triedQuietMoves    [][]Move
-	info               Info
-	pred               Predecessors
-	score              int16
-	innerLines         []PVLine
-	staticEvals        []int16
-	TranspositionTable *Cache
-	Pawnhash           *PawnCache
-	TotalTime          float64
-	doPruning          bool
-	isMainThread       bool
-	StartTime          time.Time
-	parent             *Runner
-	startDepth         int8
-	skipMove           Move
-	skipHeight         int8
-	TempMovePicker     *MovePicker
-	vsHuman            bool
-	meColor            Color
+	Position            *Position
+	Ply                 uint16
+	nodesVisited        int64
+	cacheHits           int64
+	tbHits              int64
+	ttCounters          CacheCounters
+	positionMoves       []Move
+	killerMoves         [][]Move
+	searchHistory       [][]int32
+	MovePickers         []*MovePicker
+	triedQuietMoves     [][]Move
+	triedCaptureMoves   [][]Move
+	deferredMoves       []*MoveList
+	counterMoves        []Move
+	captureHistory      []int32
+	continuationHistory [2][]int32 // 1-ply and 2-ply
+	info                Info
+	pred                Predecessors
+	score               int16
+	pv                  PVLine
+	completedDepth      int8
+	threadIndex         int
+	innerLines          []PVLine
+	staticEvals         []int16
+	TranspositionTable  *Cache
+	Pawnhash            *PawnCache
+	Materialhash        *MaterialCache
+	Evalhash            *EvalCache
+	TotalTime           float64
+	doPruning           bool
+	isMainThread        bool
+	StartTime           time.Time
+	parent              *Runner
+	skipMove            Move
+	skipHeight          int8
+	TempMovePicker      *MovePicker
+	vsHuman             bool
+	abdada              bool
+	meColor             Color
+	trace               *SearchTrace
+	params              *SearchParams
 }
 
 var MAX_DEPTH int8 = int8(100)
@@ -145,7 +194,7 @@ func (e *Engine) TimeManager() *TimeManager {
 }
 
 func NewRunner(tt *Cache, ph *PawnCache, numberOfThreads int) *Runner {
-	t := &Runner{}
+	t := &Runner{params: DefaultSearchParams()}
 	engines := make([]*Engine, numberOfThreads)
 	for i := 0; i < numberOfThreads; i++ {
 		var engine *Engine
@@ -155,6 +204,7 @@ func NewRunner(tt *Cache, ph *PawnCache, numberOfThreads int) *Runner {
 		} else {
 			engine = NewEngine(tt, NewPawnCache(ph.Size()), t)
 		}
+		engine.threadIndex = i
 		engines[i] = engine
 	}
 	t.pv = NewPVLine(MAX_DEPTH)
@@ -170,8 +220,14 @@ func NewEngine(tt *Cache, ph *PawnCache, parent *Runner) *Engine {
 		innerLines[i] = line
 	}
 	movePickers := make([]*MovePicker, MAX_DEPTH)
+	deferredMoves := make([]*MoveList, MAX_DEPTH)
 	for i := int8(0); i < MAX_DEPTH; i++ {
 		movePickers[i] = EmptyMovePicker()
+		deferredMoves[i] = NewMoveList(250)
+	}
+	params := DefaultSearchParams()
+	if parent != nil {
+		params = parent.params
 	}
 
 	return &Engine{
@@ -179,18 +235,24 @@ func NewEngine(tt *Cache, ph *PawnCache, parent *Runner) *Engine {
 		Ply:                0,
 		nodesVisited:       0,
 		cacheHits:          0,
+		tbHits:             0,
 		score:              0,
+		pv:                 NewPVLine(MAX_DEPTH),
 		positionMoves:      make([]Move, MAX_DEPTH),
 		killerMoves:        make([][]Move, 125), // We assume there will be at most 126 iterations for each move/search
 		searchHistory:      make([][]int32, 12), // We have 12 pieces only
 		MovePickers:        movePickers,
 		triedQuietMoves:    make([][]Move, 250),
+		triedCaptureMoves:  make([][]Move, 250),
+		deferredMoves:      deferredMoves,
 		info:               NoInfo,
 		pred:               NewPredecessors(),
 		innerLines:         innerLines,
 		staticEvals:        make([]int16, MAX_DEPTH),
 		TranspositionTable: tt,
 		Pawnhash:           ph,
+		Materialhash:       NewMaterialCache(DEFAULT_MATERIALHASH_SIZE),
+		Evalhash:           NewEvalCache(DEFAULT_EVALHASH_SIZE),
 		StartTime:          time.Now(),
 		TotalTime:          0,
 		doPruning:          false,
@@ -199,9 +261,21 @@ func NewEngine(tt *Cache, ph *PawnCache, parent *Runner) *Engine {
 		TempMovePicker:     EmptyMovePicker(),
 		skipMove:           EmptyMove,
 		skipHeight:         MAX_DEPTH,
+		params:             params,
+	}
+}
+
+func (r *Runner) SetSearchParams(params *SearchParams) {
+	r.params = params
+	for _, e := range r.Engines {
+		e.params = params
 	}
 }
 
+func (r *Runner) SearchParams() *SearchParams {
+	return r.params
+}
+
 func (t *Runner) AddTimeManager(tm *TimeManager) {
 	t.TimeManager = tm
 }
@@ -209,17 +283,29 @@ func (t *Runner) AddTimeManager(tm *TimeManager) {
 func (r *Runner) Ponderhit() {
 	r.TimeManager.StartTime = time.Now()
 	r.TimeManager.Pondering = false
-	fmt.Printf("info nodes %d\n", r.nodesVisited)
+	fmt.Printf("info nodes %d\n", r.Nodes())
 }
 
-var NoInfo = Info{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}
+var NoInfo = Info{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}
+
+// The number of nodes all the threads visited in the current search, it is
+// safe to call while the threads are searching
+func (r *Runner) Nodes() int64 {
+	nodes := r.remoteNodes
+	for _, e := range r.Engines {
+		nodes += atomic.LoadInt64(&e.nodesVisited)
+	}
+	return nodes
+}
 
 func (r *Runner) ClearForSearch() {
-	r.nodesVisited = 0
 	r.score = -MAX_INT
 	r.depth = 0
+	r.remoteNodes = 0
 	r.isBookmove = false
 	r.cacheHits = 0
+	r.tbHits = 0
+	r.ttCounters = CacheCounters{}
 	r.pv.Pop() // pop our move
 	r.pv.Pop() // pop our opponent's move
 	r.Stop = false
@@ -251,6 +337,8 @@ func (e *Engine) ClearForSearch() {
 		}
 	}
 
+	e.clearHistories()
+
 	for i := 0; i < len(e.triedQuietMoves); i++ {
 		if e.triedQuietMoves[i] == nil {
 			e.triedQuietMoves[i] = make([]Move, 250) // Number of potential legal moves per position
@@ -260,8 +348,12 @@ func (e *Engine) ClearForSearch() {
 		}
 	}
 
-	e.nodesVisited = 0
+	atomic.StoreInt64(&e.nodesVisited, 0)
 	e.cacheHits = 0
+	e.tbHits = 0
+	e.ttCounters = CacheCounters{}
+	e.pv.Recycle()
+	e.completedDepth = 0
 
 	e.info = NoInfo
 	e.StartTime = time.Now()
@@ -286,14 +378,22 @@ func historyBonus(current int32, bonus int32) int32 {
 	return current + 32*bonus - current*abs32(bonus)/512
 }
 
-func (e *Engine) AddHistory(move Move, movingPiece Piece, destination Square, depthLeft int8, searchHeight int8, quietMovesCounter int) {
-	if depthLeft >= 0 && move.PromoType() == NoType && !move.IsCapture() {
+func (e *Engine) AddHistory(move Move, movingPiece Piece, destination Square, depthLeft int8, searchHeight int8, quietMovesCounter int, captureMovesCounter int) {
+	if move.IsCapture() {
+		if depthLeft > 1 && move.PromoType() == NoType {
+			e.AddCaptureHistory(move, depthLeft, searchHeight, captureMovesCounter)
+		}
+		return
+	}
+	if depthLeft >= 0 && move.PromoType() == NoType {
 		e.info.killerCounter += 1
 		if e.killerMoves[depthLeft][0] != move {
 			e.killerMoves[depthLeft][1] = e.killerMoves[depthLeft][0]
 			e.killerMoves[depthLeft][0] = move
 		}
 
+		e.AddCounterMove(move, searchHeight)
+
 		if depthLeft <= 1 {
 			return
 		}
@@ -301,6 +401,7 @@ func (e *Engine) AddHistory(move Move, movingPiece Piece, destination Square, de
 		e.RemoveMoveHistory(move, quietMovesCounter, depthLeft, searchHeight)
 		e.info.historyCounter += 1
 		e.searchHistory[movingPiece-1][destination] = historyBonus(e.searchHistory[movingPiece-1][destination], int32(depthLeft*depthLeft))
+		e.updateContinuationHistory(move, searchHeight, int32(depthLeft*depthLeft))
 	}
 }
 
@@ -324,6 +425,7 @@ func (e *Engine) RemoveMoveHistory(killerMove Move, quietMovesCounter int, depth
 			// value := e.searchHistory[movingPiece-1][destination] - int32(depthLeft*depthLeft)
 			// e.searchHistory[movingPiece-1][destination] = value
 			e.searchHistory[movingPiece-1][destination] = historyBonus(e.searchHistory[movingPiece-1][destination], -int32(depthLeft*depthLeft))
+			e.updateContinuationHistory(move, searchHeight, -int32(depthLeft*depthLeft))
 		}
 	}
 }
@@ -351,6 +453,9 @@ func (e *Engine) AddMoveHistory(move Move, movingPiece Piece, destination Square
 }
 
 func (r *Runner) SendBestMove() {
+	if r.Quiet {
+		return
+	}
 	mv := r.Move()
 	pv := r.pv
 	if pv.moveCount >= 2 {
@@ -373,13 +478,16 @@ func (e *Engine) SendPv(pv PVLine, score int16, depth int8) {
 		depth = pv.moveCount
 	}
 	thinkTime := time.Since(e.StartTime)
-	nodesVisited := e.parent.nodesVisited
+	e.TotalTime = thinkTime.Seconds()
+	if e.parent.Quiet {
+		return
+	}
+	nodesVisited := e.parent.Nodes()
 	nps := int64(float64(nodesVisited) / thinkTime.Seconds())
-	fmt.Printf("info depth %d seldepth %d hashfull %d nodes %d nps %d score %s time %d pv %s\n",
-		depth, pv.moveCount, e.TranspositionTable.Consumed(),
+	fmt.Printf("info depth %d seldepth %d hashfull %d tbhits %d nodes %d nps %d score %s time %d pv %s\n",
+		depth, pv.moveCount, e.TranspositionTable.Hashfull(e.Ply), atomic.LoadInt64(&e.parent.tbHits),
 		nodesVisited, nps, ScoreToCp(score),
 		thinkTime.Milliseconds(), pv.ToString())
-	e.TotalTime = thinkTime.Seconds()
 }
 
 func ScoreToCp(score int16) string {
@@ -393,14 +501,19 @@ func ScoreToCp(score int16) string {
 	return fmt.Sprintf("cp %d", score)
 }
 
+// Other threads read the counter while the search runs, see Runner.Nodes
 func (e *Engine) VisitNode() {
-	e.nodesVisited += 1
+	atomic.AddInt64(&e.nodesVisited, 1)
 }
 
 func (e *Engine) CacheHit() {
 	e.cacheHits += 1
 }
 
+func (e *Engine) TablebaseHit() {
+	e.tbHits += 1
+}
+
 type Predecessors struct {
 	line     []uint64
 	maxIndex int
@@ -466,6 +579,20 @@ func abs32(x int32) int32 {
 	return x
 }
 
+func max32(x int32, y int32) int32 {
+	if x < y {
+		return y
+	}
+	return x
+}
+
+func min32(x int32, y int32) int32 {
+	if x >= y {
+		return y
+	}
+	return x
+}
+
 func abs16(x int16) int16 {
 	if x < 0 {
 		return -x
@@ -487,6 +614,13 @@ func min16(x int16, y int16) int16 {
 	return x
 }
 
+func max64(x int64, y int64) int64 {
+	if x > y {
+		return x
+	}
+	return y
+}
+
 func min8(x int8, y int8) int8 {
 	if x >= y {
 		return y
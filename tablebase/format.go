@@ -0,0 +1,118 @@
+package tablebase
+
+import (
+	"bufio"
+	"compress/flate"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+)
+
+// Every table is stored in its own file, named after the table, e.g. KQKR.ztb.
+// The file starts with a header:
+//
+//   magic    [4]byte  "ZHTB"
+//   version  uint16
+//   name     uint8 length, followed by the name of the table
+//   size     uint32   number of positions in the table
+//   checksum uint32   CRC-32 of the uncompressed values
+//
+// Followed by the values of the table, one byte per position, compressed with DEFLATE
+
+const fileExtension = ".ztb"
+const formatVersion uint16 = 1
+
+var magic = [4]byte{'Z', 'H', 'T', 'B'}
+
+func writeTable(path string, t *table) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := bufio.NewWriter(file)
+	header := []interface{}{
+		magic,
+		formatVersion,
+		uint8(len(t.name)),
+		[]byte(t.name),
+		uint32(t.size),
+		crc32.ChecksumIEEE(t.data),
+	}
+	for _, field := range header {
+		if err := binary.Write(writer, binary.LittleEndian, field); err != nil {
+			return err
+		}
+	}
+
+	compressor, err := flate.NewWriter(writer, flate.BestCompression)
+	if err != nil {
+		return err
+	}
+	if _, err := compressor.Write(t.data); err != nil {
+		return err
+	}
+	if err := compressor.Close(); err != nil {
+		return err
+	}
+	return writer.Flush()
+}
+
+func readTable(path string, name string, size int) ([]uint8, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	var fileMagic [4]byte
+	var version uint16
+	var nameLength uint8
+	if err := binary.Read(reader, binary.LittleEndian, &fileMagic); err != nil {
+		return nil, err
+	}
+	if fileMagic != magic {
+		return nil, fmt.Errorf("%s is not a tablebase file", path)
+	}
+	if err := binary.Read(reader, binary.LittleEndian, &version); err != nil {
+		return nil, err
+	}
+	if version != formatVersion {
+		return nil, fmt.Errorf("%s has version %d, expected %d", path, version, formatVersion)
+	}
+	if err := binary.Read(reader, binary.LittleEndian, &nameLength); err != nil {
+		return nil, err
+	}
+	fileName := make([]byte, nameLength)
+	if _, err := io.ReadFull(reader, fileName); err != nil {
+		return nil, err
+	}
+	if string(fileName) != name {
+		return nil, fmt.Errorf("%s contains %s, expected %s", path, fileName, name)
+	}
+	var fileSize, checksum uint32
+	if err := binary.Read(reader, binary.LittleEndian, &fileSize); err != nil {
+		return nil, err
+	}
+	if int(fileSize) != size {
+		return nil, fmt.Errorf("%s has %d positions, expected %d", path, fileSize, size)
+	}
+	if err := binary.Read(reader, binary.LittleEndian, &checksum); err != nil {
+		return nil, err
+	}
+
+	data := make([]uint8, size)
+	decompressor := flate.NewReader(reader)
+	defer decompressor.Close()
+	if _, err := io.ReadFull(decompressor, data); err != nil {
+		return nil, fmt.Errorf("%s is corrupted: %v", path, err)
+	}
+	if crc32.ChecksumIEEE(data) != checksum {
+		return nil, fmt.Errorf("%s is corrupted: checksum mismatch", path)
+	}
+	return data, nil
+}
@@ -0,0 +1,373 @@
+package tablebase
+
+import (
+	"fmt"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/amanjpro/zahak/engine"
+)
+
+// The tables are generated by retrograde analysis. First, checkmates are found,
+// and moves that leave the table (captures and promotions) are resolved by
+// probing the smaller tables. Then, at level n, only the positions that have a
+// move to a position that got resolved at level n-1 are revisited, a position is
+// won in n plies if it has a move to a position that is lost in n-1 plies, and
+// it is lost in n plies if all of its moves lead to positions that are won in
+// fewer than n plies.
+
+const maxDTM = 253
+
+type generator struct {
+	tbs       *Tablebases // Smaller tables, probed for captures and promotions
+	t         *table
+	position  *Position
+	moves     *MoveList
+	squares   [MaxPieces]Square
+	final     []uint64   // Illegal positions, stalemates and checkmates
+	scheduled [][]uint32 // Positions whose moves that leave the table resolve them at a level
+}
+
+type generationStats struct {
+	wins    int
+	draws   int
+	losses  int
+	longest int16
+}
+
+// Generates all the tables with up to MaxPieces pieces in the directory. Tables
+// that are already in the directory are reused
+func GenerateTablebases(path string) error {
+	return generateTables(path, allTableNames())
+}
+
+// Generates the given tables, they have to be ordered as in allTableNames
+func generateTables(path string, names []string) error {
+	if err := os.MkdirAll(path, 0755); err != nil {
+		return err
+	}
+	tbs := &Tablebases{make(map[uint64]tableRef), path}
+	for start := 0; start < len(names); {
+		// Tables with the same number of pieces and pawns do not depend on each other
+		end := start + 1
+		for end < len(names) && len(names[end]) == len(names[start]) &&
+			strings.Count(names[end], "P") == strings.Count(names[start], "P") {
+			end++
+		}
+		group := make([]*table, end-start)
+		errs := make([]error, end-start)
+		var wg sync.WaitGroup
+		limit := make(chan struct{}, runtime.NumCPU())
+		for i, name := range names[start:end] {
+			t := newTable(name)
+			t.path = filepath.Join(path, name+fileExtension)
+			group[i] = t
+			if data, err := readTable(t.path, t.name, t.size); err == nil {
+				t.data = data
+				fmt.Printf("Found %s\n", t.name)
+				continue
+			}
+			wg.Add(1)
+			go func(i int, t *table) {
+				defer wg.Done()
+				limit <- struct{}{}
+				defer func() { <-limit }()
+				startTime := time.Now()
+				stats := generateTable(tbs, t)
+				errs[i] = writeTable(t.path, t)
+				fmt.Printf("Generated %s in %s, wins: %d, draws: %d, losses: %d, longest mate: %d plies\n",
+					t.name, time.Since(startTime), stats.wins, stats.draws, stats.losses, stats.longest)
+			}(i, t)
+		}
+		wg.Wait()
+		for i, t := range group {
+			if errs[i] != nil {
+				return errs[i]
+			}
+			tbs.register(t)
+		}
+		start = end
+	}
+	return nil
+}
+
+// Generates the values of the table, all the tables it depends on have to be in tbs
+func generateTable(tbs *Tablebases, t *table) generationStats {
+	g := &generator{
+		tbs:       tbs,
+		t:         t,
+		position:  &Position{Board: &Bitboard{}, EnPassant: NoSquare, Positions: make(map[uint64]int)},
+		moves:     NewMoveList(256),
+		final:     make([]uint64, (t.size+63)/64),
+		scheduled: make([][]uint32, maxDTM+2),
+	}
+	t.data = make([]uint8, t.size)
+
+	resolved := g.initialize()
+	candidates := make([]uint64, len(g.final))
+	for level := 1; level <= maxDTM+1; level++ {
+		for _, index := range resolved {
+			g.markPredecessors(int(index), candidates)
+		}
+		for _, index := range g.scheduled[level] {
+			candidates[index/64] |= 1 << (index % 64)
+		}
+		g.scheduled[level] = nil
+
+		resolved = resolved[:0]
+		for word, bb := range candidates {
+			for bb != 0 {
+				index := word*64 + bits.TrailingZeros64(bb)
+				bb &= bb - 1
+				if t.data[index] == 0 && g.final[index/64]&(1<<(index%64)) == 0 && g.resolve(index, level) {
+					resolved = append(resolved, uint32(index))
+				}
+			}
+			candidates[word] = 0
+		}
+		if len(resolved) == 0 && g.nothingScheduledAfter(level) {
+			break
+		}
+		if level > maxDTM {
+			panic(fmt.Sprintf("%s has mates that are longer than %d plies", t.name, maxDTM))
+		}
+	}
+
+	var stats generationStats
+	for index, value := range t.data {
+		if g.final[index/64]&(1<<(index%64)) != 0 && value == 0 {
+			// Illegal or stalemate
+			if g.setup(index) {
+				stats.draws += 1
+			}
+			continue
+		}
+		wdl, dtm := decode(value)
+		switch wdl {
+		case Won:
+			stats.wins += 1
+		case Drawn:
+			stats.draws += 1
+		case Lost:
+			stats.losses += 1
+		}
+		if dtm > stats.longest {
+			stats.longest = dtm
+		}
+	}
+	return stats
+}
+
+func (g *generator) nothingScheduledAfter(level int) bool {
+	for _, positions := range g.scheduled[level+1:] {
+		if len(positions) != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Places the pieces of the position with the given index on the board, returns
+// false if the index is not a legal position
+func (g *generator) setup(index int) bool {
+	squares := g.squares[:len(g.t.pieces)]
+	turn, ok := g.t.decodeIndex(index, squares)
+	return ok && g.position.SetPieces(g.t.pieces, squares, turn)
+}
+
+func (g *generator) legalMoves() []Move {
+	g.moves.Size = 0
+	g.position.GetCaptureMoves(g.moves)
+	g.position.GetQuietMoves(g.moves)
+	return g.moves.Moves[:g.moves.Size]
+}
+
+// Returns the value of the position after the move, from the point of view of
+// the side to move, and whether the position is still in this table
+func (g *generator) child(move Move) (uint8, bool) {
+	if move.IsCapture() || move.PromoType() != NoType {
+		value, ok := g.tbs.probe(g.position)
+		if !ok {
+			panic(fmt.Sprintf("%s needs a table that is not generated yet", g.t.name))
+		}
+		return value, false
+	}
+	var squares [MaxPieces]Square
+	g.t.squaresOf(g.position, false, squares[:len(g.t.pieces)])
+	return g.t.data[g.t.index(squares[:len(g.t.pieces)], g.position.Turn())], true
+}
+
+// Finds the checkmates, marks illegal positions and stalemates as final, and
+// schedules the positions that can be resolved by leaving the table
+func (g *generator) initialize() []uint32 {
+	var checkmates []uint32
+	for index := 0; index < g.t.size; index++ {
+		if !g.setup(index) {
+			g.final[index/64] |= 1 << (index % 64)
+			continue
+		}
+		hasMoves := false
+		hasDraw := false
+		var minLoss, maxWin int16 = maxDTM + 1, -1
+		for _, move := range g.legalMoves() {
+			ep, tg, hc, ok := g.position.MakeMove(move)
+			if !ok {
+				continue
+			}
+			hasMoves = true
+			value, inTable := g.child(move)
+			g.position.UnMakeMove(move, tg, ep, hc)
+			if inTable {
+				continue
+			}
+			wdl, dtm := decode(value)
+			if wdl == Drawn {
+				hasDraw = true
+			} else if wdl == Lost && dtm < minLoss {
+				minLoss = dtm
+			} else if wdl == Won && dtm > maxWin {
+				maxWin = dtm
+			}
+		}
+		if !hasMoves {
+			g.final[index/64] |= 1 << (index % 64)
+			if g.position.IsInCheck() {
+				g.t.data[index] = 1
+				checkmates = append(checkmates, uint32(index))
+			}
+			continue
+		}
+		if minLoss <= maxDTM {
+			g.scheduled[minLoss+1] = append(g.scheduled[minLoss+1], uint32(index))
+		} else if !hasDraw && maxWin >= 0 {
+			// It is lost, unless a move that stays in the table saves it
+			g.scheduled[maxWin+1] = append(g.scheduled[maxWin+1], uint32(index))
+		}
+	}
+	return checkmates
+}
+
+// Tries to resolve the position at the given level, only the positions that are
+// resolved at lower levels are considered known
+func (g *generator) resolve(index int, level int) bool {
+	if !g.setup(index) {
+		return false
+	}
+	var minLoss, maxWin int16 = maxDTM + 1, -1
+	allWins := true
+	for _, move := range g.legalMoves() {
+		ep, tg, hc, ok := g.position.MakeMove(move)
+		if !ok {
+			continue
+		}
+		value, _ := g.child(move)
+		g.position.UnMakeMove(move, tg, ep, hc)
+		wdl, dtm := decode(value)
+		if wdl == Drawn || int(dtm) >= level {
+			allWins = false
+		} else if wdl == Lost && dtm < minLoss {
+			minLoss = dtm
+		} else if wdl == Won && dtm > maxWin {
+			maxWin = dtm
+		}
+	}
+	if minLoss <= maxDTM {
+		g.t.data[index] = uint8(minLoss + 2)
+		return true
+	} else if allWins && maxWin >= 0 {
+		g.t.data[index] = uint8(maxWin + 2)
+		return true
+	}
+	return false
+}
+
+// Marks the positions that can reach the given position with a move that stays
+// in the table, i.e. not a capture nor a promotion
+func (g *generator) markPredecessors(index int, candidates []uint64) {
+	var squares [MaxPieces]Square
+	pieces := g.t.pieces
+	turn, _ := g.t.decodeIndex(index, squares[:len(pieces)])
+	mover := turn.Other()
+
+	var occupied uint64
+	for _, sq := range squares[:len(pieces)] {
+		occupied |= 1 << sq
+	}
+
+	var predecessor [MaxPieces]Square
+	for i, piece := range pieces {
+		if piece.Color() != mover {
+			continue
+		}
+		for _, from := range unmoves(piece, squares[i], occupied) {
+			copy(predecessor[:], squares[:len(pieces)])
+			predecessor[i] = from
+			p := g.t.index(predecessor[:len(pieces)], mover)
+			candidates[p/64] |= 1 << (p % 64)
+		}
+	}
+}
+
+var knightSteps = [][2]int{{1, 2}, {2, 1}, {2, -1}, {1, -2}, {-1, -2}, {-2, -1}, {-2, 1}, {-1, 2}}
+var kingSteps = [][2]int{{1, 0}, {1, 1}, {0, 1}, {-1, 1}, {-1, 0}, {-1, -1}, {0, -1}, {1, -1}}
+var bishopSteps = [][2]int{{1, 1}, {-1, 1}, {-1, -1}, {1, -1}}
+var rookSteps = [][2]int{{1, 0}, {0, 1}, {-1, 0}, {0, -1}}
+
+// Returns the empty squares the piece could have come from, without capturing
+// or promoting
+func unmoves(piece Piece, sq Square, occupied uint64) []Square {
+	switch piece.Type() {
+	case Knight:
+		return steps(sq, occupied, knightSteps, false)
+	case King:
+		return steps(sq, occupied, kingSteps, false)
+	case Bishop:
+		return steps(sq, occupied, bishopSteps, true)
+	case Rook:
+		return steps(sq, occupied, rookSteps, true)
+	case Queen:
+		return append(steps(sq, occupied, bishopSteps, true), steps(sq, occupied, rookSteps, true)...)
+	}
+	// Pawns only move forward, and they cannot come from the first rank
+	back, start := Square(8), Rank4
+	if piece.Color() == Black {
+		back, start = -8, Rank5
+	}
+	single := sq - back
+	if occupied&(1<<single) != 0 || single.Rank() == Rank1 || single.Rank() == Rank8 {
+		return nil
+	}
+	froms := []Square{single}
+	if sq.Rank() == start && occupied&(1<<(single-back)) == 0 {
+		froms = append(froms, single-back)
+	}
+	return froms
+}
+
+func steps(sq Square, occupied uint64, directions [][2]int, slide bool) []Square {
+	var froms []Square
+	for _, d := range directions {
+		file, rank := int(sq.File()), int(sq.Rank())
+		for {
+			file += d[0]
+			rank += d[1]
+			if file < 0 || file > 7 || rank < 0 || rank > 7 {
+				break
+			}
+			from := SquareOf(File(file), Rank(rank))
+			if occupied&(1<<from) != 0 {
+				break
+			}
+			froms = append(froms, from)
+			if !slide {
+				break
+			}
+		}
+	}
+	return froms
+}
@@ -0,0 +1,416 @@
+package tablebase
+
+import (
+	"fmt"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	. "github.com/amanjpro/zahak/engine"
+)
+
+// Zahak's own endgame tablebases, for up to 4 pieces (kings included). Every table
+// stores, for each position, the distance to mate in plies from the point of view
+// of the side to move. A value of 0 is a draw (or an illegal position), otherwise
+// the value is the distance to mate plus one. The side to move wins if the distance
+// to mate is odd, and loses if it is even, i.e. 0 means that it is checkmated.
+// The tables ignore the fifty move rule, castling and en passant.
+
+const MaxPieces = 4
+
+type WDL int8
+
+const (
+	Lost  WDL = -1
+	Drawn WDL = 0
+	Won   WDL = 1
+)
+
+// The order of the pieces in the names and the indices of the tables
+var pieceOrder = []PieceType{Queen, Rook, Bishop, Knight, Pawn}
+
+// The squares of the a1-d1-d4 triangle, where the white king is kept in pawnless tables
+var triangle = []Square{A1, B1, C1, D1, B2, C2, D2, C3, D3, D4}
+var triangleSlot [64]int
+
+func init() {
+	for i := range triangleSlot {
+		triangleSlot[i] = -1
+	}
+	for i, sq := range triangle {
+		triangleSlot[sq] = i
+	}
+}
+
+type table struct {
+	name     string
+	pieces   []Piece // White king, black king, then the other pieces in pieceOrder
+	hasPawns bool
+	size     int
+	path     string
+	data     []uint8
+	once     sync.Once
+	err      error
+}
+
+// A table, and whether the colors of the probed position have to be swapped to
+// match the table
+type tableRef struct {
+	table   *table
+	swapped bool
+}
+
+type Tablebases struct {
+	tables map[uint64]tableRef
+	path   string
+}
+
+var EmptyTablebases = Tablebases{nil, ""}
+var tablebases = EmptyTablebases
+
+// Builds a table from its name, e.g. KQKR means white has a king and a queen, and
+// black has a king and a rook
+func newTable(name string) *table {
+	t := &table{name: name, pieces: []Piece{WhiteKing, BlackKing}}
+	color := White
+	for i, c := range name {
+		if c == 'K' {
+			if i > 0 {
+				color = Black
+			}
+			continue
+		}
+		pieceType := pieceTypeOf(c)
+		if pieceType == Pawn {
+			t.hasPawns = true
+		}
+		t.pieces = append(t.pieces, GetPiece(pieceType, color))
+	}
+	slots := len(triangle)
+	if t.hasPawns {
+		slots = 32
+	}
+	t.size = slots * 2
+	for i := 1; i < len(t.pieces); i++ {
+		t.size *= 64
+	}
+	return t
+}
+
+func pieceTypeOf(c rune) PieceType {
+	switch c {
+	case 'Q':
+		return Queen
+	case 'R':
+		return Rook
+	case 'B':
+		return Bishop
+	case 'N':
+		return Knight
+	case 'P':
+		return Pawn
+	}
+	return NoType
+}
+
+// Lists the names of all the tables with up to MaxPieces pieces, in the order
+// they have to be generated, i.e. a table only depends on the tables before it
+func allTableNames() []string {
+	names := make([]string, 0, 40)
+	// Three pieces
+	for _, p := range pieceOrder {
+		names = append(names, "K"+p.Name()+"K")
+	}
+	// Four pieces, the same side has both pieces or each side has one
+	for i, p := range pieceOrder {
+		for _, q := range pieceOrder[i:] {
+			names = append(names, "K"+p.Name()+q.Name()+"K")
+			names = append(names, "K"+p.Name()+"K"+q.Name())
+		}
+	}
+	// Tables with fewer pieces first, then with fewer pawns, as pawns promote
+	// to tables with fewer pawns but the same number of pieces
+	sorted := make([]string, 0, len(names))
+	for pieces := 3; pieces <= MaxPieces; pieces++ {
+		for pawns := 0; pawns <= MaxPieces-2; pawns++ {
+			for _, name := range names {
+				if len(name) == pieces && strings.Count(name, "P") == pawns {
+					sorted = append(sorted, name)
+				}
+			}
+		}
+	}
+	return sorted
+}
+
+func (tbs *Tablebases) register(t *table) {
+	var white, black [12]int16
+	for _, piece := range t.pieces {
+		white[piece-1] += 1
+		black[swapColor(piece)-1] += 1
+	}
+	tbs.tables[MaterialKeyOf(black)] = tableRef{t, true}
+	// For symmetric tables, like KRKR, the unswapped entry wins
+	tbs.tables[MaterialKeyOf(white)] = tableRef{t, false}
+}
+
+func swapColor(piece Piece) Piece {
+	return GetPiece(piece.Type(), piece.Color().Other())
+}
+
+// Loads the tables that are found in the directory, the tables are read lazily
+// the first time they are probed
+func InitTablebases(path string) error {
+	tbs := Tablebases{make(map[uint64]tableRef), path}
+	found := 0
+	for _, name := range allTableNames() {
+		file := filepath.Join(path, name+fileExtension)
+		if _, err := os.Stat(file); err != nil {
+			continue
+		}
+		t := newTable(name)
+		t.path = file
+		tbs.register(t)
+		found += 1
+	}
+	if found == 0 {
+		return fmt.Errorf("no tablebases found in %s", path)
+	}
+	tablebases = tbs
+	return nil
+}
+
+func ResetTablebases() {
+	tablebases = EmptyTablebases
+}
+
+func IsTablebaseLoaded() bool {
+	return tablebases.tables != nil
+}
+
+func (t *table) load() error {
+	t.once.Do(func() {
+		if t.data == nil {
+			t.data, t.err = readTable(t.path, t.name, t.size)
+		}
+	})
+	return t.err
+}
+
+// Probes the tablebases, returns the result and the distance to mate in plies
+// for the side to move. Positions with castling or en passant rights are not probed
+func ProbeTablebase(p *Position) (WDL, int16, bool) {
+	if p.EnPassant != NoSquare || p.HasTag(WhiteCanCastleKingSide|WhiteCanCastleQueenSide|BlackCanCastleKingSide|BlackCanCastleQueenSide) {
+		return Drawn, 0, false
+	}
+	value, ok := tablebases.probe(p)
+	if !ok {
+		return Drawn, 0, false
+	}
+	wdl, dtm := decode(value)
+	return wdl, dtm, true
+}
+
+// Picks the best move of the position according to the tablebases, i.e. the
+// fastest win, or the slowest loss. Returns the result and the distance to
+// mate in plies for the side to move
+func ProbeRoot(p *Position) (Move, WDL, int16, bool) {
+	if _, _, ok := ProbeTablebase(p); !ok {
+		return EmptyMove, Drawn, 0, false
+	}
+	bestMove := EmptyMove
+	bestRank := -1 << 30
+	var bestWDL WDL
+	var bestDTM int16
+	for _, move := range p.PseudoLegalMoves() {
+		ep, tg, hc, ok := p.MakeMove(move)
+		if !ok {
+			continue
+		}
+		// The tables do not know about en passant, we accept that after a double push
+		value, found := tablebases.probe(p)
+		p.UnMakeMove(move, tg, ep, hc)
+		if !found {
+			return EmptyMove, Drawn, 0, false
+		}
+		childWDL, childDTM := decode(value)
+		wdl := -childWDL
+		dtm := childDTM + 1
+		var rank int
+		switch wdl {
+		case Won:
+			rank = 1000 - int(dtm)
+		case Drawn:
+			rank = 0
+		case Lost:
+			rank = -1000 + int(dtm)
+		}
+		if rank > bestRank {
+			bestRank = rank
+			bestMove = move
+			bestWDL = wdl
+			bestDTM = dtm
+		}
+	}
+	if bestMove == EmptyMove {
+		return EmptyMove, Drawn, 0, false
+	}
+	if bestWDL == Drawn {
+		bestDTM = 0
+	}
+	return bestMove, bestWDL, bestDTM, true
+}
+
+func decode(value uint8) (WDL, int16) {
+	if value == 0 {
+		return Drawn, 0
+	}
+	dtm := int16(value) - 1
+	if dtm%2 == 1 {
+		return Won, dtm
+	}
+	return Lost, dtm
+}
+
+func (tbs *Tablebases) probe(p *Position) (uint8, bool) {
+	if tbs.tables == nil {
+		return 0, false
+	}
+	pieces := int16(0)
+	for _, count := range p.MaterialsOnBoard {
+		pieces += count
+	}
+	if pieces > MaxPieces {
+		return 0, false
+	}
+	if pieces == 2 {
+		return 0, true
+	}
+	ref, ok := tbs.tables[p.MaterialKey()]
+	if !ok {
+		return 0, false
+	}
+	t := ref.table
+	if t.load() != nil {
+		return 0, false
+	}
+	var squares [MaxPieces]Square
+	t.squaresOf(p, ref.swapped, squares[:len(t.pieces)])
+	turn := p.Turn()
+	if ref.swapped {
+		turn = turn.Other()
+	}
+	return t.data[t.index(squares[:len(t.pieces)], turn)], true
+}
+
+// Collects the squares of the pieces of the table from the board
+func (t *table) squaresOf(p *Position, swapped bool, squares []Square) {
+	var taken uint64
+	for i, piece := range t.pieces {
+		if swapped {
+			piece = swapColor(piece)
+		}
+		bb := p.Board.GetBitboardOf(piece) &^ taken
+		sq := Square(bits.TrailingZeros64(bb))
+		taken |= 1 << sq
+		if swapped {
+			sq ^= 56
+		}
+		squares[i] = sq
+	}
+}
+
+// Transforms the squares, so that the white king is in the a-d files, and in
+// the a1-d1-d4 triangle if there are no pawns. Pieces of the same kind are
+// sorted, so that every position has exactly one index
+func (t *table) canonicalize(squares []Square) {
+	if squares[0].File() > FileD {
+		transform(squares, flipFile)
+	}
+	if !t.hasPawns {
+		if squares[0].Rank() > Rank4 {
+			transform(squares, flipRank)
+		}
+		for _, sq := range squares {
+			if sq.Rank() > Rank(sq.File()) {
+				transform(squares, transpose)
+				break
+			} else if sq.Rank() < Rank(sq.File()) {
+				break
+			}
+		}
+	}
+	for i := 1; i < len(squares); i++ {
+		if t.pieces[i] == t.pieces[i-1] && squares[i] < squares[i-1] {
+			squares[i], squares[i-1] = squares[i-1], squares[i]
+		}
+	}
+}
+
+func flipFile(sq Square) Square  { return sq ^ 7 }
+func flipRank(sq Square) Square  { return sq ^ 56 }
+func transpose(sq Square) Square { return ((sq & 7) << 3) | (sq >> 3) }
+
+func transform(squares []Square, f func(Square) Square) {
+	for i, sq := range squares {
+		squares[i] = f(sq)
+	}
+}
+
+// The squares are modified in place
+func (t *table) index(squares []Square, turn Color) int {
+	t.canonicalize(squares)
+	var index int
+	if t.hasPawns {
+		index = int(squares[0].Rank())*4 + int(squares[0].File())
+	} else {
+		index = triangleSlot[squares[0]]
+	}
+	for _, sq := range squares[1:] {
+		index = index*64 + int(sq)
+	}
+	index *= 2
+	if turn == Black {
+		index += 1
+	}
+	return index
+}
+
+// The inverse of index, returns false if the index does not correspond to a
+// canonical arrangement of the pieces
+func (t *table) decodeIndex(index int, squares []Square) (Color, bool) {
+	turn := White
+	if index&1 == 1 {
+		turn = Black
+	}
+	rest := index >> 1
+	for i := len(squares) - 1; i > 0; i-- {
+		squares[i] = Square(rest & 63)
+		rest >>= 6
+	}
+	if t.hasPawns {
+		squares[0] = SquareOf(File(rest%4), Rank(rest/4))
+	} else {
+		squares[0] = triangle[rest]
+	}
+
+	var occupied uint64
+	for i, sq := range squares {
+		if occupied&(1<<sq) != 0 {
+			return turn, false
+		}
+		occupied |= 1 << sq
+		if t.pieces[i].Type() == Pawn && (sq.Rank() == Rank1 || sq.Rank() == Rank8) {
+			return turn, false
+		}
+	}
+
+	var canonical [MaxPieces]Square
+	copy(canonical[:], squares)
+	if t.index(canonical[:len(squares)], turn) != index {
+		return turn, false
+	}
+	return turn, true
+}
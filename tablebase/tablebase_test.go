@@ -0,0 +1,149 @@
+package tablebase
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	. "github.com/amanjpro/zahak/engine"
+)
+
+var threePieceTables = []string{"KQK", "KRK", "KBK", "KNK", "KPK"}
+
+var threePieceTablesDir string
+var threePieceTablesErr error
+var generateOnce sync.Once
+
+// The tables are generated once, and shared by the tests
+func initThreePieceTables(t *testing.T) string {
+	generateOnce.Do(func() {
+		threePieceTablesDir, threePieceTablesErr = os.MkdirTemp("", "tablebases")
+		if threePieceTablesErr == nil {
+			threePieceTablesErr = generateTables(threePieceTablesDir, threePieceTables)
+		}
+	})
+	if threePieceTablesErr != nil {
+		t.Fatal(threePieceTablesErr)
+	}
+	if err := InitTablebases(threePieceTablesDir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(ResetTablebases)
+	return threePieceTablesDir
+}
+
+func TestIndexRoundTrip(t *testing.T) {
+	for _, name := range []string{"KQK", "KPK", "KRKN", "KNNK", "KPKP"} {
+		table := newTable(name)
+		squares := make([]Square, len(table.pieces))
+		decoded := make([]Square, len(table.pieces))
+		valid := 0
+		for index := 0; index < table.size; index++ {
+			turn, ok := table.decodeIndex(index, squares)
+			if !ok {
+				continue
+			}
+			valid += 1
+			copy(decoded, squares)
+			if table.index(decoded, turn) != index {
+				t.Errorf("%s: index %d does not round trip", name, index)
+				break
+			}
+		}
+		if valid == 0 {
+			t.Errorf("%s: no valid index", name)
+		}
+	}
+}
+
+func TestLongestMates(t *testing.T) {
+	dir := t.TempDir()
+	tbs := &Tablebases{make(map[uint64]tableRef), dir}
+	expected := map[string]int16{"KQK": 20, "KRK": 32, "KBK": 0, "KNK": 0}
+	for _, name := range []string{"KQK", "KRK", "KBK", "KNK"} {
+		table := newTable(name)
+		stats := generateTable(tbs, table)
+		tbs.register(table)
+		if stats.longest != expected[name] {
+			t.Errorf("%s: expected the longest mate to be %d plies, got %d", name, expected[name], stats.longest)
+		}
+		if name == "KBK" || name == "KNK" {
+			if stats.wins != 0 || stats.losses != 0 {
+				t.Errorf("%s: expected only draws, got %d wins and %d losses", name, stats.wins, stats.losses)
+			}
+		}
+	}
+}
+
+func TestProbeTablebase(t *testing.T) {
+	initThreePieceTables(t)
+
+	tests := []struct {
+		fen string
+		wdl WDL
+		dtm int16
+	}{
+		{"8/8/8/8/8/8/8/k1K4Q b - - 0 1", Lost, 0},
+		{"k7/8/1K6/8/8/8/7Q/8 w - - 0 1", Won, 1},
+		{"8/7q/8/8/8/1k6/8/K7 b - - 0 1", Won, 1},
+		{"4k3/4P3/4K3/8/8/8/8/8 b - - 0 1", Drawn, 0},
+		{"8/8/8/8/8/4k3/4P3/4K3 w - - 0 1", Drawn, 0},
+		{"4k3/8/4K3/4P3/8/8/8/8 b - - 0 1", Lost, 0},
+		{"8/8/4k3/8/8/8/8/4K2R w K - 0 1", Drawn, 0},
+	}
+	for _, test := range tests {
+		game := FromFen(test.fen)
+		wdl, dtm, ok := ProbeTablebase(game.Position())
+		if test.fen == tests[len(tests)-1].fen {
+			if ok {
+				t.Errorf("%s: positions with castling rights should not be probed", test.fen)
+			}
+			continue
+		}
+		if !ok {
+			t.Errorf("%s: expected a tablebase hit", test.fen)
+			continue
+		}
+		if wdl != test.wdl || (test.dtm != 0 && dtm != test.dtm) {
+			t.Errorf("%s: expected %d in %d, got %d in %d", test.fen, test.wdl, test.dtm, wdl, dtm)
+		}
+	}
+}
+
+func TestProbeRoot(t *testing.T) {
+	initThreePieceTables(t)
+
+	game := FromFen("k7/8/1K6/8/8/8/7Q/8 w - - 0 1")
+	move, wdl, dtm, ok := ProbeRoot(game.Position())
+	if !ok || wdl != Won || dtm != 1 || (move.ToString() != "h2h8" && move.ToString() != "h2g8") {
+		t.Errorf("Expected a mate in one, got %s, %d in %d", move.ToString(), wdl, dtm)
+	}
+}
+
+func TestCorruptedTable(t *testing.T) {
+	dir := initThreePieceTables(t)
+	data, err := os.ReadFile(filepath.Join(dir, "KRK"+fileExtension))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[len(data)-10] ^= 0xFF
+	path := filepath.Join(t.TempDir(), "KRK"+fileExtension)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readTable(path, "KRK", newTable("KRK").size); err == nil {
+		t.Error("Expected a corrupted table to be rejected")
+	}
+	if _, err := readTable(path, "KQK", newTable("KQK").size); err == nil {
+		t.Error("Expected a table with a different name to be rejected")
+	}
+}
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	if threePieceTablesDir != "" {
+		os.RemoveAll(threePieceTablesDir)
+	}
+	os.Exit(code)
+}
@@ -0,0 +1,247 @@
+package tuning
+
+import (
+	"fmt"
+	"math"
+	"runtime"
+	"sync"
+	"time"
+
+	. "github.com/amanjpro/zahak/engine"
+	. "github.com/amanjpro/zahak/evaluation"
+	. "github.com/amanjpro/zahak/search"
+)
+
+// Games longer than this are adjudicated as draws
+const maxGamePlies = 300
+
+// Once the side to move sees a score beyond this, the game is adjudicated
+const adjudicationScore int16 = 1500
+
+// Number of random plies played from the start position to diversify the openings
+const randomOpeningPlies = 8
+
+func searchParameters() []Parameter {
+	defaults := DefaultSearchParams().Values()
+	bounds := [][2]float64{
+		{10, 100},  // AspirationWindow
+		{0, 300},   // RazoringMargin
+		{0, 300},   // RazoringDepthMargin
+		{30, 300},  // ReverseFutilityMargin
+		{0, 300},   // ReverseFutilityImproving
+		{2, 6},     // NullMoveBaseReduction
+		{2, 8},     // NullMoveDepthDivisor
+		{0, 200},   // LMRBase
+		{50, 300},  // LMRMoveMultiplier
+		{100, 500}, // LMRDivisor
+	}
+	params := make([]Parameter, len(defaults))
+	for i, value := range defaults {
+		params[i] = NewParameter(value)
+		params[i].MinValue = bounds[i][0]
+		params[i].MaxValue = bounds[i][1]
+		// Perturb each parameter by roughly 5% of its range at the end of tuning
+		params[i].C_END = math.Max(1, (bounds[i][1]-bounds[i][0])/20)
+		// The match result is the average over its games, so at the end of tuning
+		// a match won outright moves each parameter by R_END * C_END, whatever
+		// the number of games per iteration
+		params[i].R_END = 0.03
+	}
+	return params
+}
+
+// Tunes the search parameters with SPSA. Each iteration perturbs all the parameters
+// at once, plays a few short games between the two perturbed sets, and nudges the
+// parameters towards the winning side
+func SPSASearchTuning(iterations int, gamesPerIteration int, moveTime int64) {
+	tuningVars := searchParameters()
+	theta := make([]float64, len(tuningVars))
+	for p := 0; p < len(theta); p++ {
+		theta[p] = float64(tuningVars[p].OriginalValue)
+	}
+
+	BIG_A := 0.1 * float64(iterations)
+	alpha := 0.602
+	gamma := 0.101
+
+	for p := 0; p < len(theta); p++ {
+		tuningVars[p].C = tuningVars[p].C_END * math.Pow(float64(iterations), gamma)
+		a_end := tuningVars[p].R_END * math.Pow(tuningVars[p].C_END, 2.0)
+		tuningVars[p].A = a_end * math.Pow(BIG_A+float64(iterations), alpha)
+	}
+
+	thetaPlus := make([]int16, len(theta))
+	thetaMinus := make([]int16, len(theta))
+	delta := make([]float64, len(theta))
+	cn := make([]float64, len(theta))
+
+	for n := 0; n < iterations; n++ {
+		for p := 0; p < len(tuningVars); p++ {
+			cn[p] = tuningVars[p].C / math.Pow(float64(n)+1, gamma)
+			delta[p] = randemacher()
+			thetaPlus[p] = int16(math.Round(clamp(theta[p]+delta[p]*cn[p], tuningVars[p])))
+			thetaMinus[p] = int16(math.Round(clamp(theta[p]-delta[p]*cn[p], tuningVars[p])))
+		}
+
+		plus := DefaultSearchParams()
+		plus.Update(thetaPlus)
+		minus := DefaultSearchParams()
+		minus.Update(thetaMinus)
+
+		// Positive if theta plus did better than theta minus, it is in [-1, 1]
+		result := playMatch(plus, minus, gamesPerIteration, moveTime)
+
+		for p := 0; p < len(tuningVars); p++ {
+			an := tuningVars[p].A / math.Pow(BIG_A+float64(n)+1, alpha)
+			theta[p] += an * result / (cn[p] * delta[p])
+			theta[p] = clamp(theta[p], tuningVars[p])
+		}
+
+		fmt.Printf("Iteration %d: match result %.3f\n", n+1, result)
+		for p := 0; p < len(theta); p++ {
+			fmt.Printf("%s: %.2f (Original: %d)\n", SearchParamNames[p], theta[p], tuningVars[p].OriginalValue)
+		}
+		fmt.Println("----------------------------------")
+	}
+
+	final := make([]int16, len(theta))
+	for p := 0; p < len(theta); p++ {
+		final[p] = int16(math.Round(theta[p]))
+	}
+	params := DefaultSearchParams()
+	params.Update(final)
+	fmt.Println("Final search parameters:")
+	fmt.Print(params.String())
+}
+
+func clamp(value float64, param Parameter) float64 {
+	return math.Max(param.MinValue, math.Min(param.MaxValue, value))
+}
+
+// Plays pairs of games from random openings, each opening is played once with each color.
+// Returns (wins - losses) / games from the point of view of the first parameter set
+func playMatch(first *SearchParams, second *SearchParams, games int, moveTime int64) float64 {
+	pairs := (games + 1) / 2
+	openings := make([]string, pairs)
+	for i := 0; i < pairs; i++ {
+		openings[i] = randomOpening()
+	}
+
+	results := make([]float64, 2*pairs)
+	var wg sync.WaitGroup
+	jobs := make(chan int)
+	for w := 0; w < runtime.NumCPU(); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				opening := openings[i/2]
+				if i%2 == 0 {
+					results[i] = playGame(opening, first, second, moveTime)
+				} else {
+					results[i] = 1 - playGame(opening, second, first, moveTime)
+				}
+			}
+		}()
+	}
+	for i := 0; i < len(results); i++ {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	score := 0.0
+	for _, r := range results {
+		score += 2*r - 1
+	}
+	return score / float64(len(results))
+}
+
+// Plays random legal moves from the start position, avoiding games that are
+// already over
+func randomOpening() string {
+	for {
+		game := FromFen(startFen)
+		pos := game.Position()
+		ok := true
+		for i := 0; i < randomOpeningPlies && ok; i++ {
+			moves := legalMoves(pos)
+			if len(moves) == 0 {
+				ok = false
+				break
+			}
+			game.Move(moves[rnd.Intn(len(moves))])
+		}
+		if ok && len(legalMoves(pos)) > 0 {
+			return game.Fen()
+		}
+	}
+}
+
+func legalMoves(pos *Position) []Move {
+	moves := make([]Move, 0, 50)
+	for _, move := range pos.PseudoLegalMoves() {
+		if ep, tg, hc, ok := pos.MakeMove(move); ok {
+			pos.UnMakeMove(move, tg, ep, hc)
+			moves = append(moves, move)
+		}
+	}
+	return moves
+}
+
+// Plays a single game between the two parameter sets, and returns the result from
+// white's point of view
+func playGame(fen string, white *SearchParams, black *SearchParams, moveTime int64) float64 {
+	whiteRunner := NewRunner(NewCache(16), NewPawnCache(2), 1)
+	whiteRunner.SetSearchParams(white)
+	blackRunner := NewRunner(NewCache(16), NewPawnCache(2), 1)
+	blackRunner.SetSearchParams(black)
+	// Only the reports of the tuner should reach stdout
+	whiteRunner.Quiet = true
+	blackRunner.Quiet = true
+
+	game := FromFen(fen)
+	pos := game.Position()
+	for ply := uint16(0); ply < maxGamePlies; ply++ {
+		if len(legalMoves(pos)) == 0 {
+			if !pos.IsInCheck() {
+				return 0.5
+			} else if pos.Turn() == White {
+				return 0
+			}
+			return 1
+		}
+		if pos.IsFIDEDrawRule() || pos.IsDraw() {
+			return 0.5
+		}
+
+		runner := whiteRunner
+		if pos.Turn() == Black {
+			runner = blackRunner
+		}
+		runner.AddTimeManager(NewTimeManager(time.Now(), moveTime, true, 0, 0, false))
+		e := runner.Engines[0]
+		e.Position = pos.Copy()
+		e.Ply = game.MoveClock()
+		runner.Search(MAX_DEPTH)
+
+		move := runner.Move()
+		if !game.IsLegalMove(move) {
+			// The engine failed to come up with a move, count it as a loss
+			if pos.Turn() == White {
+				return 0
+			}
+			return 1
+		}
+
+		score := runner.Score()
+		if score >= adjudicationScore || score <= -adjudicationScore {
+			if (score > 0) == (pos.Turn() == White) {
+				return 1
+			}
+			return 0
+		}
+		game.Move(move)
+	}
+	return 0.5
+}
@@ -0,0 +1,43 @@
+package tuning
+
+import (
+	"math"
+	"testing"
+
+	. "github.com/amanjpro/zahak/search"
+)
+
+func TestSearchParametersCoverTheDefaults(t *testing.T) {
+	params := searchParameters()
+	defaults := DefaultSearchParams().Values()
+	if len(params) != len(SearchParamNames) {
+		t.Fatalf("Expected %d parameters, got %d", len(SearchParamNames), len(params))
+	}
+	for i, param := range params {
+		value := float64(defaults[i])
+		if param.OriginalValue != defaults[i] {
+			t.Errorf("%s: expected %d, got %d", SearchParamNames[i], defaults[i], param.OriginalValue)
+		}
+		if value < param.MinValue || value > param.MaxValue {
+			t.Errorf("%s: %d is out of [%.0f, %.0f]", SearchParamNames[i], defaults[i], param.MinValue, param.MaxValue)
+		}
+		if param.C_END < 1 || param.C_END > param.MaxValue-param.MinValue {
+			t.Errorf("%s: unexpected perturbation %.2f", SearchParamNames[i], param.C_END)
+		}
+	}
+}
+
+func TestSearchParametersRoundTrip(t *testing.T) {
+	params := searchParameters()
+	values := make([]int16, len(params))
+	for i, param := range params {
+		theta := clamp(float64(param.OriginalValue), param)
+		values[i] = int16(math.Round(theta))
+	}
+	actual := DefaultSearchParams()
+	actual.Update(values)
+	expected := DefaultSearchParams()
+	if actual.String() != expected.String() {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected.String(), actual.String())
+	}
+}
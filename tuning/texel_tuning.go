@@ -60,74 +60,111 @@ func initFutileIndices() map[int]bool {
 
 func computeInitialGuesses() []int16 {
 	var guesses = make([]int16, 0, 800)
-	guesses = append(guesses, EarlyPawnPst[:]...)                     // 0-63
-	guesses = append(guesses, LatePawnPst[:]...)                      // 64-127
-	guesses = append(guesses, EarlyKnightPst[:]...)                   // 128-191
-	guesses = append(guesses, LateKnightPst[:]...)                    // 192-255
-	guesses = append(guesses, EarlyBishopPst[:]...)                   // 256-319
-	guesses = append(guesses, LateBishopPst[:]...)                    // 320-383
-	guesses = append(guesses, EarlyRookPst[:]...)                     // 384-447
-	guesses = append(guesses, LateRookPst[:]...)                      // 448-511
-	guesses = append(guesses, EarlyQueenPst[:]...)                    // 512-575
-	guesses = append(guesses, LateQueenPst[:]...)                     // 576-639
-	guesses = append(guesses, EarlyKingPst[:]...)                     // 640-703
-	guesses = append(guesses, LateKingPst[:]...)                      // 704-767
-	guesses = append(guesses, MiddlegameBackwardPawnPenalty)          // 768
-	guesses = append(guesses, EndgameBackwardPawnPenalty)             // 769
-	guesses = append(guesses, MiddlegameIsolatedPawnPenalty)          // 770
-	guesses = append(guesses, EndgameIsolatedPawnPenalty)             // 771
-	guesses = append(guesses, MiddlegameDoublePawnPenalty)            // 772
-	guesses = append(guesses, EndgameDoublePawnPenalty)               // 773
-	guesses = append(guesses, MiddlegamePassedPawnAward)              // 774
-	guesses = append(guesses, EndgamePassedPawnAward)                 // 775
-	guesses = append(guesses, MiddlegameAdvancedPassedPawnAward)      // 776
-	guesses = append(guesses, EndgameAdvancedPassedPawnAward)         // 777
-	guesses = append(guesses, MiddlegameCandidatePassedPawnAward)     // 778
-	guesses = append(guesses, EndgameCandidatePassedPawnAward)        // 779
-	guesses = append(guesses, MiddlegameRookOpenFileAward)            // 780
-	guesses = append(guesses, EndgameRookOpenFileAward)               // 781
-	guesses = append(guesses, MiddlegameRookSemiOpenFileAward)        // 782
-	guesses = append(guesses, EndgameRookSemiOpenFileAward)           // 783
-	guesses = append(guesses, MiddlegameVeritcalDoubleRookAward)      // 784
-	guesses = append(guesses, EndgameVeritcalDoubleRookAward)         // 785
-	guesses = append(guesses, MiddlegameHorizontalDoubleRookAward)    // 786
-	guesses = append(guesses, EndgameHorizontalDoubleRookAward)       // 787
-	guesses = append(guesses, MiddlegamePawnFactorCoeff)              // 788
-	guesses = append(guesses, EndgamePawnFactorCoeff)                 // 789
-	guesses = append(guesses, MiddlegamePawnSquareControlCoeff)       // 790
-	guesses = append(guesses, EndgamePawnSquareControlCoeff)          // 791
-	guesses = append(guesses, MiddlegameMinorMobilityFactorCoeff)     // 792
-	guesses = append(guesses, EndgameMinorMobilityFactorCoeff)        // 793
-	guesses = append(guesses, MiddlegameMinorAggressivityFactorCoeff) // 794
-	guesses = append(guesses, EndgameMinorAggressivityFactorCoeff)    // 795
-	guesses = append(guesses, MiddlegameMajorMobilityFactorCoeff)     // 796
-	guesses = append(guesses, EndgameMajorMobilityFactorCoeff)        // 797
-	guesses = append(guesses, MiddlegameMajorAggressivityFactorCoeff) // 798
-	guesses = append(guesses, EndgameMajorAggressivityFactorCoeff)    // 799
-	guesses = append(guesses, MiddlegameInnerPawnToKingAttackCoeff)   // 800
-	guesses = append(guesses, EndgameInnerPawnToKingAttackCoeff)      // 801
-	guesses = append(guesses, MiddlegameOuterPawnToKingAttackCoeff)   // 802
-	guesses = append(guesses, EndgameOuterPawnToKingAttackCoeff)      // 803
-	guesses = append(guesses, MiddlegameInnerMinorToKingAttackCoeff)  // 804
-	guesses = append(guesses, EndgameInnerMinorToKingAttackCoeff)     // 805
-	guesses = append(guesses, MiddlegameOuterMinorToKingAttackCoeff)  // 806
-	guesses = append(guesses, EndgameOuterMinorToKingAttackCoeff)     // 807
-	guesses = append(guesses, MiddlegameInnerMajorToKingAttackCoeff)  // 808
-	guesses = append(guesses, EndgameInnerMajorToKingAttackCoeff)     // 809
-	guesses = append(guesses, MiddlegameOuterMajorToKingAttackCoeff)  // 810
-	guesses = append(guesses, EndgameOuterMajorToKingAttackCoeff)     // 811
-	guesses = append(guesses, MiddlegamePawnShieldPenalty)            // 812
-	guesses = append(guesses, EndgamePawnShieldPenalty)               // 813
-	guesses = append(guesses, MiddlegameNotCastlingPenalty)           // 814
-	guesses = append(guesses, EndgameNotCastlingPenalty)              // 815
-	guesses = append(guesses, MiddlegameKingZoneOpenFilePenalty)      // 816
-	guesses = append(guesses, EndgameKingZoneOpenFilePenalty)         // 817
-	guesses = append(guesses, MiddlegameKingZoneMissingPawnPenalty)   // 818
-	guesses = append(guesses, EndgameKingZoneMissingPawnPenalty)      // 819
-	guesses = append(guesses, MiddlegameKnightOutpostAward)           // 820
-	guesses = append(guesses, EndgameKnightOutpostAward)              // 821
-	guesses = append(guesses, MiddlegameBishopPairAward)              // 822
-	guesses = append(guesses, EndgameBishopPairAward)                 // 823
+	guesses = append(guesses, EarlyPawnPst[:]...)                      // 0-63
+	guesses = append(guesses, LatePawnPst[:]...)                       // 64-127
+	guesses = append(guesses, EarlyKnightPst[:]...)                    // 128-191
+	guesses = append(guesses, LateKnightPst[:]...)                     // 192-255
+	guesses = append(guesses, EarlyBishopPst[:]...)                    // 256-319
+	guesses = append(guesses, LateBishopPst[:]...)                     // 320-383
+	guesses = append(guesses, EarlyRookPst[:]...)                      // 384-447
+	guesses = append(guesses, LateRookPst[:]...)                       // 448-511
+	guesses = append(guesses, EarlyQueenPst[:]...)                     // 512-575
+	guesses = append(guesses, LateQueenPst[:]...)                      // 576-639
+	guesses = append(guesses, EarlyKingPst[:]...)                      // 640-703
+	guesses = append(guesses, LateKingPst[:]...)                       // 704-767
+	guesses = append(guesses, MiddlegameBackwardPawnPenalty)           // 768
+	guesses = append(guesses, EndgameBackwardPawnPenalty)              // 769
+	guesses = append(guesses, MiddlegameIsolatedPawnPenalty)           // 770
+	guesses = append(guesses, EndgameIsolatedPawnPenalty)              // 771
+	guesses = append(guesses, MiddlegameDoublePawnPenalty)             // 772
+	guesses = append(guesses, EndgameDoublePawnPenalty)                // 773
+	guesses = append(guesses, MiddlegamePassedPawnAward)               // 774
+	guesses = append(guesses, EndgamePassedPawnAward)                  // 775
+	guesses = append(guesses, MiddlegameAdvancedPassedPawnAward)       // 776
+	guesses = append(guesses, EndgameAdvancedPassedPawnAward)          // 777
+	guesses = append(guesses, MiddlegameCandidatePassedPawnAward)      // 778
+	guesses = append(guesses, EndgameCandidatePassedPawnAward)         // 779
+	guesses = append(guesses, MiddlegameRookOpenFileAward)             // 780
+	guesses = append(guesses, EndgameRookOpenFileAward)                // 781
+	guesses = append(guesses, MiddlegameRookSemiOpenFileAward)         // 782
+	guesses = append(guesses, EndgameRookSemiOpenFileAward)            // 783
+	guesses = append(guesses, MiddlegameVeritcalDoubleRookAward)       // 784
+	guesses = append(guesses, EndgameVeritcalDoubleRookAward)          // 785
+	guesses = append(guesses, MiddlegameHorizontalDoubleRookAward)     // 786
+	guesses = append(guesses, EndgameHorizontalDoubleRookAward)        // 787
+	guesses = append(guesses, MiddlegamePawnFactorCoeff)               // 788
+	guesses = append(guesses, EndgamePawnFactorCoeff)                  // 789
+	guesses = append(guesses, MiddlegamePawnSquareControlCoeff)        // 790
+	guesses = append(guesses, EndgamePawnSquareControlCoeff)           // 791
+	guesses = append(guesses, MiddlegameMinorMobilityFactorCoeff)      // 792
+	guesses = append(guesses, EndgameMinorMobilityFactorCoeff)         // 793
+	guesses = append(guesses, MiddlegameMinorAggressivityFactorCoeff)  // 794
+	guesses = append(guesses, EndgameMinorAggressivityFactorCoeff)     // 795
+	guesses = append(guesses, MiddlegameMajorMobilityFactorCoeff)      // 796
+	guesses = append(guesses, EndgameMajorMobilityFactorCoeff)         // 797
+	guesses = append(guesses, MiddlegameMajorAggressivityFactorCoeff)  // 798
+	guesses = append(guesses, EndgameMajorAggressivityFactorCoeff)     // 799
+	guesses = append(guesses, MiddlegameInnerPawnToKingAttackCoeff)    // 800
+	guesses = append(guesses, EndgameInnerPawnToKingAttackCoeff)       // 801
+	guesses = append(guesses, MiddlegameOuterPawnToKingAttackCoeff)    // 802
+	guesses = append(guesses, EndgameOuterPawnToKingAttackCoeff)       // 803
+	guesses = append(guesses, MiddlegameInnerMinorToKingAttackCoeff)   // 804
+	guesses = append(guesses, EndgameInnerMinorToKingAttackCoeff)      // 805
+	guesses = append(guesses, MiddlegameOuterMinorToKingAttackCoeff)   // 806
+	guesses = append(guesses, EndgameOuterMinorToKingAttackCoeff)      // 807
+	guesses = append(guesses, MiddlegameInnerMajorToKingAttackCoeff)   // 808
+	guesses = append(guesses, EndgameInnerMajorToKingAttackCoeff)      // 809
+	guesses = append(guesses, MiddlegameOuterMajorToKingAttackCoeff)   // 810
+	guesses = append(guesses, EndgameOuterMajorToKingAttackCoeff)      // 811
+	guesses = append(guesses, MiddlegamePawnShieldPenalty)             // 812
+	guesses = append(guesses, EndgamePawnShieldPenalty)                // 813
+	guesses = append(guesses, MiddlegameNotCastlingPenalty)            // 814
+	guesses = append(guesses, EndgameNotCastlingPenalty)               // 815
+	guesses = append(guesses, MiddlegameKingZoneOpenFilePenalty)       // 816
+	guesses = append(guesses, EndgameKingZoneOpenFilePenalty)          // 817
+	guesses = append(guesses, MiddlegameKingZoneMissingPawnPenalty)    // 818
+	guesses = append(guesses, EndgameKingZoneMissingPawnPenalty)       // 819
+	guesses = append(guesses, MiddlegameKnightOutpostAward)            // 820
+	guesses = append(guesses, EndgameKnightOutpostAward)               // 821
+	guesses = append(guesses, MiddlegameBishopPairAward)               // 822
+	guesses = append(guesses, EndgameBishopPairAward)                  // 823
+	guesses = append(guesses, KnightKingAttackWeight)                  // 824
+	guesses = append(guesses, BishopKingAttackWeight)                  // 825
+	guesses = append(guesses, RookKingAttackWeight)                    // 826
+	guesses = append(guesses, QueenKingAttackWeight)                   // 827
+	guesses = append(guesses, InnerRingAttackWeight)                   // 828
+	guesses = append(guesses, OuterRingAttackWeight)                   // 829
+	guesses = append(guesses, KnightSafeCheckWeight)                   // 830
+	guesses = append(guesses, BishopSafeCheckWeight)                   // 831
+	guesses = append(guesses, RookSafeCheckWeight)                     // 832
+	guesses = append(guesses, QueenSafeCheckWeight)                    // 833
+	guesses = append(guesses, KingOpenFileWeight)                      // 834
+	guesses = append(guesses, KingSemiOpenFileWeight)                  // 835
+	guesses = append(guesses, MiddlegameKingAttackScale)               // 836
+	guesses = append(guesses, EndgameKingAttackScale)                  // 837
+	guesses = append(guesses, MiddlegamePawnThreatAward)               // 838
+	guesses = append(guesses, EndgamePawnThreatAward)                  // 839
+	guesses = append(guesses, MiddlegameMinorThreatAward)              // 840
+	guesses = append(guesses, EndgameMinorThreatAward)                 // 841
+	guesses = append(guesses, MiddlegameHangingPieceAward)             // 842
+	guesses = append(guesses, EndgameHangingPieceAward)                // 843
+	guesses = append(guesses, MiddlegamePawnPushThreatAward)           // 844
+	guesses = append(guesses, EndgamePawnPushThreatAward)              // 845
+	guesses = append(guesses, EndgameOwnKingPassedPawnDistancePenalty) // 846
+	guesses = append(guesses, EndgameEnemyKingPassedPawnDistanceAward) // 847
+	guesses = append(guesses, MiddlegameFreePassedPawnAward)           // 848
+	guesses = append(guesses, EndgameFreePassedPawnAward)              // 849
+	guesses = append(guesses, MiddlegameSafePassedPawnAward)           // 850
+	guesses = append(guesses, EndgameSafePassedPawnAward)              // 851
+	guesses = append(guesses, MiddlegameBlockadedPassedPawnPenalty)    // 852
+	guesses = append(guesses, EndgameBlockadedPassedPawnPenalty)       // 853
+	guesses = append(guesses, EndgameUnstoppablePassedPawnAward)       // 854
+	guesses = append(guesses, MiddlegameRookRedundancyPenalty)         // 855
+	guesses = append(guesses, EndgameRookRedundancyPenalty)            // 856
+	guesses = append(guesses, MiddlegameQueenRookRedundancyPenalty)    // 857
+	guesses = append(guesses, EndgameQueenRookRedundancyPenalty)       // 858
+	guesses = append(guesses, MiddlegameUncontestedBishopPairAward)    // 859
+	guesses = append(guesses, EndgameUncontestedBishopPairAward)       // 860
 
 	return guesses
 }
@@ -203,6 +240,43 @@ func updateEvalParams(guesses []int16) {
 	EndgameKnightOutpostAward = guesses[821]
 	MiddlegameBishopPairAward = guesses[822]
 	EndgameBishopPairAward = guesses[823]
+	KnightKingAttackWeight = guesses[824]
+	BishopKingAttackWeight = guesses[825]
+	RookKingAttackWeight = guesses[826]
+	QueenKingAttackWeight = guesses[827]
+	InnerRingAttackWeight = guesses[828]
+	OuterRingAttackWeight = guesses[829]
+	KnightSafeCheckWeight = guesses[830]
+	BishopSafeCheckWeight = guesses[831]
+	RookSafeCheckWeight = guesses[832]
+	QueenSafeCheckWeight = guesses[833]
+	KingOpenFileWeight = guesses[834]
+	KingSemiOpenFileWeight = guesses[835]
+	MiddlegameKingAttackScale = guesses[836]
+	EndgameKingAttackScale = guesses[837]
+	MiddlegamePawnThreatAward = guesses[838]
+	EndgamePawnThreatAward = guesses[839]
+	MiddlegameMinorThreatAward = guesses[840]
+	EndgameMinorThreatAward = guesses[841]
+	MiddlegameHangingPieceAward = guesses[842]
+	EndgameHangingPieceAward = guesses[843]
+	MiddlegamePawnPushThreatAward = guesses[844]
+	EndgamePawnPushThreatAward = guesses[845]
+	EndgameOwnKingPassedPawnDistancePenalty = guesses[846]
+	EndgameEnemyKingPassedPawnDistanceAward = guesses[847]
+	MiddlegameFreePassedPawnAward = guesses[848]
+	EndgameFreePassedPawnAward = guesses[849]
+	MiddlegameSafePassedPawnAward = guesses[850]
+	EndgameSafePassedPawnAward = guesses[851]
+	MiddlegameBlockadedPassedPawnPenalty = guesses[852]
+	EndgameBlockadedPassedPawnPenalty = guesses[853]
+	EndgameUnstoppablePassedPawnAward = guesses[854]
+	MiddlegameRookRedundancyPenalty = guesses[855]
+	EndgameRookRedundancyPenalty = guesses[856]
+	MiddlegameQueenRookRedundancyPenalty = guesses[857]
+	EndgameQueenRookRedundancyPenalty = guesses[858]
+	MiddlegameUncontestedBishopPairAward = guesses[859]
+	EndgameUncontestedBishopPairAward = guesses[860]
 }
 
 func toEvalParams(guesses []float64) []int16 {
@@ -296,6 +370,43 @@ func printOptimalGuesses(guesses []int16) {
 	fmt.Printf("var EndgameKnightOutpostAward int16 = %d\n", guesses[821])
 	fmt.Printf("var MiddlegameBishopPairAward int16 = %d\n", guesses[822])
 	fmt.Printf("var EndgameBishopPairAward int16 = %d\n", guesses[823])
+	fmt.Printf("var KnightKingAttackWeight int16 = %d\n", guesses[824])
+	fmt.Printf("var BishopKingAttackWeight int16 = %d\n", guesses[825])
+	fmt.Printf("var RookKingAttackWeight int16 = %d\n", guesses[826])
+	fmt.Printf("var QueenKingAttackWeight int16 = %d\n", guesses[827])
+	fmt.Printf("var InnerRingAttackWeight int16 = %d\n", guesses[828])
+	fmt.Printf("var OuterRingAttackWeight int16 = %d\n", guesses[829])
+	fmt.Printf("var KnightSafeCheckWeight int16 = %d\n", guesses[830])
+	fmt.Printf("var BishopSafeCheckWeight int16 = %d\n", guesses[831])
+	fmt.Printf("var RookSafeCheckWeight int16 = %d\n", guesses[832])
+	fmt.Printf("var QueenSafeCheckWeight int16 = %d\n", guesses[833])
+	fmt.Printf("var KingOpenFileWeight int16 = %d\n", guesses[834])
+	fmt.Printf("var KingSemiOpenFileWeight int16 = %d\n", guesses[835])
+	fmt.Printf("var MiddlegameKingAttackScale int16 = %d\n", guesses[836])
+	fmt.Printf("var EndgameKingAttackScale int16 = %d\n", guesses[837])
+	fmt.Printf("var MiddlegamePawnThreatAward int16 = %d\n", guesses[838])
+	fmt.Printf("var EndgamePawnThreatAward int16 = %d\n", guesses[839])
+	fmt.Printf("var MiddlegameMinorThreatAward int16 = %d\n", guesses[840])
+	fmt.Printf("var EndgameMinorThreatAward int16 = %d\n", guesses[841])
+	fmt.Printf("var MiddlegameHangingPieceAward int16 = %d\n", guesses[842])
+	fmt.Printf("var EndgameHangingPieceAward int16 = %d\n", guesses[843])
+	fmt.Printf("var MiddlegamePawnPushThreatAward int16 = %d\n", guesses[844])
+	fmt.Printf("var EndgamePawnPushThreatAward int16 = %d\n", guesses[845])
+	fmt.Printf("var EndgameOwnKingPassedPawnDistancePenalty int16 = %d\n", guesses[846])
+	fmt.Printf("var EndgameEnemyKingPassedPawnDistanceAward int16 = %d\n", guesses[847])
+	fmt.Printf("var MiddlegameFreePassedPawnAward int16 = %d\n", guesses[848])
+	fmt.Printf("var EndgameFreePassedPawnAward int16 = %d\n", guesses[849])
+	fmt.Printf("var MiddlegameSafePassedPawnAward int16 = %d\n", guesses[850])
+	fmt.Printf("var EndgameSafePassedPawnAward int16 = %d\n", guesses[851])
+	fmt.Printf("var MiddlegameBlockadedPassedPawnPenalty int16 = %d\n", guesses[852])
+	fmt.Printf("var EndgameBlockadedPassedPawnPenalty int16 = %d\n", guesses[853])
+	fmt.Printf("var EndgameUnstoppablePassedPawnAward int16 = %d\n", guesses[854])
+	fmt.Printf("var MiddlegameRookRedundancyPenalty int16 = %d\n", guesses[855])
+	fmt.Printf("var EndgameRookRedundancyPenalty int16 = %d\n", guesses[856])
+	fmt.Printf("var MiddlegameQueenRookRedundancyPenalty int16 = %d\n", guesses[857])
+	fmt.Printf("var EndgameQueenRookRedundancyPenalty int16 = %d\n", guesses[858])
+	fmt.Printf("var MiddlegameUncontestedBishopPairAward int16 = %d\n", guesses[859])
+	fmt.Printf("var EndgameUncontestedBishopPairAward int16 = %d\n", guesses[860])
 
 	// fmt.Printf("var MiddlegameCastlingAward int16 = %d\n", guesses[792])
 	fmt.Println("===================================================")
@@ -377,7 +488,7 @@ func findK() float64 {
 }
 
 func linearEvaluation(pos *Position) int16 {
-	eval := Evaluate(pos, pawnhash, NoColor, 0)
+	eval := Evaluate(pos, pawnhash, nil, NoColor, 0)
 	if pos.Turn() == Black {
 		return -eval
 	}
@@ -388,7 +499,7 @@ func processor(testPositions []TestPosition, start int, end int, K float64) {
 	var acc float64 = 0
 	for i := start; i < end; i++ {
 		eval := linearEvaluation(testPositions[i].pos)
-		acc += math.Pow(testPositions[i].outcome-sigmoid(eval, K), 2)
+		acc += math.Pow(testPositions[i].outcome-WinProbability(eval, K), 2)
 	}
 
 	answers <- acc
@@ -415,10 +526,6 @@ func meanSquareError(testPositions []TestPosition, guess []int16, K float64) flo
 	return acc / float64(len(testPositions))
 }
 
-func sigmoid(eval int16, K float64) float64 {
-	return (1.0 / (1.0 + math.Pow(10, -(K*float64(eval))/400.0)))
-}
-
 func loadPositions(path string, actionFn func(string)) {
 	file, err := os.Open(path)
 	if err != nil {
@@ -476,24 +583,6 @@ func parseLine(line string) (string, float64) {
 
 }
 
-func PrepareTuningData(path string) {
-	loadPositions(path, func(line string) {
-		fen, _ := parseLine(line)
-		game := FromFen(fen)
-		pos := game.Position()
-		ml.Size = 0
-		ml.Next = 0
-		if pos.IsInCheck() {
-			return
-		}
-
-		pos.GetCaptureMoves(ml)
-		if ml.Size > 0 {
-			return
-		}
-	})
-}
-
 func Tune(path string, toExclude map[int]bool) {
 	skipParams = toExclude
 	loadPositions(path, func(line string) {
@@ -0,0 +1,356 @@
+package tuning
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	. "github.com/amanjpro/zahak/engine"
+	. "github.com/amanjpro/zahak/evaluation"
+)
+
+const startFen = "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1"
+
+// Positions closer to the start of a game than this are mostly book moves
+const openingPlies = 8
+
+// Maximum number of plies we follow in quiescence search
+const maxQuiescenceHeight = 32
+
+// Positions whose quiet score is beyond this are effectively decided, and
+// they do not tell the tuner anything useful
+const decidedScore int16 = 2000
+
+type pgnGame struct {
+	fen     string
+	moves   []string
+	outcome string
+}
+
+type tuningCandidate struct {
+	fen     string
+	outcome string
+}
+
+// Reads PGN or EPD files, resolves each sampled position to a quiet leaf
+// by following the quiescence PV, and writes the unique quiet leaves
+// along with the outcome of their games to the output file
+func PrepareTuningData(path string, outputPath string, samplesPerGame int) {
+	out, err := os.Create(outputPath)
+	if err != nil {
+		panic(err)
+	}
+	defer out.Close()
+	writer := bufio.NewWriter(out)
+	defer writer.Flush()
+
+	seen := make(map[uint64]bool, 1_000_000)
+	games := 0
+	written := 0
+
+	process := func(candidates []tuningCandidate) {
+		games += 1
+		for _, i := range sample(len(candidates), samplesPerGame) {
+			c := candidates[i]
+			game := FromFen(c.fen)
+			pos := game.Position()
+			leaf, ok := quietLeaf(pos)
+			if !ok {
+				continue
+			}
+			hash := leaf.Hash()
+			if seen[hash] {
+				continue
+			}
+			seen[hash] = true
+			written += 1
+			fields := strings.Fields(leaf.Fen())
+			fmt.Fprintf(writer, "%s c9 \"%s\";\n", strings.Join(fields[:4], " "), c.outcome)
+		}
+	}
+
+	if strings.HasSuffix(strings.ToLower(path), ".pgn") {
+		forEachPGNGame(path, func(game pgnGame) {
+			process(gameCandidates(game))
+		})
+	} else {
+		loadPositions(path, func(line string) {
+			fen, outcome := parseLine(line)
+			process([]tuningCandidate{{fen, outcomeToString(outcome)}})
+		})
+	}
+
+	fmt.Printf("%d games processed, %d quiet positions written to %s\n", games, written, outputPath)
+}
+
+func outcomeToString(outcome float64) string {
+	if outcome == 1.0 {
+		return "1-0"
+	} else if outcome == 0.0 {
+		return "0-1"
+	}
+	return "1/2-1/2"
+}
+
+// Picks up to n distinct indices out of [0, size)
+func sample(size int, n int) []int {
+	indices := rnd.Perm(size)
+	if n > 0 && n < size {
+		return indices[:n]
+	}
+	return indices
+}
+
+func gameCandidates(game pgnGame) []tuningCandidate {
+	g := FromFen(game.fen)
+	pos := g.Position()
+	candidates := make([]tuningCandidate, 0, len(game.moves))
+	for ply, san := range game.moves {
+		move := pos.PGNToMove(san)
+		if move == EmptyMove {
+			break // corrupt game, keep what we have so far
+		}
+		g.Move(move)
+		if ply+1 < openingPlies {
+			continue
+		}
+		candidates = append(candidates, tuningCandidate{g.Fen(), game.outcome})
+	}
+	return candidates
+}
+
+// Follows the quiescence principal variation to reach a quiet position
+// returns false, if the position is not suitable for tuning
+func quietLeaf(pos *Position) (*Position, bool) {
+	if pos.IsInCheck() || isNearMate(pos) {
+		return nil, false
+	}
+	pv := make([]Move, 0, maxQuiescenceHeight)
+	score := quiescence(pos, -CHECKMATE_EVAL, CHECKMATE_EVAL, 0, &pv)
+	if abs16(score) >= decidedScore {
+		return nil, false
+	}
+	for _, move := range pv {
+		if _, _, _, ok := pos.MakeMove(move); !ok {
+			return nil, false
+		}
+	}
+	if pos.IsInCheck() || isNearMate(pos) {
+		return nil, false
+	}
+	return pos, true
+}
+
+// Either side can mate in one, or the side to move is already mated or
+// stalemated. The side to move must not be in check
+func isNearMate(pos *Position) bool {
+	mates, legalMoves := matesInOne(pos)
+	if mates || legalMoves == 0 {
+		return true
+	}
+	ep := pos.MakeNullMove()
+	mates, _ = matesInOne(pos)
+	pos.UnMakeNullMove(ep)
+	return mates
+}
+
+// Reports whether the side to move has a mate in one, along with the
+// number of its legal moves
+func matesInOne(pos *Position) (bool, int) {
+	legalMoves := 0
+	for _, move := range pos.PseudoLegalMoves() {
+		if ep, tg, hc, ok := pos.MakeMove(move); ok {
+			legalMoves += 1
+			mates := pos.IsInCheck() && !hasLegalMove(pos)
+			pos.UnMakeMove(move, tg, ep, hc)
+			if mates {
+				return true, legalMoves
+			}
+		}
+	}
+	return false, legalMoves
+}
+
+func hasLegalMove(pos *Position) bool {
+	for _, move := range pos.PseudoLegalMoves() {
+		if ep, tg, hc, ok := pos.MakeMove(move); ok {
+			pos.UnMakeMove(move, tg, ep, hc)
+			return true
+		}
+	}
+	return false
+}
+
+// A stripped down version of the quiescence search of the engine, that
+// keeps track of the principal variation. The engine's quiescence does not
+// keep a PV, it probes the transposition table, prunes by delta and
+// searches quiet checks, so its leaves would depend on the table state and
+// could end in a check. Here only the non-losing captures are searched, so
+// the same position always resolves to the same quiet leaf
+func quiescence(pos *Position, alpha int16, beta int16, height int, pv *[]Move) int16 {
+	*pv = (*pv)[:0]
+	standPat := Evaluate(pos, pawnhash, nil, NoColor, 0)
+	if standPat >= beta || height >= maxQuiescenceHeight {
+		return standPat
+	}
+	if alpha < standPat {
+		alpha = standPat
+	}
+
+	ml := NewMoveList(250)
+	pos.GetCaptureMoves(ml)
+	scoreCaptures(pos, ml)
+
+	childPv := make([]Move, 0, maxQuiescenceHeight)
+	for i := 0; i < ml.Size; i++ {
+		best := i
+		for j := i + 1; j < ml.Size; j++ {
+			if ml.Scores[j] > ml.Scores[best] {
+				best = j
+			}
+		}
+		ml.Swap(i, best)
+		if ml.Scores[i] < 0 {
+			break // SEE pruning, the rest are losing captures
+		}
+		move := ml.Moves[i]
+		if ep, tg, hc, ok := pos.MakeMove(move); ok {
+			score := -quiescence(pos, -beta, -alpha, height+1, &childPv)
+			pos.UnMakeMove(move, tg, ep, hc)
+			if score > alpha {
+				alpha = score
+				*pv = append(append((*pv)[:0], move), childPv...)
+				if score >= beta {
+					break
+				}
+			}
+		}
+	}
+	return alpha
+}
+
+func scoreCaptures(pos *Position, ml *MoveList) {
+	board := pos.Board
+	for i := 0; i < ml.Size; i++ {
+		move := ml.Moves[i]
+		if !move.IsCapture() {
+			ml.Scores[i] = int32(GetPiece(move.PromoType(), White).Weight())
+		} else if move.IsEnPassant() {
+			ml.Scores[i] = 0
+		} else {
+			ml.Scores[i] = int32(board.StaticExchangeEval(move.Destination(), move.CapturedPiece(), move.Source(), move.MovingPiece()))
+		}
+	}
+}
+
+func forEachPGNGame(path string, actionFn func(pgnGame)) {
+	file, err := os.Open(path)
+	if err != nil {
+		panic(err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 1024*1024), 16*1024*1024)
+
+	game := pgnGame{startFen, nil, ""}
+	var movetext strings.Builder
+	inMovetext := false
+
+	flush := func() {
+		game.moves = movetextToMoves(movetext.String())
+		if game.outcome == "1-0" || game.outcome == "0-1" || game.outcome == "1/2-1/2" {
+			actionFn(game)
+		}
+		game = pgnGame{startFen, nil, ""}
+		movetext.Reset()
+		inMovetext = false
+	}
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "[") {
+			if inMovetext {
+				flush()
+			}
+			name, value := parseTag(line)
+			switch name {
+			case "Result":
+				game.outcome = value
+			case "FEN":
+				if len(strings.Fields(value)) == 4 {
+					value = fmt.Sprintf("%s 0 1", value)
+				}
+				game.fen = value
+			}
+		} else if line != "" {
+			inMovetext = true
+			movetext.WriteString(line)
+			movetext.WriteString("\n")
+		}
+	}
+
+	if inMovetext {
+		flush()
+	}
+
+	if err := scanner.Err(); err != nil {
+		panic(err)
+	}
+}
+
+func parseTag(line string) (string, string) {
+	line = strings.Trim(line, "[]")
+	fields := strings.SplitN(line, " ", 2)
+	if len(fields) != 2 {
+		return "", ""
+	}
+	return fields[0], strings.Trim(fields[1], "\"")
+}
+
+// Strips comments, variations, NAGs, move numbers and results off the movetext
+func movetextToMoves(movetext string) []string {
+	var clean strings.Builder
+	variations := 0
+	inComment := false
+	inLineComment := false
+	for _, ch := range movetext {
+		switch {
+		case inLineComment:
+			inLineComment = ch != '\n'
+		case inComment:
+			inComment = ch != '}'
+		case ch == '{':
+			inComment = true
+		case ch == ';':
+			inLineComment = true
+		case ch == '(':
+			variations += 1
+		case ch == ')':
+			variations -= 1
+		case variations == 0:
+			clean.WriteRune(ch)
+		}
+	}
+
+	moves := make([]string, 0, 200)
+	for _, token := range strings.Fields(clean.String()) {
+		if i := strings.LastIndexByte(token, '.'); i >= 0 {
+			token = token[i+1:]
+		}
+		if token == "" || strings.HasPrefix(token, "$") ||
+			token == "1-0" || token == "0-1" || token == "1/2-1/2" || token == "*" {
+			continue
+		}
+		moves = append(moves, token)
+	}
+	return moves
+}
+
+func abs16(x int16) int16 {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
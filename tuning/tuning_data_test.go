@@ -0,0 +1,161 @@
+package tuning
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	. "github.com/amanjpro/zahak/engine"
+)
+
+func TestMovetextToMoves(t *testing.T) {
+	tests := []struct {
+		name     string
+		movetext string
+		expected []string
+	}{
+		{"plain", "1. e4 e5 2. Nf3 Nc6 1-0", []string{"e4", "e5", "Nf3", "Nc6"}},
+		{"no spaces after move numbers", "1.e4 e5 2.Nf3 0-1", []string{"e4", "e5", "Nf3"}},
+		{"black move numbers", "12... Nf6 13. O-O 13...O-O-O *", []string{"Nf6", "O-O", "O-O-O"}},
+		{"comments", "1. e4 {best by test} e5 {with 2. d4 (2. c4) in mind} 2. Nf3 1/2-1/2", []string{"e4", "e5", "Nf3"}},
+		{"line comments", "1. e4 ; 1... c5 is the Sicilian\ne5 2. Nf3 *", []string{"e4", "e5", "Nf3"}},
+		{"NAGs", "1. e4 $1 e5 $2 2. Nf3 $14 1-0", []string{"e4", "e5", "Nf3"}},
+		{"variations", "1. e4 (1. d4 d5 (1... Nf6 2. c4)) 1... e5 (1... c5) 2. Nf3 0-1", []string{"e4", "e5", "Nf3"}},
+		{"results only", "1/2-1/2", []string{}},
+	}
+
+	for _, test := range tests {
+		actual := movetextToMoves(test.movetext)
+		if !reflect.DeepEqual(actual, test.expected) {
+			t.Errorf("%s: expected %v, got %v", test.name, test.expected, actual)
+		}
+	}
+}
+
+func TestQuietLeaf(t *testing.T) {
+	tests := []struct {
+		name     string
+		fen      string
+		expected string
+	}{
+		{"quiet position", "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq -"},
+		{"hanging queen", "4k3/8/8/3q4/8/8/3R4/4K3 w - - 0 1", "4k3/8/8/3R4/8/8/8/4K3 b - -"},
+		{"in check", "4k3/8/8/8/8/8/4r3/4K3 w - - 0 1", ""},
+		{"side to move mates in one", "6k1/5ppp/8/8/8/8/8/R5K1 w - - 0 1", ""},
+		{"opponent mates in one", "r5k1/5ppp/8/8/8/8/5PPP/6K1 w - - 0 1", ""},
+		{"stalemate", "7k/5Q2/6K1/8/8/8/8/8 b - - 0 1", ""},
+	}
+
+	for _, test := range tests {
+		game := FromFen(test.fen)
+		leaf, ok := quietLeaf(game.Position())
+		actual := ""
+		if ok {
+			actual = strings.Join(strings.Fields(leaf.Fen())[:4], " ")
+		}
+		if actual != test.expected {
+			t.Errorf("%s: expected %q, got %q", test.name, test.expected, actual)
+		}
+	}
+}
+
+func TestIsNearMate(t *testing.T) {
+	tests := []struct {
+		fen      string
+		expected bool
+	}{
+		{"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", false},
+		{"6k1/5ppp/8/8/8/8/8/R5K1 w - - 0 1", true},
+		{"r5k1/5ppp/8/8/8/8/5PPP/6K1 w - - 0 1", true},
+		{"7k/5Q2/6K1/8/8/8/8/8 b - - 0 1", true},
+	}
+
+	for _, test := range tests {
+		game := FromFen(test.fen)
+		pos := game.Position()
+		hash := pos.Hash()
+		if actual := isNearMate(pos); actual != test.expected {
+			t.Errorf("%s: expected %t, got %t", test.fen, test.expected, actual)
+		}
+		if pos.Hash() != hash {
+			t.Errorf("%s: the position was not restored", test.fen)
+		}
+	}
+}
+
+const testPGN = `[Event "Ruy Lopez"]
+[Result "1/2-1/2"]
+
+1. e4 e5 2. Nf3 Nc6 3. Bb5 a6 4. Ba4 Nf6 5. O-O Be7 {main line}
+6. Re1 b5 7. Bb3 d6 (7... O-O) 1/2-1/2
+
+[Event "From a position"]
+[FEN "4k3/8/8/3q4/8/8/3R4/4K3 w - -"]
+[Result "1-0"]
+
+1. Rxd5 Ke7 1-0
+
+[Event "Unfinished"]
+[Result "*"]
+
+1. d4 d5 *
+`
+
+func TestForEachPGNGame(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "games.pgn")
+	if err := os.WriteFile(path, []byte(testPGN), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	games := make([]pgnGame, 0, 2)
+	forEachPGNGame(path, func(game pgnGame) {
+		games = append(games, game)
+	})
+
+	expected := []pgnGame{
+		{startFen, []string{"e4", "e5", "Nf3", "Nc6", "Bb5", "a6", "Ba4", "Nf6", "O-O", "Be7", "Re1", "b5", "Bb3", "d6"}, "1/2-1/2"},
+		{"4k3/8/8/3q4/8/8/3R4/4K3 w - - 0 1", []string{"Rxd5", "Ke7"}, "1-0"},
+	}
+	if !reflect.DeepEqual(games, expected) {
+		t.Errorf("Expected %v, got %v", expected, games)
+	}
+}
+
+func TestPrepareTuningData(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "games.pgn")
+	// The same game twice, its positions must be written only once
+	if err := os.WriteFile(path, []byte(testPGN+"\n"+testPGN), 0644); err != nil {
+		t.Fatal(err)
+	}
+	outputPath := filepath.Join(dir, "quiet.epd")
+
+	PrepareTuningData(path, outputPath, 0)
+
+	data, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	// The first game has 7 plies past the opening, the second is too short
+	if len(lines) == 0 || len(lines) > 7 {
+		t.Fatalf("Expected between 1 and 7 positions, got %d:\n%s", len(lines), data)
+	}
+	seen := make(map[string]bool, len(lines))
+	for _, line := range lines {
+		fen, outcome := parseLine(line)
+		if outcome != 0.5 {
+			t.Errorf("Expected a draw, got %f for %s", outcome, line)
+		}
+		if seen[fen] {
+			t.Errorf("Duplicate position %s", fen)
+		}
+		seen[fen] = true
+		game := FromFen(fen)
+		if game.Position().IsInCheck() {
+			t.Errorf("Position in check %s", fen)
+		}
+	}
+}
@@ -7,12 +7,15 @@ import (
 	"runtime"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	. "github.com/amanjpro/zahak/book"
+	. "github.com/amanjpro/zahak/cluster"
 	. "github.com/amanjpro/zahak/engine"
 	. "github.com/amanjpro/zahak/evaluation"
 	. "github.com/amanjpro/zahak/search"
+	. "github.com/amanjpro/zahak/tablebase"
 )
 
 const startFen = "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1"
@@ -27,6 +30,13 @@ type UCI struct {
 	timeManager *TimeManager
 	withBook    bool
 	bookPath    string
+	hashFile    string
+	saveOnQuit  bool
+	loadedHash  bool
+	sharedHash  string
+	cluster     *Coordinator
+	trace       *SearchTrace
+	searching   sync.WaitGroup // Done once the search that runs in the background ends
 }
 
 func NewUCI(version string, withBook bool, bookPath string) *UCI {
@@ -36,7 +46,73 @@ func NewUCI(version string, withBook bool, bookPath string) *UCI {
 		nil,
 		withBook,
 		bookPath,
+		DEFAULT_HASH_FILE,
+		false,
+		false,
+		"",
+		nil,
+		NewSearchTrace(DEFAULT_TRACE_NODES, DEFAULT_TRACE_HEIGHT),
+		sync.WaitGroup{},
+	}
+}
+
+const DEFAULT_HASH_FILE = "zahak.hash"
+
+// Loads the transposition table from the file, it replaces the current one,
+// including a shared one. A loaded table is kept on new games, like a shared one
+func (uci *UCI) LoadHashFromFile(path string) error {
+	tt, err := LoadCacheFromFile(path)
+	if err != nil {
+		return err
 	}
+	uci.hashFile = path
+	uci.sharedHash = ""
+	uci.replaceTT(func() *Cache { return tt })
+	uci.loadedHash = true
+	return nil
+}
+
+// Attaches to the shared transposition table in the file, that is created with
+// the current size if it does not exist. An empty path goes back to a private table
+func (uci *UCI) UseSharedHash(path string) error {
+	tt := uci.runner.Engines[0].TranspositionTable
+	uci.sharedHash = path
+	uci.resizeTT(tt.Size(), tt.PowerOfTwo())
+	if uci.sharedHash != path {
+		return fmt.Errorf("could not attach to %s", path)
+	}
+	return nil
+}
+
+// Searches on the cluster workers at the addresses too, no addresses stops
+// using the cluster
+func (uci *UCI) UseClusterWorkers(addresses []string) error {
+	if uci.cluster != nil {
+		uci.cluster.Close()
+		uci.cluster = nil
+		uci.runner.Remote = nil
+	}
+	if len(addresses) == 0 {
+		return nil
+	}
+	coordinator, err := Connect(addresses)
+	if err != nil {
+		return err
+	}
+	uci.cluster = coordinator
+	uci.runner.Remote = coordinator
+	return nil
+}
+
+func (uci *UCI) SaveHashToFile(path string) error {
+	uci.hashFile = path
+	return uci.runner.Engines[0].TranspositionTable.SaveToFile(path)
+}
+
+// Saves the transposition table to the file when the engine quits
+func (uci *UCI) SaveHashOnQuit(path string) {
+	uci.hashFile = path
+	uci.saveOnQuit = true
 }
 
 func (uci *UCI) Start() {
@@ -60,22 +136,51 @@ func (uci *UCI) Start() {
 				uci.runner.Ponderhit()
 				uci.timeManager = nil
 			case "quit":
+				if uci.cluster != nil {
+					uci.cluster.Close()
+				}
+				if uci.saveOnQuit {
+					uci.stopPondering()
+					if err := uci.SaveHashToFile(uci.hashFile); err != nil {
+						fmt.Printf("info string %s\n", err)
+					}
+				}
 				return
 			case "eval":
 				dir := int16(1)
 				if game.Position().Turn() == Black {
 					dir = -1
 				}
-				fmt.Printf("%d\n", dir*Evaluate(game.Position(), uci.runner.Engines[0].Pawnhash, NoColor, 0))
+				fmt.Printf("%d\n", dir*Evaluate(game.Position(), uci.runner.Engines[0].Pawnhash, uci.runner.Engines[0].Materialhash, NoColor, 0))
+			case "trace":
+				fmt.Print(TraceEvaluate(game.Position()).String())
+			case "ttstats":
+				uci.stopPondering()
+				tt := uci.runner.Engines[0].TranspositionTable
+				fmt.Print(TTStatsReport(tt))
+				fmt.Print(TTCountersReport(uci.runner.TTCounters()))
+				fmt.Print(TTProbeReport(tt, game.Position()))
 			case "uci":
 				fmt.Printf("id name Zahak %s\n", uci.version)
 				fmt.Print("id author Amanj\n")
 				fmt.Print("option name Ponder type check default false\n")
 				fmt.Printf("option name Hash type spin default %d min 1 max %d\n", DEFAULT_CACHE_SIZE, MAX_CACHE_SIZE)
+				fmt.Print("option name HashPowerOfTwo type check default false\n")
+				fmt.Printf("option name HashFile type string default %s\n", uci.hashFile)
+				fmt.Print("option name SaveHashToFile type button\n")
+				fmt.Print("option name SharedHashFile type string default <empty>\n")
+				fmt.Print("option name LoadHashFromFile type button\n")
 				fmt.Printf("option name Pawnhash type spin default %d min 1 max %d\n", DEFAULT_PAWNHASH_SIZE, MAX_PAWNHASH_SIZE)
 				fmt.Printf("option name Book type check default %t\n", uci.withBook)
 				fmt.Printf("option name Threads type spin default %d min %d max %d\n", defaultCPU, minCPU, maxCPU)
+				fmt.Printf("option name SMPMode type combo default %s var %s var %s\n", LazySMP, LazySMP, ABDADA)
+				fmt.Printf("option name SearchMode type combo default %s var %s var %s\n", AlphaBeta, AlphaBeta, MCTS)
+				fmt.Print("option name SearchTrace type string default <empty>\n")
+				fmt.Printf("option name SearchTraceNodes type spin default %d min 1 max 10000000\n", DEFAULT_TRACE_NODES)
+				fmt.Printf("option name SearchTraceDepth type spin default %d min 0 max %d\n", DEFAULT_TRACE_HEIGHT, MAX_DEPTH)
+				fmt.Print("option name ClusterWorkers type string default <empty>\n")
 				fmt.Print("option name VsHuman type check default false\n")
+				fmt.Print("option name TablebasePath type string default <empty>\n")
 				fmt.Print("uciok\n")
 			case "isready":
 				fmt.Print("readyok\n")
@@ -84,16 +189,7 @@ func (uci *UCI) Start() {
 			case "draw":
 				fmt.Print(game.Position().Board.Draw(), "\n")
 			case "ucinewgame", "position startpos":
-				size := uci.runner.Engines[0].TranspositionTable.Size()
-				pawnSize := uci.runner.Engines[0].Pawnhash.Size()
-				newTT := NewCache(size)
-				for i := 0; i < len(uci.runner.Engines); i++ {
-					uci.runner.Engines[i].Pawnhash = nil
-					uci.runner.Engines[i].TranspositionTable = nil
-					runtime.GC()
-					uci.runner.Engines[i].TranspositionTable = newTT
-					uci.runner.Engines[i].Pawnhash = NewPawnCache(pawnSize)
-				}
+				uci.newGame()
 				game = FromFen(startFen)
 			case "stop":
 				if uci.runner.TimeManager != nil {
@@ -118,7 +214,59 @@ func (uci *UCI) Start() {
 					options := strings.Fields(cmd)
 					v := options[len(options)-1]
 					cpu, _ := strconv.Atoi(v)
+					smpMode := uci.runner.SMPMode
+					searchMode := uci.runner.SearchMode
+					remote := uci.runner.Remote
+					trace := uci.runner.Trace
 					uci.runner = NewRunner(uci.runner.Engines[0].TranspositionTable, uci.runner.Engines[0].Pawnhash, cpu)
+					uci.runner.Trace = trace
+					uci.runner.SMPMode = smpMode
+					uci.runner.SearchMode = searchMode
+					uci.runner.Remote = remote
+				} else if strings.HasPrefix(cmd, "setoption name SMPMode value ") {
+					options := strings.Fields(cmd)
+					if mode, ok := ParseSMPMode(options[len(options)-1]); ok {
+						uci.runner.SMPMode = mode
+					} else {
+						fmt.Printf("info string unknown SMP mode %s\n", options[len(options)-1])
+					}
+				} else if strings.HasPrefix(cmd, "setoption name SearchMode value ") {
+					options := strings.Fields(cmd)
+					if mode, ok := ParseSearchMode(options[len(options)-1]); ok {
+						uci.runner.SearchMode = mode
+					} else {
+						fmt.Printf("info string unknown search mode %s\n", options[len(options)-1])
+					}
+				} else if strings.HasPrefix(cmd, "setoption name SearchTrace value") {
+					path := strings.TrimSpace(strings.TrimPrefix(cmd, "setoption name SearchTrace value"))
+					if path == "" || path == "<empty>" {
+						uci.trace.Path = ""
+						uci.runner.Trace = nil
+					} else {
+						uci.trace.Path = path
+						uci.runner.Trace = uci.trace
+					}
+				} else if strings.HasPrefix(cmd, "setoption name SearchTraceNodes value") {
+					options := strings.Fields(cmd)
+					nodes, _ := strconv.Atoi(options[len(options)-1])
+					uci.trace.MaxNodes = nodes
+				} else if strings.HasPrefix(cmd, "setoption name SearchTraceDepth value") {
+					options := strings.Fields(cmd)
+					height, _ := strconv.Atoi(options[len(options)-1])
+					uci.trace.MaxHeight = int8(height)
+				} else if strings.HasPrefix(cmd, "setoption name ClusterWorkers value") {
+					value := strings.TrimSpace(strings.TrimPrefix(cmd, "setoption name ClusterWorkers value"))
+					addresses := []string{}
+					if value != "<empty>" {
+						for _, address := range strings.Split(value, ",") {
+							if address = strings.TrimSpace(address); address != "" {
+								addresses = append(addresses, address)
+							}
+						}
+					}
+					if err := uci.UseClusterWorkers(addresses); err != nil {
+						fmt.Printf("info string %s\n", err)
+					}
 				} else if strings.HasPrefix(cmd, "setoption name Pawnhash value") {
 					options := strings.Fields(cmd)
 					mg := options[len(options)-1]
@@ -132,12 +280,48 @@ func (uci *UCI) Start() {
 					options := strings.Fields(cmd)
 					mg := options[len(options)-1]
 					hashSize, _ := strconv.Atoi(mg)
-					newTT := NewCache(uint32(hashSize))
-					for i := 0; i < len(uci.runner.Engines); i++ {
-						uci.runner.Engines[i].TranspositionTable = nil
-						runtime.GC()
-						uci.runner.Engines[i].TranspositionTable = newTT
+					powerOfTwo := uci.runner.Engines[0].TranspositionTable.PowerOfTwo()
+					uci.resizeTT(uint32(hashSize), powerOfTwo)
+				} else if strings.HasPrefix(cmd, "setoption name HashPowerOfTwo value ") {
+					options := strings.Fields(cmd)
+					opt := options[len(options)-1]
+					size := uci.runner.Engines[0].TranspositionTable.Size()
+					if opt == "false" {
+						uci.resizeTT(size, false)
+					} else if opt == "true" {
+						uci.resizeTT(size, true)
+					}
+				} else if strings.HasPrefix(cmd, "setoption name HashFile value") {
+					path := strings.TrimSpace(strings.TrimPrefix(cmd, "setoption name HashFile value"))
+					if path != "" {
+						uci.hashFile = path
+					}
+				} else if strings.HasPrefix(cmd, "setoption name SharedHashFile value") {
+					path := strings.TrimSpace(strings.TrimPrefix(cmd, "setoption name SharedHashFile value"))
+					if path == "<empty>" {
+						path = ""
+					}
+					uci.UseSharedHash(path)
+				} else if cmd == "setoption name SaveHashToFile" {
+					if err := uci.SaveHashToFile(uci.hashFile); err != nil {
+						fmt.Printf("info string %s\n", err)
+					} else {
+						fmt.Printf("info string saved the hash to %s\n", uci.hashFile)
+					}
+				} else if cmd == "setoption name LoadHashFromFile" {
+					if err := uci.LoadHashFromFile(uci.hashFile); err != nil {
+						fmt.Printf("info string %s\n", err)
+					} else {
+						fmt.Printf("info string loaded the hash from %s\n", uci.hashFile)
 					}
+				} else if strings.HasPrefix(cmd, "ttstats fen ") {
+					uci.stopPondering()
+					fen := strings.TrimSpace(strings.TrimPrefix(cmd, "ttstats fen "))
+					if len(strings.Fields(fen)) == 4 {
+						fen = fmt.Sprintf("%s 0 1", fen)
+					}
+					probe := FromFen(fen)
+					fmt.Print(TTProbeReport(uci.runner.Engines[0].TranspositionTable, probe.Position()))
 				} else if strings.HasPrefix(cmd, "go") {
 					uci.findMove(game, depth, game.MoveClock(), cmd)
 				} else if strings.HasPrefix(cmd, "position startpos moves") {
@@ -166,6 +350,13 @@ func (uci *UCI) Start() {
 					for _, move := range game.Position().ParseMoves(moves) {
 						game.Move(move)
 					}
+				} else if strings.HasPrefix(cmd, "setoption name TablebasePath value") {
+					path := strings.TrimSpace(strings.TrimPrefix(cmd, "setoption name TablebasePath value"))
+					if path == "" || path == "<empty>" {
+						ResetTablebases()
+					} else if err := InitTablebases(path); err != nil {
+						fmt.Printf("info string %s\n", err)
+					}
 				} else if strings.HasPrefix(cmd, "setoption name VsHuman value ") {
 					options := strings.Fields(cmd)
 					opt := options[len(options)-1]
@@ -182,6 +373,69 @@ func (uci *UCI) Start() {
 	}
 }
 
+// Clears the hashes and the histories for a new game. A shared table is never
+// cleared, the other processes still use it, and neither is a table loaded
+// from a file, as GUIs send ucinewgame right after they restart the engine
+func (uci *UCI) newGame() {
+	uci.stopSearch()
+	uci.runner.ClearHistories()
+	tt := uci.runner.Engines[0].TranspositionTable
+	pawnSize := uci.runner.Engines[0].Pawnhash.Size()
+	if uci.sharedHash == "" && !uci.loadedHash {
+		uci.resizeTT(tt.Size(), tt.PowerOfTwo())
+	}
+	for i := 0; i < len(uci.runner.Engines); i++ {
+		uci.runner.Engines[i].Pawnhash = nil
+		runtime.GC()
+		uci.runner.Engines[i].Pawnhash = NewPawnCache(pawnSize)
+	}
+}
+
+func (uci *UCI) resizeTT(megabytes uint32, powerOfTwo bool) {
+	uci.loadedHash = false
+	uci.replaceTT(func() *Cache {
+		if uci.sharedHash == "" {
+			return NewCacheWithSizing(megabytes, powerOfTwo)
+		}
+		shared, err := NewSharedCache(uci.sharedHash, megabytes, powerOfTwo)
+		if err != nil {
+			fmt.Printf("info string %s, using a private hash instead\n", err)
+			uci.sharedHash = ""
+			return NewCacheWithSizing(megabytes, powerOfTwo)
+		}
+		if shared.Size() != megabytes || shared.PowerOfTwo() != powerOfTwo {
+			fmt.Printf("info string %s already holds a %dMB table, using it as is\n", uci.sharedHash, shared.Size())
+		}
+		return shared
+	})
+}
+
+// Releases the current transposition table before creating the new one, so
+// that both are never in memory at the same time. Nothing may use the old table
+// once it is closed, so the search is stopped first, and the cluster stops
+// importing the entries of the workers into it
+func (uci *UCI) replaceTT(newTT func() *Cache) {
+	uci.stopSearch()
+	if uci.cluster != nil {
+		uci.cluster.SetTable(nil)
+	}
+	old := uci.runner.Engines[0].TranspositionTable
+	for i := 0; i < len(uci.runner.Engines); i++ {
+		uci.runner.Engines[i].TranspositionTable = nil
+	}
+	if old != nil {
+		old.Close()
+	}
+	runtime.GC()
+	tt := newTT()
+	for i := 0; i < len(uci.runner.Engines); i++ {
+		uci.runner.Engines[i].TranspositionTable = tt
+	}
+	if uci.cluster != nil {
+		uci.cluster.SetTable(tt)
+	}
+}
+
 func (uci *UCI) findMove(game Game, depth int8, ply uint16, cmd string) {
 	uci.timeManager = nil
 	fields := strings.Fields(cmd)
@@ -247,13 +501,31 @@ func (uci *UCI) findMove(game Game, depth int8, ply uint16, cmd string) {
 			tm := NewTimeManager(time.Now(), int64(timeToThink), perMove, int64(inc), int64(movesToGo), pondering)
 			uci.runner.AddTimeManager(tm)
 		}
-		go uci.runner.Search(depth)
+		uci.startSearch(depth)
 	} else {
 		tm := NewTimeManager(time.Now(), MAX_TIME, false, 0, 0, pondering)
 		uci.runner.AddTimeManager(tm)
 		uci.timeManager = tm
-		go uci.runner.Search(depth)
+		uci.startSearch(depth)
+	}
+}
+
+// Runs the search in the background
+func (uci *UCI) startSearch(depth int8) {
+	uci.searching.Add(1)
+	go func() {
+		defer uci.searching.Done()
+		uci.runner.Search(depth)
+	}()
+}
+
+// Stops the search, if any, and waits until it ends
+func (uci *UCI) stopSearch() {
+	if tm := uci.runner.TimeManager; tm != nil {
+		tm.Pondering = false
+		tm.StopSearchNow = true
 	}
+	uci.searching.Wait()
 }
 
 func (uci *UCI) stopPondering() {
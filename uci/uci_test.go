@@ -0,0 +1,110 @@
+package uci
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/amanjpro/zahak/engine"
+)
+
+func TestLoadedHashSurvivesNewGame(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "zahak.hash")
+	hash := uint64(0x123456789ABCDEF)
+	move := NewMove(E2, E4, WhitePawn, NoPiece, NoType, 0)
+	cache := NewCache(1)
+	cache.Set(hash, move, 10, 20, 5, Exact, 1)
+	if err := cache.SaveToFile(path); err != nil {
+		t.Fatalf("Could not save the cache: %v\n", err)
+	}
+
+	uci := NewUCI("test", false, "")
+	if err := uci.LoadHashFromFile(path); err != nil {
+		t.Fatalf("Could not load the cache: %v\n", err)
+	}
+	uci.newGame()
+	mv, eval, _, depth, _, ok := uci.runner.Engines[0].TranspositionTable.Get(hash)
+	if !ok || mv != move.Compact() || eval != 10 || depth != 5 {
+		t.Errorf("Expected the loaded entry to survive a new game, got %t %d %d\n", ok, eval, depth)
+	}
+
+	// Resizing the table drops the loaded one, and later new games clear it again
+	uci.resizeTT(1, false)
+	uci.runner.Engines[0].TranspositionTable.Set(hash, move, 10, 20, 5, Exact, 1)
+	uci.newGame()
+	if _, _, _, _, _, ok := uci.runner.Engines[0].TranspositionTable.Get(hash); ok {
+		t.Errorf("Expected a new game to clear the table after it was resized\n")
+	}
+}
+
+// A cluster worker that answers every stop with a result, and sends the same
+// table entry over and over until it is closed
+func floodingWorker(listener net.Listener, data uint64, hash uint64) {
+	conn, err := listener.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	go func() {
+		decoder := json.NewDecoder(conn)
+		id := uint32(0)
+		for {
+			var m map[string]interface{}
+			if err := decoder.Decode(&m); err != nil {
+				return
+			}
+			switch m["type"] {
+			case "search":
+				id = uint32(m["id"].(float64))
+			case "stop":
+				fmt.Fprintf(conn, "{\"type\":\"result\",\"id\":%d}\n", id)
+			}
+		}
+	}()
+	for {
+		if _, err := fmt.Fprintf(conn, "{\"type\":\"entries\",\"entries\":[{\"h\":%d,\"d\":%d}]}\n", hash, data); err != nil {
+			return
+		}
+		time.Sleep(100 * time.Microsecond)
+	}
+}
+
+func TestReplacingTheTableWhileEntriesArrive(t *testing.T) {
+	address := filepath.Join(t.TempDir(), "worker.sock")
+	listener, err := net.Listen("unix", address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	hash := uint64(0x123456789ABCDEF)
+	move := NewMove(E2, E4, WhitePawn, NoPiece, NoType, 0)
+	go floodingWorker(listener, Pack(move.Compact(), 10, 20, 30, Exact, 0), hash)
+
+	uci := NewUCI("test", false, "")
+	if err := uci.UseClusterWorkers([]string{"unix:" + address}); err != nil {
+		t.Fatal(err)
+	}
+	defer uci.cluster.Close()
+	game := FromFen(startFen)
+	uci.runner.Engines[0].Position = game.Position()
+	uci.cluster.Start(uci.runner, 1)
+	uci.cluster.Stop()
+
+	for i := 0; i < 20; i++ {
+		uci.resizeTT(1, i%2 == 0)
+		tt := uci.runner.Engines[0].TranspositionTable
+		deadline := time.Now().Add(2 * time.Second)
+		for {
+			if _, _, _, depth, _, ok := tt.Get(hash); ok && depth == 30 {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("Expected the entries of the worker to reach the new table %d\n", i)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+}
@@ -8,11 +8,15 @@ import (
 	"runtime/pprof"
 	"strconv"
 	"strings"
+	"time"
 
+	. "github.com/amanjpro/zahak/cluster"
 	. "github.com/amanjpro/zahak/engine"
+	. "github.com/amanjpro/zahak/evaluation"
 	. "github.com/amanjpro/zahak/perft"
 	. "github.com/amanjpro/zahak/search"
 	. "github.com/amanjpro/zahak/strength"
+	. "github.com/amanjpro/zahak/tablebase"
 	. "github.com/amanjpro/zahak/tuning"
 	. "github.com/amanjpro/zahak/uci"
 )
@@ -23,15 +27,96 @@ func main() {
 	args := os.Args
 	if len(args) > 1 && args[1] == "bench" {
 		RunBenchmark()
+	} else if len(args) > 1 && args[1] == "smp-bench" {
+		maxThreads := intArg(args, 2, runtime.NumCPU())
+		depth := intArg(args, 3, 10)
+		RunSMPBenchmark(maxThreads, int8(depth))
+	} else if len(args) > 2 && args[1] == "cluster-worker" {
+		threads := intArg(args, 3, 1)
+		hashSize := intArg(args, 4, int(DEFAULT_CACHE_SIZE))
+		worker, err := Listen(args[2], threads, uint32(hashSize))
+		if err != nil {
+			fmt.Println("could not start the cluster worker: ", err)
+			os.Exit(1)
+		}
+		fmt.Printf("cluster worker listening on %s\n", args[2])
+		if err := worker.Serve(); err != nil {
+			fmt.Println("the cluster worker stopped: ", err)
+			os.Exit(1)
+		}
+	} else if len(args) > 4 && args[1] == "trace" {
+		depth := intArg(args, 2, 6)
+		fen := strings.Join(args[4:], " ")
+		if len(strings.Fields(fen)) == 4 {
+			fen = fmt.Sprintf("%s 0 1", fen)
+		}
+		game := FromFen(fen)
+		runner := NewRunner(NewCache(DEFAULT_CACHE_SIZE), NewPawnCache(DEFAULT_PAWNHASH_SIZE), 1)
+		runner.Trace = NewSearchTrace(DEFAULT_TRACE_NODES, int8(depth))
+		runner.Trace.Path = args[3]
+		runner.AddTimeManager(NewTimeManager(time.Now(), MAX_TIME, false, 0, 0, false))
+		runner.Engines[0].Position = game.Position()
+		runner.Search(int8(depth))
+	} else if len(args) > 2 && args[1] == "eval-check" {
+		CheckEvaluation(args[2])
+	} else if len(args) > 2 && args[1] == "eval" {
+		fen := strings.Join(args[2:], " ")
+		if len(strings.Fields(fen)) == 4 {
+			fen = fmt.Sprintf("%s 0 1", fen)
+		}
+		game := FromFen(fen)
+		fmt.Print(TraceEvaluate(game.Position()).String())
+	} else if len(args) > 2 && args[1] == "ttstats" {
+		tt, err := LoadCacheFromFile(args[2])
+		if err != nil {
+			// Maybe it is a shared table, it should not be created if it is missing
+			if _, statErr := os.Stat(args[2]); statErr == nil {
+				tt, err = NewSharedCache(args[2], 1, false)
+			}
+		}
+		if err != nil {
+			fmt.Println("could not open the hash: ", err)
+			os.Exit(1)
+		}
+		fmt.Print(TTStatsReport(tt))
+		if len(args) > 3 {
+			fen := strings.Join(args[3:], " ")
+			if len(strings.Fields(fen)) == 4 {
+				fen = fmt.Sprintf("%s 0 1", fen)
+			}
+			game := FromFen(fen)
+			fmt.Print(TTProbeReport(tt, game.Position()))
+		}
+		tt.Close()
+	} else if len(args) > 1 && args[1] == "spsa" {
+		iterations := intArg(args, 2, 200)
+		gamesPerIteration := intArg(args, 3, 16)
+		moveTime := intArg(args, 4, 100)
+		SPSASearchTuning(iterations, gamesPerIteration, int64(moveTime))
+	} else if len(args) > 1 && args[1] == "tbgen" {
+		path := "tablebases"
+		if len(args) > 2 {
+			path = args[2]
+		}
+		if err := GenerateTablebases(path); err != nil {
+			fmt.Println("could not generate the tablebases: ", err)
+			os.Exit(1)
+		}
 	} else {
 		var perftFlag = flag.Bool("perft", false, "Provide this to run perft tests")
 		var slowFlag = flag.Bool("slow", false, "Run all perft tests, even the very slow tests")
 		var tuneFlag = flag.Bool("tune", false, "Peform texel tuning for optimal evaluation values")
-		var prepareTuningFlag = flag.Bool("prepare-tuning-data", false, "Prepare quiet EPDs for tuning")
+		var prepareTuningFlag = flag.Bool("prepare-tuning-data", false, "Prepare quiet EPDs for tuning, reads PGN or EPD files passed via -test-positions")
+		var outputPath = flag.String("output", "quiet-positions.epd", "Path to the output file of prepare-tuning-data")
+		var samplesPerGame = flag.Int("samples-per-game", 10, "Maximum number of positions sampled from each game when preparing tuning data, 0 means all")
 		var perftTreeFlag = flag.Bool("perft-tree", false, "Run the engine in prefttree mode")
 		var profileFlag = flag.Bool("profile", false, "Run the engine in profiling mode")
 		var bookPath = flag.String("book", "", "Path to openning book in PolyGlot (bin) format")
 		var epdPath = flag.String("test-positions", "", "Path to EPD positions, used to test the strength of the engine")
+		var loadHashPath = flag.String("load-hash", "", "Path to a transposition table file to load when starting in UCI mode")
+		var saveHashPath = flag.String("save-hash", "", "Path to save the transposition table to when quitting UCI mode")
+		var sharedHashPath = flag.String("shared-hash", "", "Path to a memory mapped transposition table, shared with the other zahak processes that use it")
+		var clusterWorkers = flag.String("cluster-workers", "", "Comma separated addresses of zahak cluster workers to search with, unix:<path> or <host>:<port>")
 		var excludeParams = flag.String("exclude-params", "", "Exclude parameters when tuning, format: 1, 9, 10, 11 or 1, 9-11")
 		flag.Parse()
 		if *profileFlag {
@@ -53,7 +138,7 @@ func main() {
 			defer mem.Close() // error handling omitted for example
 		}
 		if *prepareTuningFlag && *epdPath != "" {
-			PrepareTuningData(*epdPath)
+			PrepareTuningData(*epdPath, *outputPath, *samplesPerGame)
 		} else if *tuneFlag && *epdPath != "" {
 			paramsToExclude := make(map[int]bool)
 			if excludeParams != nil {
@@ -111,7 +196,41 @@ ZZZZZZZZZZZZZZZZZZZ  aaaaaaaaaa  aaaahhhhhhh     hhhhhhh  aaaaaaaaaa  aaaakkkkkk
 
 
 `)
-			NewUCI(version, *bookPath != "", *bookPath).Start()
+			uci := NewUCI(version, *bookPath != "", *bookPath)
+			if *sharedHashPath != "" {
+				if err := uci.UseSharedHash(*sharedHashPath); err != nil {
+					fmt.Println("could not attach to the shared hash: ", err)
+					os.Exit(1)
+				}
+			}
+			if *loadHashPath != "" {
+				if err := uci.LoadHashFromFile(*loadHashPath); err != nil {
+					fmt.Println("could not load the hash: ", err)
+					os.Exit(1)
+				}
+			}
+			if *clusterWorkers != "" {
+				if err := uci.UseClusterWorkers(strings.Split(*clusterWorkers, ",")); err != nil {
+					fmt.Println("could not connect to the cluster workers: ", err)
+					os.Exit(1)
+				}
+			}
+			if *saveHashPath != "" {
+				uci.SaveHashOnQuit(*saveHashPath)
+			}
+			uci.Start()
 		}
 	}
 }
+
+func intArg(args []string, index int, defaultValue int) int {
+	if len(args) <= index {
+		return defaultValue
+	}
+	value, err := strconv.Atoi(args[index])
+	if err != nil {
+		fmt.Printf("Invalid argument %s, using %d instead\n", args[index], defaultValue)
+		return defaultValue
+	}
+	return value
+}